@@ -111,6 +111,8 @@ def upsert_mass_spectrum(cur: Cursor[Any], row: dict[str, Any]) -> None:
 	)
 
 _COMPOUND_COLS = ("inchikey", "name", "inchi", "smiles", "formula")
+_COMPOUND_IDENTIFIER_COLS = ("inchikey", "kind", "value")
+_COMPOUND_SYNONYM_COLS = ("inchikey", "synonym")
 
 
 def _batch_values_placeholders(n_rows: int, n_cols: int) -> str:
@@ -193,11 +195,53 @@ def upsert_mass_spectra_batch(cur: Cursor[Any], rows: list[dict[str, Any]]) -> N
 	)
 
 
+def upsert_compound_identifiers_batch(cur: Cursor[Any], rows: list[dict[str, str]]) -> None:
+	"""Insert (inchikey, kind, value) rows into compound_identifiers, ignoring ones already present. Empty list is a no-op."""
+	if not rows:
+		return
+	placeholders = _batch_values_placeholders(len(rows), len(_COMPOUND_IDENTIFIER_COLS))
+	params: list[Any] = []
+	for row in rows:
+		for k in _COMPOUND_IDENTIFIER_COLS:
+			params.append(row.get(k))
+	cols = ", ".join(_COMPOUND_IDENTIFIER_COLS)
+	cur.execute(
+		f"""
+		INSERT INTO compound_identifiers ({cols})
+		VALUES {placeholders}
+		ON CONFLICT (inchikey, kind, value) DO NOTHING
+		""",
+		params,
+	)
+
+
+def upsert_compound_synonyms_batch(cur: Cursor[Any], rows: list[dict[str, str]]) -> None:
+	"""Insert (inchikey, synonym) rows into compound_synonyms, ignoring ones already present. Empty list is a no-op."""
+	if not rows:
+		return
+	placeholders = _batch_values_placeholders(len(rows), len(_COMPOUND_SYNONYM_COLS))
+	params: list[Any] = []
+	for row in rows:
+		for k in _COMPOUND_SYNONYM_COLS:
+			params.append(row.get(k))
+	cols = ", ".join(_COMPOUND_SYNONYM_COLS)
+	cur.execute(
+		f"""
+		INSERT INTO compound_synonyms ({cols})
+		VALUES {placeholders}
+		ON CONFLICT (inchikey, synonym) DO NOTHING
+		""",
+		params,
+	)
+
+
 __all__ = [
 	"MASS_SPECTRA_COLS",
 	"close_pool",
 	"get_connection",
 	"upsert_compound",
+	"upsert_compound_identifiers_batch",
+	"upsert_compound_synonyms_batch",
 	"upsert_mass_spectrum",
 	"upsert_compounds_batch",
 	"upsert_mass_spectra_batch",
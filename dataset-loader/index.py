@@ -5,6 +5,8 @@ loaders = [
 		'MassBankDataLoader',
 		'https://github.com/MassBank/MassBank-data/releases/download/2025.10/MassBank_NISTformat.msp',
 		batch_size=10,
+		# v2: also loads compound_identifiers / compound_synonyms
+		dataset_version="2",
 	)
 ]
 
@@ -31,7 +31,7 @@ class DatasetLoaderBase(ABC):
 		print(f"Loading dataset: {self.uniq_key} from {self.source_url}", flush=True)
 		self._download_dataset()
 		state = self._read_loader_state()
-		if state is not None and state.status == "success":
+		if state is not None and state.status == "success" and state.dataset_version == self.dataset_version:
 			checksum = self._get_dataset_checksum()
 			if checksum is not None and checksum == state.checksum:
 				return
@@ -97,6 +97,7 @@ class DatasetLoaderBase(ABC):
 					VALUES (%s, %s, 'running', %s, NOW())
 					ON CONFLICT (dataset_key) DO UPDATE SET
 						updated_at = NOW(),
+						dataset_version = EXCLUDED.dataset_version,
 						checksum = EXCLUDED.checksum,
 						status = 'running'
 					""",
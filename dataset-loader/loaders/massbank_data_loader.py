@@ -1,6 +1,12 @@
+import re
 import time
 
-from facade.db import upsert_compounds_batch, upsert_mass_spectra_batch
+from facade.db import (
+	upsert_compound_identifiers_batch,
+	upsert_compound_synonyms_batch,
+	upsert_compounds_batch,
+	upsert_mass_spectra_batch,
+)
 from .dataset_loader_base import DatasetLoaderBase
 
 # MassBank metadata key -> mass_spectra table column name
@@ -20,6 +26,23 @@ METADATA_KEY_TO_TABLE_KEY = {
 	"Spectrum_type": "spectrum_type",
 }
 
+# Identifier kind (compound_identifiers.kind) -> lowercase keys it may appear under, either as
+# a metadata field ("CAS: 50-00-0") or inside the quoted Comments pairs ("\"cas=50-00-0\"").
+IDENTIFIER_KIND_TO_KEYS = {
+	"cas": ("cas", "casno", "cas#", "cas number"),
+	"pubchem_cid": ("pubchem cid", "pubchem", "pubchemcid", "pubchem_cid", "cid"),
+	"chebi": ("chebi",),
+	"chembl": ("chembl", "chembl id", "chembl_id"),
+	"hmdb": ("hmdb", "hmdb id", "hmdb_id"),
+	"kegg": ("kegg", "kegg id", "kegg_id"),
+}
+_IDENTIFIER_KEY_TO_KIND = {key: kind for kind, keys in IDENTIFIER_KIND_TO_KEYS.items() for key in keys}
+
+# Metadata keys that may repeat within one record; collected as lists instead of overwritten.
+MULTI_VALUE_KEYS = ("Synon",)
+
+_COMMENT_PAIR_RE = re.compile(r'"([^"=]+)=([^"]*)"')
+
 # Scale factor for m/z to store as int4 (4 decimal places)
 MZ_SCALE = 10_000
 
@@ -38,6 +61,57 @@ def metadata_to_compounds_table_row(metadata: dict[str, str]) -> dict[str, str]
 	return row
 
 
+def normalize_identifier(kind: str, value: str) -> str | None:
+	"""Canonicalize an identifier value for its kind. Returns None if it does not look valid."""
+	value = value.strip()
+	if not value or value.lower() in ("n/a", "na", "none", "null"):
+		return None
+	if kind == "pubchem_cid":
+		value = value.upper().removeprefix("CID:").removeprefix("CID").strip()
+		return value if value.isdigit() else None
+	if kind == "chebi":
+		value = value.upper().removeprefix("CHEBI:").strip()
+		return value if value.isdigit() else None
+	if kind == "cas":
+		return value if re.fullmatch(r"\d{2,7}-\d{2}-\d", value) else None
+	return value.upper()
+
+
+def metadata_to_compound_identifier_rows(metadata: dict[str, str]) -> list[dict[str, str]]:
+	"""Extract external identifiers (CAS, PubChem CID, ChEBI, ChEMBL, HMDB, KEGG) from metadata fields and Comments pairs."""
+	inchikey = metadata.get("InChIKey", "").strip()
+	candidates: list[tuple[str, str]] = [(key, value) for key, value in metadata.items() if key != "Comments"]
+	candidates.extend(_COMMENT_PAIR_RE.findall(metadata.get("Comments", "")))
+
+	rows: list[dict[str, str]] = []
+	seen: set[tuple[str, str]] = set()
+	for key, value in candidates:
+		kind = _IDENTIFIER_KEY_TO_KIND.get(key.strip().lower())
+		if kind is None:
+			continue
+		normalized = normalize_identifier(kind, value)
+		if normalized is None or (kind, normalized) in seen:
+			continue
+		seen.add((kind, normalized))
+		rows.append({"inchikey": inchikey, "kind": kind, "value": normalized})
+	return rows
+
+
+def metadata_to_compound_synonym_rows(metadata: dict[str, str], synonyms: list[str]) -> list[dict[str, str]]:
+	"""Build compound_synonyms rows. Skips NIST-style "$:" annotations that share the Synon field."""
+	inchikey = metadata.get("InChIKey", "").strip()
+	name = metadata.get("Name", "").strip()
+	rows: list[dict[str, str]] = []
+	seen: set[str] = set()
+	for synonym in synonyms:
+		synonym = synonym.strip()
+		if not synonym or synonym.startswith("$:") or synonym == name or synonym in seen:
+			continue
+		seen.add(synonym)
+		rows.append({"inchikey": inchikey, "synonym": synonym})
+	return rows
+
+
 def data_to_mass_spectra_table_row(
     metadata: dict[str, str],
     m_z_arr: list[int],
@@ -66,8 +140,8 @@ def data_to_mass_spectra_table_row(
 
 
 class MassbankDataLoader(DatasetLoaderBase):
-	def __init__(self, uniq_key: str, source_url: str, batch_size: int = 1000, batch_delay: float = 0.0):
-		super().__init__(uniq_key, source_url)
+	def __init__(self, uniq_key: str, source_url: str, batch_size: int = 1000, batch_delay: float = 0.0, dataset_version: str = "1"):
+		super().__init__(uniq_key, source_url, dataset_version)
 		self._row_count = 0
 		self.batch_size = batch_size
 		self.batch_delay = batch_delay
@@ -76,9 +150,11 @@ class MassbankDataLoader(DatasetLoaderBase):
 		with self._get_connection() as conn:
 			with conn.cursor() as cur:
 				compounds_batch: list[dict[str, str]] = []
+				identifiers_batch: list[dict[str, str]] = []
+				synonyms_batch: list[dict[str, str]] = []
 				rows_batch: list[dict] = []
 				for raw_item in self._get_dataset_raw_items():
-					metadata, (m_z_arr, intensity_arr) = self._parse_raw_item(raw_item)
+					metadata, multi_values, (m_z_arr, intensity_arr) = self._parse_raw_item(raw_item)
 					compound = metadata_to_compounds_table_row(metadata)
 					if compound is None:
 						continue
@@ -89,19 +165,33 @@ class MassbankDataLoader(DatasetLoaderBase):
 					mass_spec["source"] = self.uniq_key
 					
 					compounds_batch.append(compound)
+					identifiers_batch.extend(metadata_to_compound_identifier_rows(metadata))
+					synonyms_batch.extend(metadata_to_compound_synonym_rows(metadata, multi_values.get("Synon", [])))
 					rows_batch.append(mass_spec)
 
 					if len(rows_batch) >= self.batch_size:
-						self.batch_write_to_db(cur, conn, compounds_batch, rows_batch)
+						self.batch_write_to_db(cur, conn, compounds_batch, rows_batch, identifiers_batch, synonyms_batch)
 						compounds_batch = []
+						identifiers_batch = []
+						synonyms_batch = []
 						rows_batch = []
 				if rows_batch:
-					self.batch_write_to_db(cur, conn, compounds_batch, rows_batch)
-
-	def batch_write_to_db(self, cur, conn, compounds_batch: list, rows_batch: list) -> None:
-		"""Upsert one batch of compounds and mass spectra (deduped in SQL), then commit."""
+					self.batch_write_to_db(cur, conn, compounds_batch, rows_batch, identifiers_batch, synonyms_batch)
+
+	def batch_write_to_db(
+		self,
+		cur,
+		conn,
+		compounds_batch: list,
+		rows_batch: list,
+		identifiers_batch: list | None = None,
+		synonyms_batch: list | None = None,
+	) -> None:
+		"""Upsert one batch of compounds, their identifiers/synonyms and mass spectra (deduped in SQL), then commit."""
 		try:
 			upsert_compounds_batch(cur, compounds_batch)
+			upsert_compound_identifiers_batch(cur, identifiers_batch or [])
+			upsert_compound_synonyms_batch(cur, synonyms_batch or [])
 			upsert_mass_spectra_batch(cur, rows_batch)
 			self._row_count += len(rows_batch)
 			print(f"Committed {self._row_count} records so far.", flush=True)
@@ -127,12 +217,13 @@ class MassbankDataLoader(DatasetLoaderBase):
 				yield b"".join(item_raw)
 
 	@staticmethod
-	def _parse_raw_item(raw_item: bytes) -> tuple[dict[str, str], tuple[list[int], list[int]]]:
-		"""Parse a MassBank record: metadata (Field: Value) and peak data (m/z intensity). Returns m/z scaled by MZ_SCALE and intensity rounded to int for DB int4[]."""
+	def _parse_raw_item(raw_item: bytes) -> tuple[dict[str, str], dict[str, list[str]], tuple[list[int], list[int]]]:
+		"""Parse a MassBank record: metadata (Field: Value), repeated fields in MULTI_VALUE_KEYS (e.g. Synon) and peak data (m/z intensity). Returns m/z scaled by MZ_SCALE and intensity rounded to int for DB int4[]."""
 		text = raw_item.decode("utf-8")
 		lines = text.strip().splitlines()
 
 		metadata: dict[str, str] = {}
+		multi_values: dict[str, list[str]] = {}
 		m_z_arr: list[int] = []
 		intensity_arr: list[int] = []
 
@@ -143,7 +234,11 @@ class MassbankDataLoader(DatasetLoaderBase):
 
 			if ":" in line:
 				key, _, value = line.partition(":")
-				metadata[key.strip()] = value.strip()
+				key = key.strip()
+				if key in MULTI_VALUE_KEYS:
+					multi_values.setdefault(key, []).append(value.strip())
+				else:
+					metadata[key] = value.strip()
 			
 			else:
 				parts = line.split()
@@ -154,4 +249,4 @@ class MassbankDataLoader(DatasetLoaderBase):
 					except ValueError:
 						pass
 
-		return metadata, (m_z_arr, intensity_arr)
\ No newline at end of file
+		return metadata, multi_values, (m_z_arr, intensity_arr)
\ No newline at end of file
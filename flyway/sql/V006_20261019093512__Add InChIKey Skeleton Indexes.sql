@@ -0,0 +1,4 @@
+-- Add your migration SQL here
+-- Lookups by the 14-character InChIKey skeleton (first block) match all stereoisomers / protonation variants.
+CREATE INDEX idx_compounds_inchikey_skeleton    ON compounds (LEFT(inchikey, 14));
+CREATE INDEX idx_mass_spectra_inchikey_skeleton ON mass_spectra (LEFT(inchikey, 14));
@@ -0,0 +1,19 @@
+-- Add your migration SQL here
+CREATE TABLE compound_synonyms (
+    inchikey  CHAR(27) REFERENCES compounds(inchikey) ON DELETE CASCADE NOT NULL,
+    synonym   TEXT NOT NULL,
+
+    PRIMARY KEY (inchikey, synonym)
+);
+
+CREATE INDEX idx_compound_synonyms_lower ON compound_synonyms (LOWER(synonym));
+
+CREATE TABLE compound_identifiers (
+    inchikey  CHAR(27) REFERENCES compounds(inchikey) ON DELETE CASCADE NOT NULL,
+    kind      TEXT NOT NULL CHECK (kind IN ('cas', 'pubchem_cid', 'chebi', 'chembl', 'hmdb', 'kegg')),
+    value     TEXT NOT NULL,
+
+    PRIMARY KEY (inchikey, kind, value)
+);
+
+CREATE INDEX idx_compound_identifiers_value_upper ON compound_identifiers (UPPER(value));
@@ -0,0 +1,12 @@
+-- Add your migration SQL here
+CREATE TABLE api_keys (
+    id                  BIGSERIAL PRIMARY KEY,
+    name                TEXT NOT NULL,
+    key_prefix          TEXT NOT NULL, -- first characters of the plaintext key, safe to show in listings/logs
+    key_hash            TEXT NOT NULL UNIQUE, -- hex SHA-256 of the plaintext key
+    requests_per_minute INTEGER NOT NULL CHECK (requests_per_minute > 0),
+    burst               INTEGER NOT NULL CHECK (burst > 0),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at        TIMESTAMPTZ,
+    revoked_at          TIMESTAMPTZ
+);
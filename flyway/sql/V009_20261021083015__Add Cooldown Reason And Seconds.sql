@@ -0,0 +1,14 @@
+-- Add your migration SQL here
+-- Cooldowns now depend on why the request failed: transient errors and rate limits back off for
+-- minutes or exactly the Retry-After delay, so durations are stored in seconds.
+ALTER TABLE third_party_cooldown
+	ADD COLUMN reason TEXT NOT NULL DEFAULT 'not_found', -- not_found | rate_limited | transient | invalid_response
+	ADD COLUMN current_cooldown_duration_seconds BIGINT CHECK (current_cooldown_duration_seconds >= 0);
+
+UPDATE third_party_cooldown
+SET current_cooldown_duration_seconds = current_cooldown_duration_hours::BIGINT * 3600;
+
+ALTER TABLE third_party_cooldown
+	ALTER COLUMN current_cooldown_duration_seconds SET NOT NULL,
+	ALTER COLUMN reason DROP DEFAULT,
+	DROP COLUMN current_cooldown_duration_hours;
@@ -0,0 +1,7 @@
+-- Add your migration SQL here
+-- Substring search (name/synonym ILIKE '%query%') cannot use B-tree indexes; trigram GIN indexes
+-- serve ILIKE with a leading wildcard.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_compounds_name_trgm            ON compounds USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_compound_synonyms_synonym_trgm ON compound_synonyms USING GIN (synonym gin_trgm_ops);
@@ -0,0 +1,207 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hydragen-v2/server/internal/domain"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey identifies a scripted client. Only the SHA-256 of the key is stored; the plaintext is
+// shown once, when the key is created.
+type APIKey struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	Prefix            string     `json:"prefix"`
+	RequestsPerMinute int        `json:"requestsPerMinute"`
+	Burst             int        `json:"burst"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	LastUsedAt        *time.Time `json:"lastUsedAt"`
+	RevokedAt         *time.Time `json:"revokedAt"`
+}
+
+type Store interface {
+	Create(ctx context.Context, key APIKey, keyHash string) (*APIKey, error)
+	// LookupActive returns the non-revoked key with the given hash (sql.ErrNoRows otherwise)
+	// and records it as used.
+	LookupActive(ctx context.Context, keyHash string) (*APIKey, error)
+	List(ctx context.Context) ([]APIKey, error)
+	Revoke(ctx context.Context, id int64) error
+}
+
+var ErrInvalidKey = errors.New("invalid or revoked API key")
+
+const (
+	keyPrefix     = "hg_"
+	prefixLength  = len(keyPrefix) + 6
+	lookupTTL     = time.Minute
+	defaultPerMin = 120
+	// maxCachedMisses bounds the cached lookups of unknown keys, which anyone can make up.
+	maxCachedMisses = 10000
+)
+
+type cachedLookup struct {
+	key       *APIKey
+	expiresAt time.Time
+}
+
+type Service struct {
+	store Store
+
+	mu     sync.Mutex
+	cache  map[string]cachedLookup
+	misses int
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store, cache: map[string]cachedLookup{}}
+}
+
+func HashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Create issues a new key and returns its plaintext, which cannot be recovered later.
+func (s *Service) Create(ctx context.Context, name string, requestsPerMinute int, burst int) (string, *APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, &domain.ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if requestsPerMinute == 0 {
+		requestsPerMinute = defaultPerMin
+	}
+	if burst == 0 {
+		burst = requestsPerMinute
+	}
+	if requestsPerMinute < 0 || burst < 0 {
+		return "", nil, &domain.ValidationError{Field: "requestsPerMinute", Message: "limits must be positive"}
+	}
+
+	plaintext, err := generateKey()
+	if err != nil {
+		return "", nil, err
+	}
+	created, err := s.store.Create(ctx, APIKey{
+		Name:              name,
+		Prefix:            plaintext[:prefixLength],
+		RequestsPerMinute: requestsPerMinute,
+		Burst:             burst,
+	}, HashKey(plaintext))
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, created, nil
+}
+
+// CachedKey returns the key a plaintext was recently authenticated as, without asking the store.
+func (s *Service) CachedKey(plaintext string) (*APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.cache[HashKey(plaintext)]
+	if !ok || cached.key == nil || time.Now().After(cached.expiresAt) {
+		return nil, false
+	}
+	return cached.key, true
+}
+
+// Authenticate resolves a presented key. Lookups (including up to maxCachedMisses misses) are
+// cached for a minute, so a revoked key may keep working for up to that long.
+func (s *Service) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	if !strings.HasPrefix(plaintext, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+	keyHash := HashKey(plaintext)
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.cache[keyHash]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		if cached.key == nil {
+			return nil, ErrInvalidKey
+		}
+		return cached.key, nil
+	}
+
+	key, err := s.store.LookupActive(ctx, keyHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for hash, entry := range s.cache {
+		if now.After(entry.expiresAt) {
+			s.forget(hash, entry)
+		}
+	}
+	if key != nil || s.misses < maxCachedMisses {
+		s.forget(keyHash, s.cache[keyHash])
+		s.cache[keyHash] = cachedLookup{key: key, expiresAt: now.Add(lookupTTL)}
+		if key == nil {
+			s.misses++
+		}
+	}
+	s.mu.Unlock()
+
+	if key == nil {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]APIKey, error) {
+	return s.store.List(ctx)
+}
+
+func (s *Service) Revoke(ctx context.Context, id int64) error {
+	if err := s.store.Revoke(ctx, id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for hash, entry := range s.cache {
+		if entry.key != nil && entry.key.ID == id {
+			s.forget(hash, entry)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// forget drops a cached lookup; s.mu must be held.
+func (s *Service) forget(hash string, entry cachedLookup) {
+	if _, ok := s.cache[hash]; !ok {
+		return
+	}
+	if entry.key == nil {
+		s.misses--
+	}
+	delete(s.cache, hash)
+}
+
+type clientContextKey struct{}
+
+func WithClient(ctx context.Context, key *APIKey) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, key)
+}
+
+// ClientFromContext returns the API key the request was made with, or nil.
+func ClientFromContext(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(clientContextKey{}).(*APIKey)
+	return key
+}
@@ -0,0 +1,99 @@
+package apikey_http
+
+import (
+	"context"
+	"errors"
+	apikey "hydragen-v2/server/internal/api_key/core"
+	"hydragen-v2/server/internal/http_helper"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AdminHandler struct {
+	keys *apikey.Service
+}
+
+func NewAdminHandler(keys *apikey.Service) *AdminHandler {
+	return &AdminHandler{keys: keys}
+}
+
+type createAPIKeyRequest struct {
+	Name              string `json:"name"`
+	RequestsPerMinute int    `json:"requestsPerMinute"`
+	Burst             int    `json:"burst"`
+}
+
+type createAPIKeyResponse struct {
+	// Key is the plaintext key; it is only ever returned here.
+	Key string `json:"key"`
+	apikey.APIKey
+}
+
+type apiKeyListResponse struct {
+	Items []apikey.APIKey `json:"items"`
+}
+
+func (h *AdminHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[CreateAPIKeyHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[CreateAPIKeyHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	var req createAPIKeyRequest
+	if err := http_helper.ReadJSON(w, r, &req); err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	plaintext, key, err := h.keys.Create(ctx, req.Name, req.RequestsPerMinute, req.Burst)
+	if err != nil {
+		slog.Error("[CreateAPIKeyHandler]: Create error", "name", req.Name, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[CreateAPIKeyHandler]: api key created", "id", key.ID, "name", key.Name, "prefix", key.Prefix)
+	http_helper.WriteJSON(w, http.StatusCreated, createAPIKeyResponse{Key: plaintext, APIKey: *key})
+}
+
+func (h *AdminHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	keys, err := h.keys.List(ctx)
+	if err != nil {
+		slog.Error("[ListAPIKeysHandler]: List error", "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+	if keys == nil {
+		keys = []apikey.APIKey{}
+	}
+	http_helper.WriteJSON(w, http.StatusOK, apiKeyListResponse{Items: keys})
+}
+
+func (h *AdminHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http_helper.WriteError(w, http.StatusBadRequest, errors.New("api key id must be a positive integer"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.keys.Revoke(ctx, id); err != nil {
+		slog.Error("[RevokeAPIKeyHandler]: Revoke error", "id", id, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[RevokeAPIKeyHandler]: api key revoked", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package apikey_http
+
+import (
+	"errors"
+	apikey "hydragen-v2/server/internal/api_key/core"
+	"hydragen-v2/server/internal/http_helper"
+	"hydragen-v2/server/internal/ratelimit"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+type RateLimitConfig struct {
+	// PerIP applies to requests without an API key (e.g. the web UI), keyed by client IP.
+	PerIP ratelimit.Limit
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For entry, as set by Caddy.
+	// Only enable it when the server cannot be reached except through the proxy, or clients pick
+	// their own bucket.
+	TrustForwardedFor bool
+	// Exempt paths (e.g. health checks) are never limited.
+	Exempt map[string]bool
+}
+
+// RateLimitConfigFromEnv reads RATE_LIMIT_IP_PER_MINUTE (default 600), RATE_LIMIT_IP_BURST
+// (default 100) and RATE_LIMIT_TRUST_FORWARDED_FOR (default false).
+func RateLimitConfigFromEnv() RateLimitConfig {
+	return RateLimitConfig{
+		PerIP:             ratelimit.PerMinute(envInt("RATE_LIMIT_IP_PER_MINUTE", 600), envInt("RATE_LIMIT_IP_BURST", 100)),
+		TrustForwardedFor: os.Getenv("RATE_LIMIT_TRUST_FORWARDED_FOR") == "true",
+		Exempt:            map[string]bool{"/health": true},
+	}
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+type RateLimiter struct {
+	keys    *apikey.Service
+	limiter *ratelimit.Limiter
+	config  RateLimitConfig
+}
+
+func NewRateLimiter(keys *apikey.Service, limiter *ratelimit.Limiter, config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{keys: keys, limiter: limiter, config: config}
+}
+
+// Middleware identifies the client by its X-API-Key (or, without one, by IP) and applies that
+// client's token bucket. Exhausted buckets get a 429 with Retry-After. Keys that were not
+// recently authenticated also cost a token of the IP's bucket before they are looked up, so
+// made-up keys can neither bypass the per-IP limit nor flood the key store.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.config.Exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ipBucketKey := "ip:" + rl.clientIP(r)
+		bucketKey := ipBucketKey
+		limit := rl.config.PerIP
+		if presented := strings.TrimSpace(r.Header.Get(APIKeyHeader)); presented != "" {
+			key, ok := rl.keys.CachedKey(presented)
+			if !ok {
+				if !rl.allow(w, r, ipBucketKey, rl.config.PerIP) {
+					return
+				}
+				var err error
+				key, err = rl.keys.Authenticate(r.Context(), presented)
+				if err != nil {
+					status := http.StatusUnauthorized
+					if !errors.Is(err, apikey.ErrInvalidKey) {
+						status = http.StatusInternalServerError
+					}
+					http_helper.WriteError(w, status, err)
+					return
+				}
+			}
+			bucketKey = "key:" + strconv.FormatInt(key.ID, 10)
+			limit = ratelimit.PerMinute(key.RequestsPerMinute, key.Burst)
+			r = r.WithContext(apikey.WithClient(r.Context(), key))
+		}
+
+		if !rl.allow(w, r, bucketKey, limit) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the bucket, or answers 429 with Retry-After and returns false.
+func (rl *RateLimiter) allow(w http.ResponseWriter, r *http.Request, bucketKey string, limit ratelimit.Limit) bool {
+	ok, retryAfter := rl.limiter.Allow(bucketKey, limit)
+	if ok {
+		return true
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	slog.Info("[RateLimiter]: rate limited", "client", bucketKey, "path", r.URL.Path, "retryAfter", time.Duration(seconds)*time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http_helper.WriteJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+	return false
+}
+
+func (rl *RateLimiter) clientIP(r *http.Request) string {
+	if rl.config.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
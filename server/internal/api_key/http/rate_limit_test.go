@@ -0,0 +1,145 @@
+package apikey_http
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	apikey "hydragen-v2/server/internal/api_key/core"
+	"hydragen-v2/server/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memoryAPIKeyStore struct {
+	byHash map[string]*apikey.APIKey
+}
+
+func (m *memoryAPIKeyStore) Create(ctx context.Context, key apikey.APIKey, keyHash string) (*apikey.APIKey, error) {
+	key.ID = int64(len(m.byHash) + 1)
+	m.byHash[keyHash] = &key
+	return &key, nil
+}
+
+func (m *memoryAPIKeyStore) LookupActive(ctx context.Context, keyHash string) (*apikey.APIKey, error) {
+	key, ok := m.byHash[keyHash]
+	if !ok || key.RevokedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return key, nil
+}
+
+func (m *memoryAPIKeyStore) List(ctx context.Context) ([]apikey.APIKey, error) {
+	return nil, nil
+}
+
+func (m *memoryAPIKeyStore) Revoke(ctx context.Context, id int64) error {
+	return nil
+}
+
+func TestRateLimiter_SeparateQuotasAndRetryAfter(t *testing.T) {
+	service := apikey.NewService(&memoryAPIKeyStore{byHash: map[string]*apikey.APIKey{}})
+	plaintext, _, err := service.Create(context.Background(), "nightly-script", 60, 1)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	rl := NewRateLimiter(service, ratelimit.NewLimiter(), RateLimitConfig{
+		PerIP:             ratelimit.PerMinute(60, 2),
+		TrustForwardedFor: true,
+		Exempt:            map[string]bool{"/health": true},
+	})
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(path string, apiKey string) *httptest.ResponseRecorder {
+		return doFrom(handler, "198.51.100.4", path, apiKey)
+	}
+
+	// A running client's key has been authenticated recently; only new lookups cost IP tokens.
+	if _, err := service.Authenticate(context.Background(), plaintext); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	// The key's burst of 1 is used up by its first request; the same IP keeps its own quota.
+	if got := do("/compounds", plaintext).Code; got != http.StatusOK {
+		t.Fatalf("first keyed request: got %d", got)
+	}
+	limited := do("/compounds", plaintext)
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("second keyed request: got %d, want 429", limited.Code)
+	}
+	if limited.Header().Get("Retry-After") == "" {
+		t.Fatal("429 response is missing Retry-After")
+	}
+	for i := 0; i < 2; i++ {
+		if got := do("/compounds", "").Code; got != http.StatusOK {
+			t.Fatalf("anonymous request %d: got %d", i, got)
+		}
+	}
+	if got := do("/compounds", "").Code; got != http.StatusTooManyRequests {
+		t.Fatalf("anonymous request beyond burst: got %d, want 429", got)
+	}
+	if got := do("/health", "").Code; got != http.StatusOK {
+		t.Fatalf("exempt path: got %d", got)
+	}
+	if got := doFrom(handler, "198.51.100.5", "/compounds", "hg_not-a-real-key").Code; got != http.StatusUnauthorized {
+		t.Fatalf("unknown key: got %d, want 401", got)
+	}
+}
+
+func doFrom(handler http.Handler, ip string, path string, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Forwarded-For", ip)
+	if apiKey != "" {
+		req.Header.Set(APIKeyHeader, apiKey)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+type countingAPIKeyStore struct {
+	memoryAPIKeyStore
+	lookups int
+}
+
+func (c *countingAPIKeyStore) LookupActive(ctx context.Context, keyHash string) (*apikey.APIKey, error) {
+	c.lookups++
+	return c.memoryAPIKeyStore.LookupActive(ctx, keyHash)
+}
+
+func TestRateLimiter_InvalidKeysCountAgainstTheIP(t *testing.T) {
+	store := &countingAPIKeyStore{memoryAPIKeyStore: memoryAPIKeyStore{byHash: map[string]*apikey.APIKey{}}}
+	rl := NewRateLimiter(apikey.NewService(store), ratelimit.NewLimiter(), RateLimitConfig{
+		PerIP:             ratelimit.PerMinute(60, 5),
+		TrustForwardedFor: true,
+	})
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	statuses := map[int]int{}
+	for i := range 50 {
+		statuses[doFrom(handler, "203.0.113.9", "/compounds", fmt.Sprintf("hg_random-%d", i)).Code]++
+	}
+	if statuses[http.StatusUnauthorized] != 5 || statuses[http.StatusTooManyRequests] != 45 {
+		t.Errorf("got statuses %v, want 5 x 401 then 429", statuses)
+	}
+	if store.lookups != 5 {
+		t.Errorf("got %d key lookups, want 5", store.lookups)
+	}
+	if got := doFrom(handler, "203.0.113.9", "/compounds", "").Code; got != http.StatusTooManyRequests {
+		t.Errorf("anonymous request from the same IP: got %d, want 429", got)
+	}
+}
+
+func TestRateLimitConfigFromEnv_ForwardedForIsOptIn(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "false": false, "yes": false, "true": true} {
+		t.Setenv("RATE_LIMIT_TRUST_FORWARDED_FOR", value)
+		if got := RateLimitConfigFromEnv().TrustForwardedFor; got != want {
+			t.Errorf("RATE_LIMIT_TRUST_FORWARDED_FOR=%q: got %v, want %v", value, got, want)
+		}
+	}
+}
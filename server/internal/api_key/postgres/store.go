@@ -0,0 +1,136 @@
+package apikey_postgres
+
+import (
+	"context"
+	"database/sql"
+	apikey "hydragen-v2/server/internal/api_key/core"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+)
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+const apiKeyColumns = `id, name, key_prefix, requests_per_minute, burst, created_at, last_used_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*apikey.APIKey, error) {
+	var key apikey.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.RequestsPerMinute,
+		&key.Burst,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (p *PostgresAPIKeyStore) Create(ctx context.Context, key apikey.APIKey, keyHash string) (*apikey.APIKey, error) {
+	if p.db == nil {
+		return nil, domain.ErrReadOnly
+	}
+
+	const sqlQuery = `
+		INSERT INTO api_keys (name, key_prefix, key_hash, requests_per_minute, burst)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + apiKeyColumns
+
+	created, err := scanAPIKey(p.db.QueryRowContext(ctx, sqlQuery, key.Name, key.Prefix, keyHash, key.RequestsPerMinute, key.Burst))
+	if err != nil {
+		slog.Error("[DB CreateAPIKey]: postgres error", "error", err, "name", key.Name)
+		return nil, err
+	}
+	return created, nil
+}
+
+func (p *PostgresAPIKeyStore) LookupActive(ctx context.Context, keyHash string) (*apikey.APIKey, error) {
+	if p.db == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	const sqlQuery = `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING ` + apiKeyColumns
+
+	key, err := scanAPIKey(p.db.QueryRowContext(ctx, sqlQuery, keyHash))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("[DB LookupAPIKey]: postgres error", "error", err)
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func (p *PostgresAPIKeyStore) List(ctx context.Context) ([]apikey.APIKey, error) {
+	if p.db == nil {
+		return nil, nil
+	}
+
+	const sqlQuery = `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id ASC`
+
+	rows, err := p.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		slog.Error("[DB ListAPIKeys]: postgres error", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []apikey.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			slog.Error("[DB ListAPIKeys]: failed to scan row", "error", err)
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB ListAPIKeys]: rows iteration error", "error", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (p *PostgresAPIKeyStore) Revoke(ctx context.Context, id int64) error {
+	if p.db == nil {
+		return sql.ErrNoRows
+	}
+
+	const sqlQuery = `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := p.db.ExecContext(ctx, sqlQuery, id)
+	if err != nil {
+		slog.Error("[DB RevokeAPIKey]: postgres error", "error", err, "id", id)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
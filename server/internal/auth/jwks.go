@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set into public keys by key id.
+// Keys not meant for signatures and unsupported key types are skipped. Keys whose JWK names an
+// "alg" only verify tokens signed with that algorithm.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("[auth.ParseJWKS]: skipping key", "kid", jwk.Kid, "kty", jwk.Kty, "error", err)
+			continue
+		}
+		if jwk.Alg != "" {
+			key = pinnedKey{PublicKey: key, alg: jwk.Alg}
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// pinnedKey is a key its JWK restricts to a single algorithm.
+type pinnedKey struct {
+	crypto.PublicKey
+	alg string
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// KeySource returns the verification key for a key id.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// StaticKeySource serves keys loaded once, e.g. from a local JWKS file.
+type StaticKeySource struct {
+	keys map[string]crypto.PublicKey
+}
+
+func NewStaticKeySource(keys map[string]crypto.PublicKey) *StaticKeySource {
+	return &StaticKeySource{keys: keys}
+}
+
+func LoadJWKSFile(path string) (*StaticKeySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticKeySource(keys), nil
+}
+
+func (s *StaticKeySource) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+const (
+	jwksRefreshInterval    = time.Hour
+	jwksMinRefreshInterval = 30 * time.Second
+	jwksMaxBytes           = 1 << 20
+)
+
+// RemoteKeySource fetches a JWKS over HTTP (e.g. Keycloak's .../protocol/openid-connect/certs).
+// Keys are refreshed hourly, and early when a token names an unknown kid (at most every 30s),
+// so signing-key rotation is picked up without a restart. Failed fetches count towards the 30s
+// too, so an identity provider outage does not turn every request into a fetch.
+type RemoteKeySource struct {
+	url    string
+	client *http.Client
+	// fetches lets concurrent requests share one fetch; the lock is never held across it.
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch, successful or not.
+	attemptedAt time.Time
+	lastErr     error
+}
+
+func NewRemoteKeySource(url string) *RemoteKeySource {
+	return &RemoteKeySource{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *RemoteKeySource) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.fetchedAt) > jwksRefreshInterval
+	mayRefresh := time.Since(s.attemptedAt) > jwksMinRefreshInterval
+	lastErr := s.lastErr
+	s.mu.Unlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if mayRefresh {
+		// The fetch outlives a caller that gives up; the client timeout bounds it.
+		result := s.fetches.DoChan("jwks", func() (any, error) {
+			return nil, s.refresh(context.WithoutCancel(ctx))
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-result:
+		}
+		s.mu.Lock()
+		key, ok = s.keys[kid]
+		lastErr = s.lastErr
+		s.mu.Unlock()
+	}
+	if ok {
+		// Stale keys are still served while the identity provider is unreachable.
+		return key, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *RemoteKeySource) refresh(ctx context.Context) error {
+	keys, err := s.fetch(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attemptedAt = time.Now()
+	s.lastErr = err
+	if err != nil {
+		slog.Error("[auth.RemoteKeySource]: unable to refresh JWKS", "url", s.url, "error", err)
+		return err
+	}
+	s.keys = keys
+	s.fetchedAt = s.attemptedAt
+	return nil
+}
+
+func (s *RemoteKeySource) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d fetching JWKS", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, jwksMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
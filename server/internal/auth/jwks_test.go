@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemoteKeySource_SharesFetchesAndBacksOffAfterFailures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := os.ReadFile(writeJWKS(t, "test-key", key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	var down atomic.Bool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	// An outage before the first successful fetch: concurrent requests share one failed fetch,
+	// and later requests do not refetch within the minimum interval.
+	down.Store(true)
+	source := NewRemoteKeySource(server.URL)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := source.Key(t.Context(), "test-key"); err == nil {
+				t.Error("expected an error while the JWKS endpoint is down")
+			}
+		})
+	}
+	close(release)
+	wg.Wait()
+	if _, err := source.Key(t.Context(), "test-key"); err == nil {
+		t.Error("expected an error while the JWKS endpoint is down")
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("got %d fetches during the outage, want 1", got)
+	}
+
+	// Once the minimum interval has passed, the next request fetches again.
+	down.Store(false)
+	source.mu.Lock()
+	source.attemptedAt = source.attemptedAt.Add(-jwksMinRefreshInterval)
+	source.mu.Unlock()
+	if _, err := source.Key(t.Context(), "test-key"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if _, err := source.Key(t.Context(), "test-key"); err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("got %d fetches, want 2", got)
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"hydragen-v2/server/internal/http_helper"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject  string
+	Username string
+	Role     Role
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller, or nil for anonymous requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return principal
+}
+
+// HasRole reports whether the request context carries a principal with at least role.
+func HasRole(ctx context.Context, role Role) bool {
+	principal := PrincipalFromContext(ctx)
+	return principal != nil && principal.Role >= role
+}
+
+type Authenticator struct {
+	verifier *Verifier
+	roles    RoleMapping
+}
+
+// NewAuthenticator returns an Authenticator. A nil verifier disables token authentication:
+// every request is anonymous, so guarded routes always answer 401.
+func NewAuthenticator(verifier *Verifier, roles RoleMapping) *Authenticator {
+	return &Authenticator{verifier: verifier, roles: roles}
+}
+
+// NewAuthenticatorFromEnv configures JWT verification from:
+//
+//	AUTH_JWKS_FILE or AUTH_JWKS_URL  signing keys (local JWKS file, or e.g. Keycloak's .../protocol/openid-connect/certs)
+//	AUTH_ISSUER                      expected "iss" (optional)
+//	AUTH_AUDIENCE                    expected "aud"/"azp" (optional)
+//	AUTH_ROLE_MAP                    realm role mapping, e.g. "student:reader,instructor:curator,admin:admin"
+func NewAuthenticatorFromEnv() (*Authenticator, error) {
+	roles := DefaultRoleMapping()
+	if value := os.Getenv("AUTH_ROLE_MAP"); value != "" {
+		parsed, err := ParseRoleMapping(value)
+		if err != nil {
+			return nil, err
+		}
+		roles = parsed
+	}
+
+	var keys KeySource
+	if path := os.Getenv("AUTH_JWKS_FILE"); path != "" {
+		fileKeys, err := LoadJWKSFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = fileKeys
+	} else if url := os.Getenv("AUTH_JWKS_URL"); url != "" {
+		keys = NewRemoteKeySource(url)
+	} else {
+		slog.Warn("[auth.NewAuthenticatorFromEnv]: neither AUTH_JWKS_FILE nor AUTH_JWKS_URL is set, guarded routes are disabled")
+		return NewAuthenticator(nil, roles), nil
+	}
+
+	return NewAuthenticator(&Verifier{
+		Keys:     keys,
+		Issuer:   os.Getenv("AUTH_ISSUER"),
+		Audience: os.Getenv("AUTH_AUDIENCE"),
+		Leeway:   30 * time.Second,
+	}, roles), nil
+}
+
+// Middleware authenticates bearer tokens when present. Requests without a token pass through
+// anonymously; a token that fails verification is rejected with 401.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.verifier == nil {
+			writeUnauthorized(w, errors.New("token authentication is not configured"))
+			return
+		}
+		claims, err := a.verifier.Verify(r.Context(), token)
+		if err != nil {
+			slog.Info("[auth.Middleware]: rejected token", "path", r.URL.Path, "error", err)
+			writeUnauthorized(w, err)
+			return
+		}
+		principal := &Principal{
+			Subject:  claims.Subject,
+			Username: claims.PreferredUsername,
+			Role:     a.roles.Resolve(claims.RealmAccess.Roles),
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Require only lets through callers holding at least role: 401 for anonymous callers, 403 otherwise.
+func Require(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := PrincipalFromContext(r.Context())
+		if principal == nil {
+			writeUnauthorized(w, errors.New("authentication required"))
+			return
+		}
+		if principal.Role < role {
+			slog.Info("[auth.Require]: insufficient role", "path", r.URL.Path, "subject", principal.Subject, "role", principal.Role, "required", role)
+			http_helper.WriteError(w, http.StatusForbidden, errors.New("requires role "+role.String()))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="hydragen"`)
+	http_helper.WriteError(w, http.StatusUnauthorized, err)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://example.com/v2/auth/realms/Hydragen"
+	testAudience = "hydragen-web"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// writeJWKS writes the public half of key as a one-key JWKS file and returns its path.
+func writeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func signRS256(t *testing.T, kid string, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(signature)
+}
+
+// signPS256 signs with RSASSA-PSS, which the test JWKS does not allow for its RS256 key.
+func signPS256(t *testing.T, kid string, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "PS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func claimsWithRoles(roles ...string) map[string]any {
+	return map[string]any{
+		"sub":                "user-1",
+		"iss":                testIssuer,
+		"aud":                "account",
+		"azp":                testAudience,
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "curie",
+		"realm_access":       map[string]any{"roles": roles},
+	}
+}
+
+func newTestServer(t *testing.T, key *rsa.PrivateKey) http.Handler {
+	t.Helper()
+	keys, err := LoadJWKSFile(writeJWKS(t, "test-key", key))
+	if err != nil {
+		t.Fatalf("LoadJWKSFile: %v", err)
+	}
+	authenticator := NewAuthenticator(&Verifier{Keys: keys, Issuer: testIssuer, Audience: testAudience}, DefaultRoleMapping())
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /public", ok)
+	mux.HandleFunc("POST /write", Require(RoleCurator, ok))
+	mux.HandleFunc("POST /admin", Require(RoleAdmin, ok))
+	return authenticator.Middleware(mux)
+}
+
+func doRequest(handler http.Handler, method string, path string, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMiddleware_RoleGuards(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestServer(t, key)
+
+	student := signRS256(t, "test-key", key, claimsWithRoles("student", "offline_access"))
+	instructor := signRS256(t, "test-key", key, claimsWithRoles("instructor"))
+	admin := signRS256(t, "test-key", key, claimsWithRoles("admin"))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "anonymous read", method: http.MethodGet, path: "/public", want: http.StatusOK},
+		{name: "anonymous write", method: http.MethodPost, path: "/write", want: http.StatusUnauthorized},
+		{name: "reader write", method: http.MethodPost, path: "/write", token: student, want: http.StatusForbidden},
+		{name: "curator write", method: http.MethodPost, path: "/write", token: instructor, want: http.StatusOK},
+		{name: "curator admin", method: http.MethodPost, path: "/admin", token: instructor, want: http.StatusForbidden},
+		{name: "admin write", method: http.MethodPost, path: "/write", token: admin, want: http.StatusOK},
+		{name: "admin admin", method: http.MethodPost, path: "/admin", token: admin, want: http.StatusOK},
+		{name: "garbage token on read", method: http.MethodGet, path: "/public", token: "not-a-jwt", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := doRequest(handler, tt.method, tt.path, tt.token); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_RejectsInvalidTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestServer(t, key)
+
+	expired := claimsWithRoles("admin")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := claimsWithRoles("admin")
+	wrongIssuer["iss"] = "https://evil.example.com/realms/Hydragen"
+	wrongAudience := claimsWithRoles("admin")
+	wrongAudience["azp"] = "some-other-client"
+
+	tests := map[string]string{
+		"expired":           signRS256(t, "test-key", key, expired),
+		"wrong issuer":      signRS256(t, "test-key", key, wrongIssuer),
+		"wrong audience":    signRS256(t, "test-key", key, wrongAudience),
+		"unknown kid":       signRS256(t, "rotated-key", key, claimsWithRoles("admin")),
+		"wrong signature":   signRS256(t, "test-key", otherKey, claimsWithRoles("admin")),
+		"alg not the key's": signPS256(t, "test-key", key, claimsWithRoles("admin")),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := doRequest(handler, http.MethodPost, "/admin", token); got != http.StatusUnauthorized {
+				t.Errorf("got status %d, want %d", got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestVerifier_ES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &Verifier{Keys: NewStaticKeySource(map[string]crypto.PublicKey{"ec": &key.PublicKey})}
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec"})
+	payload, _ := json.Marshal(claimsWithRoles("curator"))
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	claims, err := verifier.Verify(t.Context(), signed+"."+b64(signature))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if role := DefaultRoleMapping().Resolve(claims.RealmAccess.Roles); role != RoleCurator {
+		t.Errorf("got role %v, want curator", role)
+	}
+
+	// ES384 is only defined for P-384: a P-256 signature over a SHA-384 digest must not pass.
+	header, _ = json.Marshal(map[string]string{"alg": "ES384", "kid": "ec"})
+	signed = b64(header) + "." + b64(payload)
+	digest384 := sha512.Sum384([]byte(signed))
+	r, s, err = ecdsa.Sign(rand.Reader, key, digest384[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	if _, err := verifier.Verify(t.Context(), signed+"."+b64(signature)); err == nil {
+		t.Error("ES384 token verified with a P-256 key")
+	}
+}
+
+func TestParseRoleMapping(t *testing.T) {
+	mapping, err := ParseRoleMapping("Student:reader, lab-manager:curator,admin:admin")
+	if err != nil {
+		t.Fatalf("ParseRoleMapping: %v", err)
+	}
+	if got := mapping.Resolve([]string{"lab-manager", "student"}); got != RoleCurator {
+		t.Errorf("got %v, want curator", got)
+	}
+	if got := mapping.Resolve([]string{"offline_access"}); got != RoleNone {
+		t.Errorf("got %v, want none", got)
+	}
+	if _, err := ParseRoleMapping("student:superuser"); err == nil {
+		t.Error("expected unknown API role to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is an API permission level. Each role includes the permissions of the ones below it:
+// admin > curator > reader.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReader
+	RoleCurator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RoleCurator:
+		return "curator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+func ParseRole(value string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "reader":
+		return RoleReader, nil
+	case "curator":
+		return RoleCurator, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q (want reader, curator or admin)", value)
+}
+
+// RoleMapping maps Keycloak realm role names (case-insensitive) to API roles.
+type RoleMapping map[string]Role
+
+// DefaultRoleMapping follows the realm roles from the Auth & Permission Model doc, and also
+// accepts realm roles named after the API roles themselves.
+func DefaultRoleMapping() RoleMapping {
+	return RoleMapping{
+		"student":    RoleReader,
+		"instructor": RoleCurator,
+		"admin":      RoleAdmin,
+		"reader":     RoleReader,
+		"curator":    RoleCurator,
+	}
+}
+
+// ParseRoleMapping parses "realmRole:apiRole" pairs separated by commas,
+// e.g. "student:reader,instructor:curator,admin:admin".
+func ParseRoleMapping(value string) (RoleMapping, error) {
+	mapping := RoleMapping{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		realmRole, apiRole, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid role mapping %q (want realmRole:apiRole)", pair)
+		}
+		role, err := ParseRole(apiRole)
+		if err != nil {
+			return nil, err
+		}
+		mapping[strings.ToLower(strings.TrimSpace(realmRole))] = role
+	}
+	return mapping, nil
+}
+
+// Resolve returns the highest API role granted by any of the realm roles.
+// Unknown realm roles grant nothing.
+func (m RoleMapping) Resolve(realmRoles []string) Role {
+	best := RoleNone
+	for _, realmRole := range realmRoles {
+		if role, ok := m[strings.ToLower(realmRole)]; ok && role > best {
+			best = role
+		}
+	}
+	return best
+}
@@ -0,0 +1,82 @@
+package chemicalimageresolver_convert
+
+import (
+	"bytes"
+	"fmt"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Converter renders compound images as PNG or WebP at a requested size. It is stateless and
+// safe for concurrent use.
+type Converter struct{}
+
+func NewConverter() *Converter {
+	return &Converter{}
+}
+
+func (c *Converter) Convert(img *chemicalimageresolver.Image, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, error) {
+	isSVG := img.MimeType == "image/svg+xml"
+	switch variant.Format {
+	case "image/svg+xml":
+		// SVG is only ever served as the (sanitized) original; vectorizing rasters is out of scope.
+		if isSVG && variant.Size == 0 {
+			return img, nil
+		}
+		return nil, chemicalimageresolver.ErrUnsupportedVariant
+	case "image/png", "image/webp":
+	default:
+		return nil, chemicalimageresolver.ErrUnsupportedVariant
+	}
+
+	var rendered image.Image
+	if isSVG {
+		rgba, err := rasterizeSVG(img.Bytes, variant.Size)
+		if err != nil {
+			return nil, fmt.Errorf("rasterize svg: %w", err)
+		}
+		rendered = rgba
+	} else {
+		decoded, _, err := image.Decode(bytes.NewReader(img.Bytes))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", img.MimeType, err)
+		}
+		rendered = fit(decoded, variant.Size)
+	}
+
+	var out bytes.Buffer
+	if variant.Format == "image/webp" {
+		if err := encodeWebP(&out, rendered); err != nil {
+			return nil, err
+		}
+	} else {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&out, rendered); err != nil {
+			return nil, err
+		}
+	}
+	return &chemicalimageresolver.Image{Bytes: out.Bytes(), MimeType: variant.Format}, nil
+}
+
+// fit scales src to fit a size x size square, centered on a transparent background, so every
+// variant of a given size has the same dimensions. A zero size returns src unchanged.
+func fit(src image.Image, size int) image.Image {
+	if size == 0 {
+		return src
+	}
+	bounds := src.Bounds()
+	scale := min(float64(size)/float64(bounds.Dx()), float64(size)/float64(bounds.Dy()))
+	w := max(1, int(float64(bounds.Dx())*scale+0.5))
+	h := max(1, int(float64(bounds.Dy())*scale+0.5))
+	x0, y0 := (size-w)/2, (size-h)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, image.Rect(x0, y0, x0+w, y0+h), src, bounds, draw.Over, nil)
+	return dst
+}
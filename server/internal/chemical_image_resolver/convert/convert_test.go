@@ -0,0 +1,160 @@
+package chemicalimageresolver_convert
+
+import (
+	"bytes"
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		at   func(x, y int) color.NRGBA
+	}{
+		{name: "flat", at: func(x, y int) color.NRGBA { return color.NRGBA{R: 10, G: 20, B: 30, A: 255} }},
+		{name: "two colors", at: func(x, y int) color.NRGBA {
+			if x < y {
+				return color.NRGBA{A: 255}
+			}
+			return color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+		}},
+		{name: "gradient with alpha", at: func(x, y int) color.NRGBA {
+			return color.NRGBA{R: uint8(x * 7), G: uint8(y * 11), B: uint8(x * y), A: uint8(255 - x)}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, 37, 21))
+			for y := range 21 {
+				for x := range 37 {
+					src.SetNRGBA(x, y, tt.at(x, y))
+				}
+			}
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, src); err != nil {
+				t.Fatalf("encodeWebP: %v", err)
+			}
+			out, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("webp.Decode: %v", err)
+			}
+			for y := range 21 {
+				for x := range 37 {
+					if got := color.NRGBAModel.Convert(out.At(x, y)); got != src.At(x, y) {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, src.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100" viewBox="0 0 200 100">
+  <rect width="200" height="100" fill="#ffffff"/>
+  <g transform="translate(100,0)">
+    <path d="M 10 10 h 80 v 80 h -80 Z" style="fill:#ff0000;stroke:none"/>
+  </g>
+  <line x1="0" y1="50" x2="90" y2="50" stroke="black" stroke-width="4"/>
+  <text x="50" y="20" font-size="12" text-anchor="middle">OH</text>
+</svg>`
+
+func TestRasterizeSVG(t *testing.T) {
+	img, err := rasterizeSVG([]byte(testSVG), 128)
+	if err != nil {
+		t.Fatalf("rasterizeSVG: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 128, 128) {
+		t.Fatalf("got bounds %v", img.Bounds())
+	}
+	// The 200x100 viewBox is scaled by 0.64 and centered vertically (offset 32).
+	tests := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{name: "letterbox", x: 64, y: 10, want: color.RGBA{}},
+		{name: "background", x: 20, y: 45, want: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{name: "path fill", x: 96, y: 64, want: color.RGBA{R: 255, A: 255}},
+		{name: "stroke", x: 30, y: 64, want: color.RGBA{A: 255}},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("%s: pixel (%d, %d) = %v, want %v", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	subpaths, closed := parsePath("M0,0L10-5.5.5 1zm1 1 a5 5 0 011 1")
+	if len(subpaths) != 2 || !closed[0] || closed[1] {
+		t.Fatalf("got %d subpaths, closed %v", len(subpaths), closed)
+	}
+	want := []point{{0, 0}, {10, -5.5}, {0.5, 1}}
+	for i, p := range want {
+		if subpaths[0][i] != p {
+			t.Errorf("point %d = %v, want %v", i, subpaths[0][i], p)
+		}
+	}
+	// The relative moveto starts from the closed subpath's start point; the arc ends at (2, 2).
+	last := subpaths[1][len(subpaths[1])-1]
+	if subpaths[1][0] != (point{1, 1}) || last != (point{2, 2}) {
+		t.Errorf("arc subpath runs from %v to %v", subpaths[1][0], last)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var gifData bytes.Buffer
+	src := image.NewPaletted(image.Rect(0, 0, 300, 150), color.Palette{color.White, color.Black})
+	if err := gif.Encode(&gifData, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	gifImage := &chemicalimageresolver.Image{Bytes: gifData.Bytes(), MimeType: "image/gif"}
+	svgImage := &chemicalimageresolver.Image{Bytes: []byte(testSVG), MimeType: "image/svg+xml"}
+	converter := NewConverter()
+
+	tests := []struct {
+		name    string
+		img     *chemicalimageresolver.Image
+		variant chemicalimageresolver.Variant
+		size    image.Point
+	}{
+		{name: "gif to png", img: gifImage, variant: chemicalimageresolver.Variant{Format: "image/png", Size: 128}, size: image.Pt(128, 128)},
+		{name: "gif to webp, original size", img: gifImage, variant: chemicalimageresolver.Variant{Format: "image/webp"}, size: image.Pt(300, 150)},
+		{name: "svg to png", img: svgImage, variant: chemicalimageresolver.Variant{Format: "image/png", Size: 64}, size: image.Pt(64, 64)},
+		{name: "svg to webp, intrinsic size", img: svgImage, variant: chemicalimageresolver.Variant{Format: "image/webp"}, size: image.Pt(200, 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := converter.Convert(tt.img, tt.variant)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if out.MimeType != tt.variant.Format {
+				t.Fatalf("got MIME type %q", out.MimeType)
+			}
+			var config image.Config
+			if out.MimeType == "image/webp" {
+				config, err = webp.DecodeConfig(bytes.NewReader(out.Bytes))
+			} else {
+				config, err = png.DecodeConfig(bytes.NewReader(out.Bytes))
+			}
+			if err != nil {
+				t.Fatalf("decode output: %v", err)
+			}
+			if got := image.Pt(config.Width, config.Height); got != tt.size {
+				t.Errorf("got size %v, want %v", got, tt.size)
+			}
+		})
+	}
+
+	if _, err := converter.Convert(gifImage, chemicalimageresolver.Variant{Format: "image/svg+xml"}); !errors.Is(err, chemicalimageresolver.ErrUnsupportedVariant) {
+		t.Errorf("raster to SVG: got %v, want ErrUnsupportedVariant", err)
+	}
+}
@@ -0,0 +1,306 @@
+package chemicalimageresolver_convert
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// curveSegments is how many line segments approximate each Bézier curve or arc.
+const curveSegments = 16
+
+// pathScanner tokenizes SVG path data: single-letter commands and numbers, where numbers may run
+// together ("1-2.5.5") and arc flags may be written without separators ("a1 1 0 011 1").
+type pathScanner struct {
+	d   string
+	pos int
+}
+
+func (s *pathScanner) skipSeparators() {
+	for s.pos < len(s.d) && (s.d[s.pos] == ',' || s.d[s.pos] == ' ' || s.d[s.pos] == '\t' || s.d[s.pos] == '\n' || s.d[s.pos] == '\r') {
+		s.pos++
+	}
+}
+
+// command returns the next command letter, or 0 when the next token is a number or input ends.
+func (s *pathScanner) command() byte {
+	s.skipSeparators()
+	if s.pos < len(s.d) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", s.d[s.pos]) >= 0 {
+		c := s.d[s.pos]
+		s.pos++
+		return c
+	}
+	return 0
+}
+
+func (s *pathScanner) atNumber() bool {
+	s.skipSeparators()
+	return s.pos < len(s.d) && strings.IndexByte("+-.0123456789", s.d[s.pos]) >= 0
+}
+
+func (s *pathScanner) number() (float64, bool) {
+	s.skipSeparators()
+	match := numberPattern.FindStringIndex(s.d[s.pos:])
+	if match == nil || match[0] != 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s.d[s.pos:s.pos+match[1]], 64)
+	if err != nil {
+		return 0, false
+	}
+	s.pos += match[1]
+	return n, true
+}
+
+func (s *pathScanner) flag() (bool, bool) {
+	s.skipSeparators()
+	if s.pos < len(s.d) && (s.d[s.pos] == '0' || s.d[s.pos] == '1') {
+		s.pos++
+		return s.d[s.pos-1] == '1', true
+	}
+	return false, false
+}
+
+func (s *pathScanner) numbers(n int) ([]float64, bool) {
+	out := make([]float64, n)
+	for i := range out {
+		v, ok := s.number()
+		if !ok {
+			return nil, false
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// parsePath flattens path data into polylines, one per subpath, and reports which subpaths were
+// closed with Z. Parsing stops at the first error, keeping what was parsed so far, as SVG
+// renderers do.
+func parsePath(d string) ([][]point, []bool) {
+	var subpaths [][]point
+	var closed []bool
+	var current []point
+	var cur, start, lastControl point
+	var lastCmd byte
+
+	flush := func(isClosed bool) {
+		if len(current) > 1 {
+			subpaths = append(subpaths, current)
+			closed = append(closed, isClosed)
+		}
+		current = nil
+	}
+	lineTo := func(p point) {
+		if current == nil {
+			current = []point{cur}
+		}
+		current = append(current, p)
+		cur = p
+	}
+
+	s := &pathScanner{d: d}
+	var cmd byte
+	for {
+		if c := s.command(); c != 0 {
+			cmd = c
+		} else if cmd == 0 || !s.atNumber() {
+			break
+		}
+		relative := cmd >= 'a'
+		offset := func(p point) point {
+			if relative {
+				return point{cur.x + p.x, cur.y + p.y}
+			}
+			return p
+		}
+		upper := cmd &^ 0x20
+
+		switch upper {
+		case 'Z':
+			flush(true)
+			cur = start
+			cmd = 0 // Z takes no arguments; a number after it is an error
+		case 'M':
+			args, ok := s.numbers(2)
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			flush(false)
+			cur = offset(point{args[0], args[1]})
+			start = cur
+			// Subsequent pairs are implicit lineto commands.
+			if relative {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+		case 'L', 'T':
+			args, ok := s.numbers(2)
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			p := offset(point{args[0], args[1]})
+			if upper == 'T' {
+				control := cur
+				if lastCmd == 'Q' || lastCmd == 'T' {
+					control = point{2*cur.x - lastControl.x, 2*cur.y - lastControl.y}
+				}
+				quadTo(cur, control, p, lineTo)
+				lastControl = control
+			} else {
+				lineTo(p)
+			}
+		case 'H':
+			x, ok := s.number()
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			if relative {
+				x += cur.x
+			}
+			lineTo(point{x, cur.y})
+		case 'V':
+			y, ok := s.number()
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			if relative {
+				y += cur.y
+			}
+			lineTo(point{cur.x, y})
+		case 'C', 'S':
+			n := 6
+			if upper == 'S' {
+				n = 4
+			}
+			args, ok := s.numbers(n)
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			var c1 point
+			if upper == 'C' {
+				c1 = offset(point{args[0], args[1]})
+				args = args[2:]
+			} else if lastCmd == 'C' || lastCmd == 'S' {
+				c1 = point{2*cur.x - lastControl.x, 2*cur.y - lastControl.y}
+			} else {
+				c1 = cur
+			}
+			c2 := offset(point{args[0], args[1]})
+			p := offset(point{args[2], args[3]})
+			cubicTo(cur, c1, c2, p, lineTo)
+			lastControl = c2
+		case 'Q':
+			args, ok := s.numbers(4)
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			control := offset(point{args[0], args[1]})
+			p := offset(point{args[2], args[3]})
+			quadTo(cur, control, p, lineTo)
+			lastControl = control
+		case 'A':
+			radii, ok := s.numbers(3)
+			if !ok {
+				flush(false)
+				return subpaths, closed
+			}
+			large, ok1 := s.flag()
+			sweep, ok2 := s.flag()
+			end, ok3 := s.numbers(2)
+			if !ok1 || !ok2 || !ok3 {
+				flush(false)
+				return subpaths, closed
+			}
+			arcTo(cur, radii[0], radii[1], radii[2], large, sweep, offset(point{end[0], end[1]}), lineTo)
+		}
+		lastCmd = upper
+	}
+	flush(false)
+	return subpaths, closed
+}
+
+func quadTo(p0, p1, p2 point, lineTo func(point)) {
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		u := 1 - t
+		lineTo(point{
+			u*u*p0.x + 2*u*t*p1.x + t*t*p2.x,
+			u*u*p0.y + 2*u*t*p1.y + t*t*p2.y,
+		})
+	}
+}
+
+func cubicTo(p0, p1, p2, p3 point, lineTo func(point)) {
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		u := 1 - t
+		lineTo(point{
+			u*u*u*p0.x + 3*u*u*t*p1.x + 3*u*t*t*p2.x + t*t*t*p3.x,
+			u*u*u*p0.y + 3*u*u*t*p1.y + 3*u*t*t*p2.y + t*t*t*p3.y,
+		})
+	}
+}
+
+// arcTo converts an endpoint-parameterized elliptical arc to center form (SVG 1.1, appendix F.6)
+// and samples it.
+func arcTo(p0 point, rx, ry, rotation float64, large, sweep bool, p1 point, lineTo func(point)) {
+	if p0 == p1 {
+		return
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		lineTo(p1)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+
+	dx, dy := (p0.x-p1.x)/2, (p0.y-p1.y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+
+	// Scale up radii that are too small to span the endpoints.
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		coef = -coef
+	}
+	cx1 := coef * rx * y1 / ry
+	cy1 := -coef * ry * x1 / rx
+	cx := cos*cx1 - sin*cy1 + (p0.x+p1.x)/2
+	cy := sin*cx1 + cos*cy1 + (p0.y+p1.y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	for i := 1; i <= curveSegments; i++ {
+		if i == curveSegments {
+			lineTo(p1)
+			return
+		}
+		t := theta + delta*float64(i)/curveSegments
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		lineTo(point{cos*x - sin*y + cx, sin*x + cos*y + cy})
+	}
+}
@@ -0,0 +1,676 @@
+package chemicalimageresolver_convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// This file rasterizes the subset of SVG that structure depiction toolkits (RDKit for ChEMBL,
+// CDK, Cactus) emit: <rect>, <line>, <polyline>, <polygon>, <circle>, <ellipse>, <path> and
+// <text>, grouped with <g> and placed with transform and viewBox, painted with solid fill and
+// stroke colors from attributes or style="". Gradients, patterns, clipping, masks, <use> and CSS
+// classes are not supported; such content is skipped or painted with the fallback color.
+
+// maxIntrinsicSize caps rasterization at the SVG's own size when no size is requested.
+const maxIntrinsicSize = 1024
+
+type point struct{ x, y float64 }
+
+// affine maps (x, y) to (a*x + c*y + e, b*x + d*y + f).
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+func (m affine) apply(p point) point {
+	return point{m[0]*p.x + m[2]*p.y + m[4], m[1]*p.x + m[3]*p.y + m[5]}
+}
+
+// mul returns m∘n: n is applied first.
+func (m affine) mul(n affine) affine {
+	return affine{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// scale is the average linear scale factor, used for stroke widths and font sizes.
+func (m affine) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+type paint struct {
+	none bool
+	c    color.NRGBA
+}
+
+type svgState struct {
+	transform     affine
+	fill          paint
+	stroke        paint
+	strokeWidth   float64
+	lineCap       string
+	opacity       float64
+	fillOpacity   float64
+	strokeOpacity float64
+	fontSize      float64
+	textAnchor    string
+	hidden        bool
+}
+
+func defaultState(transform affine) svgState {
+	return svgState{
+		transform:     transform,
+		fill:          paint{c: color.NRGBA{A: 0xff}},
+		stroke:        paint{none: true},
+		strokeWidth:   1,
+		lineCap:       "butt",
+		opacity:       1,
+		fillOpacity:   1,
+		strokeOpacity: 1,
+		fontSize:      16,
+		textAnchor:    "start",
+	}
+}
+
+// skippedElements contain definitions or non-rendered content.
+var skippedElements = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "marker": true, "pattern": true, "symbol": true,
+	"linearGradient": true, "radialGradient": true, "title": true, "desc": true, "metadata": true, "style": true,
+}
+
+// rasterizeSVG renders data into a size x size canvas (fitted and centered, transparent background),
+// or at the SVG's own size when size is 0.
+func rasterizeSVG(data []byte, size int) (*image.RGBA, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root, err := findRoot(decoder)
+	if err != nil {
+		return nil, err
+	}
+	attrs := attrMap(root.Attr)
+
+	width, hasWidth := parseLength(attrs["width"])
+	height, hasHeight := parseLength(attrs["height"])
+	viewBox := parseNumbers(attrs["viewBox"])
+	var vx, vy, vw, vh float64
+	switch {
+	case len(viewBox) == 4 && viewBox[2] > 0 && viewBox[3] > 0:
+		vx, vy, vw, vh = viewBox[0], viewBox[1], viewBox[2], viewBox[3]
+	case hasWidth && hasHeight && width > 0 && height > 0:
+		vw, vh = width, height
+	default:
+		return nil, errors.New("svg: neither viewBox nor width/height is set")
+	}
+	if !hasWidth || !hasHeight || width <= 0 || height <= 0 {
+		width, height = vw, vh
+	}
+
+	canvasW, canvasH := size, size
+	if size == 0 {
+		fit := math.Min(1, maxIntrinsicSize/math.Max(width, height))
+		canvasW, canvasH = max(1, int(math.Round(width*fit))), max(1, int(math.Round(height*fit)))
+	}
+	scale := math.Min(float64(canvasW)/vw, float64(canvasH)/vh)
+	offsetX := (float64(canvasW)-vw*scale)/2 - vx*scale
+	offsetY := (float64(canvasH)-vh*scale)/2 - vy*scale
+
+	r := &svgRenderer{
+		dst:    image.NewRGBA(image.Rect(0, 0, canvasW, canvasH)),
+		raster: vector.NewRasterizer(canvasW, canvasH),
+	}
+	state := defaultState(affine{scale, 0, 0, scale, offsetX, offsetY})
+	state = r.applyAttrs(state, root.Attr)
+	if err := r.renderChildren(decoder, state); err != nil {
+		return nil, err
+	}
+	return r.dst, nil
+}
+
+func findRoot(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, fmt.Errorf("svg: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local != "svg" {
+				return xml.StartElement{}, fmt.Errorf("svg: root element is <%s>", start.Name.Local)
+			}
+			return start, nil
+		}
+	}
+}
+
+type svgRenderer struct {
+	dst    *image.RGBA
+	raster *vector.Rasterizer
+}
+
+// renderChildren renders elements until the end tag of the current element.
+func (r *svgRenderer) renderChildren(decoder *xml.Decoder, state svgState) error {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("svg: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			if skippedElements[t.Name.Local] {
+				if err := decoder.Skip(); err != nil {
+					return fmt.Errorf("svg: %w", err)
+				}
+				continue
+			}
+			child := r.applyAttrs(state, t.Attr)
+			if t.Name.Local == "text" {
+				text, err := collectText(decoder, t)
+				if err != nil {
+					return err
+				}
+				if !child.hidden {
+					r.drawText(child, text)
+				}
+				continue
+			}
+			if !child.hidden {
+				r.drawShape(t.Name.Local, attrMap(t.Attr), child)
+			}
+			if err := r.renderChildren(decoder, child); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func attrMap(attrs []xml.Attr) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		m[attr.Name.Local] = attr.Value
+	}
+	return m
+}
+
+// applyAttrs derives a child's state from presentation attributes, style="" (which wins) and transform.
+func (r *svgRenderer) applyAttrs(state svgState, attrs []xml.Attr) svgState {
+	props := map[string]string{}
+	var transform, style string
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "transform":
+			transform = attr.Value
+		case "style":
+			style = attr.Value
+		default:
+			props[attr.Name.Local] = attr.Value
+		}
+	}
+	// Declarations in style="" take precedence over presentation attributes.
+	for _, decl := range strings.Split(style, ";") {
+		if name, value, ok := strings.Cut(decl, ":"); ok {
+			props[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	if transform != "" {
+		state.transform = state.transform.mul(parseTransform(transform))
+	}
+	if value, ok := props["fill"]; ok {
+		state.fill = parsePaint(value, state.fill)
+	}
+	if value, ok := props["stroke"]; ok {
+		state.stroke = parsePaint(value, state.stroke)
+	}
+	if value, ok := parseLength(props["stroke-width"]); ok {
+		state.strokeWidth = value
+	}
+	if value := props["stroke-linecap"]; value != "" {
+		state.lineCap = value
+	}
+	if value, ok := parseLength(props["opacity"]); ok {
+		state.opacity *= value
+	}
+	if value, ok := parseLength(props["fill-opacity"]); ok {
+		state.fillOpacity = value
+	}
+	if value, ok := parseLength(props["stroke-opacity"]); ok {
+		state.strokeOpacity = value
+	}
+	if value, ok := parseLength(props["font-size"]); ok {
+		state.fontSize = value
+	}
+	if value := props["text-anchor"]; value != "" {
+		state.textAnchor = value
+	}
+	if props["display"] == "none" || props["visibility"] == "hidden" {
+		state.hidden = true
+	}
+	return state
+}
+
+func (r *svgRenderer) drawShape(name string, attrs map[string]string, state svgState) {
+	num := func(key string) float64 {
+		value, _ := parseLength(attrs[key])
+		return value
+	}
+	var subpaths [][]point
+	closed := true
+	switch name {
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return
+		}
+		subpaths = [][]point{{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}}
+	case "circle":
+		subpaths = [][]point{ellipsePoints(num("cx"), num("cy"), num("r"), num("r"))}
+	case "ellipse":
+		subpaths = [][]point{ellipsePoints(num("cx"), num("cy"), num("rx"), num("ry"))}
+	case "line":
+		subpaths = [][]point{{{num("x1"), num("y1")}, {num("x2"), num("y2")}}}
+		closed = false
+	case "polyline", "polygon":
+		numbers := parseNumbers(attrs["points"])
+		var pts []point
+		for i := 0; i+1 < len(numbers); i += 2 {
+			pts = append(pts, point{numbers[i], numbers[i+1]})
+		}
+		subpaths = [][]point{pts}
+		closed = name == "polygon"
+	case "path":
+		var closedFlags []bool
+		subpaths, closedFlags = parsePath(attrs["d"])
+		r.paint(subpaths, closedFlags, state)
+		return
+	default:
+		return
+	}
+	flags := make([]bool, len(subpaths))
+	for i := range flags {
+		flags[i] = closed
+	}
+	if name == "line" {
+		state.fill = paint{none: true}
+	}
+	r.paint(subpaths, flags, state)
+}
+
+func ellipsePoints(cx, cy, rx, ry float64) []point {
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+	const n = 64
+	pts := make([]point, n)
+	for i := range pts {
+		angle := 2 * math.Pi * float64(i) / n
+		pts[i] = point{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)}
+	}
+	return pts
+}
+
+func (r *svgRenderer) paint(subpaths [][]point, closed []bool, state svgState) {
+	device := make([][]point, 0, len(subpaths))
+	for _, sp := range subpaths {
+		if len(sp) == 0 {
+			continue
+		}
+		mapped := make([]point, len(sp))
+		for i, p := range sp {
+			mapped[i] = state.transform.apply(p)
+		}
+		device = append(device, mapped)
+	}
+	if len(device) == 0 {
+		return
+	}
+
+	if !state.fill.none {
+		r.raster.Reset(r.dst.Bounds().Dx(), r.dst.Bounds().Dy())
+		for _, sp := range device {
+			if len(sp) < 3 {
+				continue
+			}
+			r.raster.MoveTo(float32(sp[0].x), float32(sp[0].y))
+			for _, p := range sp[1:] {
+				r.raster.LineTo(float32(p.x), float32(p.y))
+			}
+			r.raster.ClosePath()
+		}
+		r.fillRaster(state.fill.c, state.opacity*state.fillOpacity)
+	}
+
+	if !state.stroke.none && state.strokeWidth > 0 {
+		halfWidth := state.strokeWidth * state.transform.scale() / 2
+		r.raster.Reset(r.dst.Bounds().Dx(), r.dst.Bounds().Dy())
+		for i, sp := range device {
+			r.strokePolyline(sp, closed[i], halfWidth, state.lineCap)
+		}
+		r.fillRaster(state.stroke.c, state.opacity*state.strokeOpacity)
+	}
+}
+
+// strokePolyline outlines each segment as a quad and rounds the joins, all with the same winding
+// so overlapping pieces add up instead of cancelling out.
+func (r *svgRenderer) strokePolyline(pts []point, closed bool, hw float64, lineCap string) {
+	if closed && len(pts) > 2 {
+		pts = append(pts, pts[0])
+	}
+	for i := 0; i+1 < len(pts); i++ {
+		p, q := pts[i], pts[i+1]
+		dx, dy := q.x-p.x, q.y-p.y
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+		ux, uy := dx/length, dy/length
+		if lineCap == "square" && !closed {
+			if i == 0 {
+				p = point{p.x - ux*hw, p.y - uy*hw}
+			}
+			if i == len(pts)-2 {
+				q = point{q.x + ux*hw, q.y + uy*hw}
+			}
+		}
+		nx, ny := -uy*hw, ux*hw
+		r.addPolygon([]point{{p.x + nx, p.y + ny}, {q.x + nx, q.y + ny}, {q.x - nx, q.y - ny}, {p.x - nx, p.y - ny}})
+	}
+	for i, p := range pts {
+		isEnd := !closed && (i == 0 || i == len(pts)-1)
+		if isEnd && lineCap != "round" {
+			continue
+		}
+		r.addPolygon(ellipsePoints(p.x, p.y, hw, hw))
+	}
+}
+
+func (r *svgRenderer) addPolygon(pts []point) {
+	if len(pts) < 3 {
+		return
+	}
+	area := 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%len(pts)]
+		area += p.x*q.y - q.x*p.y
+	}
+	if area < 0 {
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	r.raster.MoveTo(float32(pts[0].x), float32(pts[0].y))
+	for _, p := range pts[1:] {
+		r.raster.LineTo(float32(p.x), float32(p.y))
+	}
+	r.raster.ClosePath()
+}
+
+func (r *svgRenderer) fillRaster(c color.NRGBA, opacity float64) {
+	c.A = uint8(math.Round(float64(c.A) * math.Max(0, math.Min(1, opacity))))
+	if c.A == 0 {
+		return
+	}
+	r.raster.DrawOp = draw.Over
+	r.raster.Draw(r.dst, r.dst.Bounds(), image.NewUniform(c), image.Point{})
+}
+
+type svgText struct {
+	x, y    float64
+	hasXY   bool
+	content string
+}
+
+// collectText gathers the character data of a <text> element, including nested <tspan>s.
+// Position comes from the <text> element, or else from its first positioned <tspan>.
+func collectText(decoder *xml.Decoder, start xml.StartElement) (svgText, error) {
+	var text svgText
+	setXY := func(attrs map[string]string) {
+		x, okX := parseLength(firstNumber(attrs["x"]))
+		y, okY := parseLength(firstNumber(attrs["y"]))
+		if okX && okY && !text.hasXY {
+			text.x, text.y, text.hasXY = x, y, true
+		}
+	}
+	setXY(attrMap(start.Attr))
+	var content strings.Builder
+	depth := 1
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return text, fmt.Errorf("svg: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			setXY(attrMap(t.Attr))
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			content.Write(t)
+		}
+	}
+	text.content = strings.Join(strings.Fields(content.String()), " ")
+	return text, nil
+}
+
+var (
+	fontOnce sync.Once
+	goFont   *sfnt.Font
+	fontErr  error
+)
+
+func (r *svgRenderer) drawText(state svgState, text svgText) {
+	if text.content == "" || state.fill.none {
+		return
+	}
+	fontOnce.Do(func() { goFont, fontErr = opentype.Parse(goregular.TTF) })
+	if fontErr != nil {
+		return
+	}
+	size := state.fontSize * state.transform.scale()
+	if size < 1 {
+		return
+	}
+	face, err := opentype.NewFace(goFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return
+	}
+	defer face.Close()
+
+	origin := state.transform.apply(point{text.x, text.y})
+	advance := font.MeasureString(face, text.content)
+	switch state.textAnchor {
+	case "middle":
+		origin.x -= float64(advance) / 64 / 2
+	case "end":
+		origin.x -= float64(advance) / 64
+	}
+	c := state.fill.c
+	c.A = uint8(math.Round(float64(c.A) * math.Max(0, math.Min(1, state.opacity*state.fillOpacity))))
+	drawer := font.Drawer{
+		Dst:  r.dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(origin.x * 64), Y: fixed.Int26_6(origin.y * 64)},
+	}
+	drawer.DrawString(text.content)
+}
+
+var numberPattern = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+func parseNumbers(value string) []float64 {
+	var numbers []float64
+	for _, match := range numberPattern.FindAllString(value, -1) {
+		if n, err := strconv.ParseFloat(match, 64); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+func firstNumber(value string) string {
+	if match := numberPattern.FindString(value); match != "" {
+		return match
+	}
+	return ""
+}
+
+// parseLength parses plain numbers and px/pt lengths; percentages and font-relative units are not supported.
+func parseLength(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	factor := 1.0
+	switch {
+	case strings.HasSuffix(value, "px"):
+		value = strings.TrimSuffix(value, "px")
+	case strings.HasSuffix(value, "pt"):
+		value = strings.TrimSuffix(value, "pt")
+		factor = 4.0 / 3
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, false
+	}
+	return n * factor, true
+}
+
+var transformPattern = regexp.MustCompile(`(matrix|translate|scale|rotate|skewX|skewY)\s*\(([^)]*)\)`)
+
+func parseTransform(value string) affine {
+	m := identity
+	for _, match := range transformPattern.FindAllStringSubmatch(value, -1) {
+		args := parseNumbers(match[2])
+		arg := func(i int, fallback float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return fallback
+		}
+		var t affine
+		switch match[1] {
+		case "matrix":
+			if len(args) != 6 {
+				continue
+			}
+			t = affine{args[0], args[1], args[2], args[3], args[4], args[5]}
+		case "translate":
+			t = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			t = affine{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			angle := arg(0, 0) * math.Pi / 180
+			cos, sin := math.Cos(angle), math.Sin(angle)
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = affine{1, 0, 0, 1, cx, cy}.mul(affine{cos, sin, -sin, cos, 0, 0}).mul(affine{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		}
+		m = m.mul(t)
+	}
+	return m
+}
+
+var namedColors = map[string]color.NRGBA{
+	"black":   {0, 0, 0, 255},
+	"white":   {255, 255, 255, 255},
+	"red":     {255, 0, 0, 255},
+	"green":   {0, 128, 0, 255},
+	"lime":    {0, 255, 0, 255},
+	"blue":    {0, 0, 255, 255},
+	"yellow":  {255, 255, 0, 255},
+	"cyan":    {0, 255, 255, 255},
+	"magenta": {255, 0, 255, 255},
+	"orange":  {255, 165, 0, 255},
+	"purple":  {128, 0, 128, 255},
+	"brown":   {165, 42, 42, 255},
+	"gray":    {128, 128, 128, 255},
+	"grey":    {128, 128, 128, 255},
+	"silver":  {192, 192, 192, 255},
+	"navy":    {0, 0, 128, 255},
+	"teal":    {0, 128, 128, 255},
+	"maroon":  {128, 0, 0, 255},
+	"olive":   {128, 128, 0, 255},
+}
+
+// parsePaint parses a fill or stroke value. Paint servers (url(#...)) are unsupported and use
+// their fallback color if one is given, otherwise nothing is painted.
+func parsePaint(value string, inherited paint) paint {
+	value = strings.TrimSpace(strings.ToLower(value))
+	switch {
+	case value == "" || value == "inherit":
+		return inherited
+	case value == "none" || value == "transparent":
+		return paint{none: true}
+	case value == "currentcolor":
+		return paint{c: color.NRGBA{A: 255}}
+	case strings.HasPrefix(value, "url("):
+		if _, fallback, ok := strings.Cut(value, ")"); ok && strings.TrimSpace(fallback) != "" {
+			return parsePaint(fallback, paint{none: true})
+		}
+		return paint{none: true}
+	}
+	if c, ok := parseColor(value); ok {
+		return paint{c: c}
+	}
+	return inherited
+}
+
+func parseColor(value string) (color.NRGBA, bool) {
+	if c, ok := namedColors[value]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(value, "#") {
+		hex := value[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return color.NRGBA{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 255}, true
+	}
+	if strings.HasPrefix(value, "rgb(") {
+		numbers := parseNumbers(value)
+		if len(numbers) != 3 {
+			return color.NRGBA{}, false
+		}
+		channel := func(v float64) uint8 {
+			if strings.Contains(value, "%") {
+				v = v * 255 / 100
+			}
+			return uint8(math.Max(0, math.Min(255, math.Round(v))))
+		}
+		return color.NRGBA{channel(numbers[0]), channel(numbers[1]), channel(numbers[2]), 255}, true
+	}
+	return color.NRGBA{}, false
+}
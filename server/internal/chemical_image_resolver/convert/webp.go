@@ -0,0 +1,300 @@
+package chemicalimageresolver_convert
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// encodeWebP writes img as a lossless WebP (VP8L). The standard library and x/image only decode
+// WebP, and the server is built without cgo, so this is a small pure-Go encoder: the
+// subtract-green transform and one set of Huffman codes over literal pixels, without LZ77
+// back-references or a color cache. Structure depictions are mostly flat colors, which this
+// compresses well enough for thumbnails.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("webp: image dimensions out of range")
+	}
+
+	// Pixels as non-premultiplied ARGB after subtract-green: r -= g, b -= g (mod 256).
+	pixels := make([][4]uint8, 0, width*height)
+	var histograms [4][]int
+	histograms[0] = make([]int, 256+24) // green, plus the unused LZ77 length codes
+	for i := 1; i < 4; i++ {
+		histograms[i] = make([]int, 256)
+	}
+	hasAlpha := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			p := [4]uint8{c.G, c.R - c.G, c.B - c.G, c.A}
+			pixels = append(pixels, p)
+			for i, v := range p {
+				histograms[i][v]++
+			}
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	bw.write(1, 1) // a transform follows
+	bw.write(2, 2) // subtract-green
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // a single prefix code group for the whole image
+
+	var codes [4]*prefixCode
+	for i, histogram := range histograms {
+		codes[i] = newPrefixCode(histogram, 15)
+		codes[i].writeHeader(bw)
+	}
+	newPrefixCode(make([]int, 40), 15).writeHeader(bw) // distance codes, unused
+
+	for _, p := range pixels {
+		for i, v := range p {
+			codes[i].writeSymbol(bw, int(v))
+		}
+	}
+	data := bw.bytes()
+
+	padded := len(data) + len(data)%2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// bitWriter packs values least-significant bit first, as VP8L requires.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+func (bw *bitWriter) write(value uint32, n uint) {
+	bw.acc |= uint64(value) << bw.nBits
+	bw.nBits += n
+	for bw.nBits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nBits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nBits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nBits = 0, 0
+	}
+	return bw.buf
+}
+
+// prefixCode is a canonical Huffman code over an alphabet.
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+	// single is set when at most one symbol is used; such codes take zero bits per symbol.
+	single bool
+}
+
+func newPrefixCode(histogram []int, maxLength int) *prefixCode {
+	lengths := huffmanLengths(histogram, maxLength)
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths), single: used <= 1}
+}
+
+func (pc *prefixCode) writeSymbol(bw *bitWriter, symbol int) {
+	if pc.single {
+		return
+	}
+	length := pc.lengths[symbol]
+	bw.write(reverse(pc.codes[symbol], length), uint(length))
+}
+
+// codeLengthOrder is the order in which code-length code lengths are transmitted.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+func (pc *prefixCode) writeHeader(bw *bitWriter) {
+	if pc.single {
+		symbol := 0
+		for s, l := range pc.lengths {
+			if l > 0 {
+				symbol = s
+			}
+		}
+		bw.write(1, 1) // simple code
+		bw.write(0, 1) // one symbol
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+		return
+	}
+
+	bw.write(0, 1) // normal code
+	histogram := make([]int, 19)
+	for _, l := range pc.lengths {
+		histogram[l]++
+	}
+	lengthCode := newPrefixCode(histogram, 7)
+	// The code-length code needs declared lengths even when only one length value occurs.
+	if lengthCode.single {
+		for i, n := range histogram {
+			if n > 0 {
+				lengthCode.lengths[i] = 1
+			}
+		}
+	}
+	count := 4
+	for i, symbol := range codeLengthOrder {
+		if lengthCode.lengths[symbol] > 0 && i+1 > count {
+			count = i + 1
+		}
+	}
+	bw.write(uint32(count-4), 4)
+	for _, symbol := range codeLengthOrder[:count] {
+		bw.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // code lengths follow for every symbol of the alphabet
+	for _, l := range pc.lengths {
+		lengthCode.writeSymbol(bw, l)
+	}
+}
+
+func reverse(code uint32, length int) uint32 {
+	var out uint32
+	for range length {
+		out = out<<1 | code&1
+		code >>= 1
+	}
+	return out
+}
+
+// canonicalCodes assigns codes in order of (length, symbol), as the decoder does.
+func canonicalCodes(lengths []int) []uint32 {
+	var counts [16]uint32
+	for _, l := range lengths {
+		counts[l]++
+	}
+	counts[0] = 0
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + counts[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l > 0 {
+			codes[symbol] = next[l]
+			next[l]++
+		}
+	}
+	return codes
+}
+
+type huffmanNode struct {
+	weight      int
+	symbol      int
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].symbol < h[j].symbol
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths returns code lengths no longer than maxLength. When the optimal tree is too deep
+// the weights are flattened and the tree rebuilt, which converges quickly for small alphabets.
+func huffmanLengths(histogram []int, maxLength int) []int {
+	weights := append([]int(nil), histogram...)
+	for {
+		lengths := make([]int, len(weights))
+		h := &huffmanHeap{}
+		for symbol, weight := range weights {
+			if weight > 0 {
+				*h = append(*h, &huffmanNode{weight: weight, symbol: symbol})
+			}
+		}
+		switch h.Len() {
+		case 0:
+			return lengths
+		case 1:
+			lengths[(*h)[0].symbol] = 1
+			return lengths
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(*huffmanNode)
+			b := heap.Pop(h).(*huffmanNode)
+			heap.Push(h, &huffmanNode{weight: a.weight + b.weight, symbol: min(a.symbol, b.symbol), left: a, right: b})
+		}
+		maxSeen := 0
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.left == nil {
+				lengths[n.symbol] = depth
+				maxSeen = max(maxSeen, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk((*h)[0], 0)
+		if maxSeen <= maxLength {
+			return lengths
+		}
+		for i, weight := range weights {
+			if weight > 0 {
+				weights[i] = max(1, weight/2)
+			}
+		}
+	}
+}
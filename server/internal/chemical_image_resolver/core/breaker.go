@@ -0,0 +1,173 @@
+package chemicalimageresolver
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrProviderUnavailable marks failures of the provider itself (transport errors, timeouts,
+// 5xx and 429 answers) as opposed to failures for one compound. Only these feed the circuit
+// breaker. The compound still goes on cooldown, but under the short transient or rate_limited
+// policy, and ResetProvider clears those cooldowns once the outage is over.
+var ErrProviderUnavailable = errors.New("provider unavailable")
+
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen skips the provider for all compounds.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probe requests through to test whether the provider recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type BreakerConfig struct {
+	// Window is how far back outcomes count towards the error rate.
+	Window time.Duration
+	// MinRequests is the number of outcomes in the window before the breaker may open.
+	MinRequests int
+	// FailureRatio opens the breaker when this share of outcomes in the window are failures.
+	FailureRatio float64
+	// OpenFor is how long the breaker stays open before probing.
+	OpenFor time.Duration
+	// Probes is how many requests may be in flight while half-open.
+	Probes int
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:       time.Minute,
+		MinRequests:  5,
+		FailureRatio: 0.5,
+		OpenFor:      30 * time.Second,
+		Probes:       1,
+	}
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is reported for calls that ended without saying anything about the
+	// provider's health, e.g. cancelled race losers; it only releases a half-open probe slot.
+	outcomeIgnored
+)
+
+type breakerEvent struct {
+	at     time.Time
+	failed bool
+}
+
+// circuitBreaker tracks one provider. Every allow() that returns true must be followed by exactly
+// one report().
+type circuitBreaker struct {
+	provider ProviderType
+	config   BreakerConfig
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	events   []breakerEvent
+	openedAt time.Time
+	probes   int
+}
+
+func newCircuitBreaker(provider ProviderType, config BreakerConfig) *circuitBreaker {
+	return &circuitBreaker{provider: provider, config: config, now: time.Now}
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenFor {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.config.Probes {
+			return false
+		}
+		b.probes++
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) report(o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.state == BreakerHalfOpen {
+		b.probes = max(0, b.probes-1)
+		switch o {
+		case outcomeSuccess:
+			b.events = nil
+			b.transition(BreakerClosed)
+		case outcomeFailure:
+			b.openedAt = now
+			b.transition(BreakerOpen)
+		}
+		return
+	}
+	if o == outcomeIgnored || b.state == BreakerOpen {
+		return
+	}
+
+	b.events = append(b.events, breakerEvent{at: now, failed: o == outcomeFailure})
+	cutoff := now.Add(-b.config.Window)
+	for len(b.events) > 0 && b.events[0].at.Before(cutoff) {
+		b.events = b.events[1:]
+	}
+	failures := 0
+	for _, e := range b.events {
+		if e.failed {
+			failures++
+		}
+	}
+	if len(b.events) >= b.config.MinRequests && float64(failures) >= b.config.FailureRatio*float64(len(b.events)) {
+		b.openedAt = now
+		b.events = nil
+		b.transition(BreakerOpen)
+	}
+}
+
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = nil
+	b.probes = 0
+	b.transition(BreakerClosed)
+}
+
+func (b *circuitBreaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) transition(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("[ChemicalImageResolver.CircuitBreaker] Provider circuit changed state", "providerType", b.provider, "from", b.state.String(), "to", state.String())
+	b.state = state
+}
@@ -0,0 +1,59 @@
+package chemicalimageresolver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("chembl", BreakerConfig{Window: time.Minute, MinRequests: 4, FailureRatio: 0.5, OpenFor: 30 * time.Second, Probes: 1})
+	b.now = func() time.Time { return now }
+
+	call := func(o outcome) {
+		t.Helper()
+		if !b.allow() {
+			t.Fatalf("request refused in state %v", b.current())
+		}
+		b.report(o)
+	}
+
+	// Old failures fall out of the window and do not count.
+	call(outcomeFailure)
+	call(outcomeFailure)
+	now = now.Add(2 * time.Minute)
+	call(outcomeSuccess)
+	call(outcomeSuccess)
+	call(outcomeFailure)
+	if b.current() != BreakerClosed {
+		t.Fatalf("opened at 1 of 3 failures in the window")
+	}
+	call(outcomeFailure)
+	if b.current() != BreakerOpen {
+		t.Fatalf("still %v at 2 of 4 failures", b.current())
+	}
+	if b.allow() {
+		t.Fatal("open breaker let a request through")
+	}
+
+	// After OpenFor a single probe is allowed; a cancelled probe frees the slot.
+	now = now.Add(31 * time.Second)
+	if !b.allow() || b.allow() {
+		t.Fatal("half-open breaker should allow exactly one probe")
+	}
+	b.report(outcomeIgnored)
+	if b.current() != BreakerHalfOpen {
+		t.Fatalf("ignored probe changed state to %v", b.current())
+	}
+
+	// A failed probe reopens, a successful one closes.
+	call(outcomeFailure)
+	if b.current() != BreakerOpen {
+		t.Fatalf("failed probe left state %v", b.current())
+	}
+	now = now.Add(31 * time.Second)
+	call(outcomeSuccess)
+	if b.current() != BreakerClosed {
+		t.Fatalf("successful probe left state %v", b.current())
+	}
+}
@@ -0,0 +1,27 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunEviction keeps cache within maxBytes, checking at start and then every interval until ctx is
+// done. It blocks; run it in its own goroutine.
+func RunEviction(ctx context.Context, cache ImageCache, maxBytes int64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		freed, err := cache.Evict(ctx, maxBytes)
+		if err != nil {
+			slog.Error("[ChemicalImageResolver.RunEviction] Eviction failed", "error", err)
+		} else if freed > 0 {
+			slog.Info("[ChemicalImageResolver.RunEviction] Evicted cached images", "freedBytes", freed, "maxBytes", maxBytes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+)
+
+// ImageInfo explains how a compound's image is resolved, for debugging wrong structures.
+type ImageInfo struct {
+	InchiKey string `json:"inchiKey"`
+	// Selected describes the cached image the image endpoint serves; nil when no provider has one
+	// cached, in which case the endpoint asks the Pending providers.
+	Selected *ImageMetadata `json:"selected"`
+	CacheHit bool           `json:"cacheHit"`
+	// Pending lists the providers the image endpoint would ask, in resolution order.
+	Pending []ProviderType `json:"pending"`
+	// Providers are listed in resolution order.
+	Providers []ProviderStatus `json:"providers"`
+}
+
+type ProviderStatus struct {
+	Provider ProviderType `json:"provider"`
+	// Cached describes this provider's cached image, if there is one.
+	Cached     *ImageMetadata `json:"cached"`
+	OnCooldown bool           `json:"onCooldown"`
+	Breaker    string         `json:"breaker"`
+}
+
+// Info reports which cached image the image endpoint would serve, and every provider's cache,
+// cooldown and circuit state. It only reads: no provider is asked, no cooldown is added and the
+// cache does not count the lookups as uses.
+func (r *Resolver) Info(ctx context.Context, inchiKey string) (*ImageInfo, error) {
+	// Unknown compounds are not found here either.
+	if _, err := r.metadata.Get(ctx, inchiKey); err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{InchiKey: inchiKey, Pending: []ProviderType{}, Providers: []ProviderStatus{}}
+
+	// Caches and cooldowns locate compounds by InChIKey only.
+	compound := domain.CompoundMetadata{InchiKey: inchiKey}
+	for _, providerType := range r.providerOrder {
+		status := ProviderStatus{Provider: providerType}
+		cached, found, err := r.cache.Stat(ctx, providerType, compound)
+		if err != nil {
+			slog.Info("[ChemicalImageResolver.Info] Failed to stat cached image", "providerType", providerType, "inchiKey", inchiKey, "error", err)
+		}
+		if found {
+			cached.Provider = providerType
+			status.Cached = cached
+			if info.Selected == nil {
+				info.Selected = cached
+				info.CacheHit = true
+			}
+		}
+		status.OnCooldown, err = r.cooldowns.OnCooldown(ctx, providerType, compound)
+		if err != nil {
+			slog.Error("[ChemicalImageResolver.Info] Error checking provider cooldown", "providerType", providerType, "inchiKey", inchiKey, "error", err)
+		}
+		if breaker := r.breakers[providerType]; breaker != nil {
+			status.Breaker = breaker.current().String()
+		}
+		info.Providers = append(info.Providers, status)
+	}
+	if info.Selected == nil {
+		info.Pending = append(info.Pending, r.pending(ctx, inchiKey)...)
+	}
+	return info, nil
+}
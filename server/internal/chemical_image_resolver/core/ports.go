@@ -2,8 +2,13 @@ package chemicalimageresolver
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"hydragen-v2/server/internal/domain"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ProviderType string
@@ -13,23 +18,183 @@ type MimeType string
 type Image struct {
 	Bytes    []byte
 	MimeType MimeType
+	// Provider is the provider the (original) image came from.
+	Provider ProviderType
+	// ModTime is when the image was fetched from its provider (for derived variants: when it was converted).
+	ModTime time.Time
+	// SourceURL is the provider URL the image was downloaded from, if known.
+	SourceURL string
+	// CacheHit is set by the Resolver when the image came from the cache rather than a provider.
+	CacheHit bool
+	// Sanitized is set once SVG content has been through svgsanitize, so cached copies are not
+	// cleaned again on every hit.
+	Sanitized bool
+}
+
+// ImageMetadata is stored next to each cached image.
+type ImageMetadata struct {
+	FetchedAt time.Time    `json:"fetchedAt"`
+	Provider  ProviderType `json:"provider"`
+	MimeType  MimeType     `json:"mimeType"`
+	SHA256    string       `json:"sha256"`
+	SourceURL string       `json:"sourceUrl,omitempty"`
+	Sanitized bool         `json:"sanitized,omitempty"`
+}
+
+func (img *Image) Metadata() ImageMetadata {
+	return ImageMetadata{
+		FetchedAt: img.ModTime,
+		Provider:  img.Provider,
+		MimeType:  img.MimeType,
+		SHA256:    img.SHA256(),
+		SourceURL: img.SourceURL,
+		Sanitized: img.Sanitized,
+	}
+}
+
+// SHA256 is the hex SHA-256 of the image content.
+func (img *Image) SHA256() string {
+	sum := sha256.Sum256(img.Bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// ETag is a strong entity tag derived from the image content.
+func (img *Image) ETag() string {
+	return `"` + img.SHA256()[:32] + `"`
 }
 
 var ErrNotFound = errors.New("Not Found")
 
+// ErrNoImage means no provider has an image for a known compound. Errors matching it are
+// *NoImageError values, which also match ErrNotFound.
+var ErrNoImage = errors.New("no image available")
+
+// NoImageError carries what a placeholder image can show instead.
+type NoImageError struct {
+	InchiKey string
+	Name     string
+	Formula  string
+	// Confirmed is set when every provider asked answered that it has no image. Otherwise some
+	// were unavailable or could not be asked, and a later request may well find one.
+	Confirmed bool
+	// Remembered is set when the negative cache answered without asking any provider.
+	Remembered bool
+}
+
+func (e *NoImageError) Error() string {
+	return ErrNoImage.Error() + " for " + e.InchiKey
+}
+
+func (e *NoImageError) Is(target error) bool {
+	return target == ErrNoImage || target == ErrNotFound
+}
+
+// ErrUnknownProvider is returned when a caller selects a provider that is not configured.
+var ErrUnknownProvider = errors.New("unknown image provider")
+
+// ErrCoolingDown is returned when the selected provider may not be asked for the compound yet,
+// because of a cooldown or an open circuit.
+var ErrCoolingDown = errors.New("provider is cooling down for this compound")
+
+// ErrUnsupportedVariant is returned for conversions that cannot be made, e.g. SVG from a raster original.
+var ErrUnsupportedVariant = errors.New("unsupported image variant")
+
+// Variant describes a derived rendition of a compound image. A zero Size keeps the original
+// dimensions; otherwise the image is fitted into a Size x Size square.
+type Variant struct {
+	Format MimeType
+	Size   int
+}
+
+// Key identifies the variant in caches, e.g. "png-128" or "webp".
+func (v Variant) Key() string {
+	name := strings.TrimPrefix(string(v.Format), "image/")
+	name = strings.TrimSuffix(name, "+xml")
+	if v.Size == 0 {
+		return name
+	}
+	return name + "-" + strconv.Itoa(v.Size)
+}
+
+// Matches reports whether img already is this variant, so no conversion is needed.
+func (v Variant) Matches(img *Image) bool {
+	return v.Size == 0 && v.Format == img.MimeType
+}
+
 type RequestCooldownStore interface {
 	OnCooldown(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (bool, error)
-	Add(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) error
+	// Add blocks the compound for this provider according to the cooldown policy for cause.
+	Add(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, cause *ProviderError) error
 	Remove(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) error
 }
 
+// Cooldown is one (provider, compound) row of the cooldown store.
+type Cooldown struct {
+	Provider      ProviderType `json:"provider"`
+	InchiKey      string       `json:"inchiKey"`
+	Reason        string       `json:"reason"`
+	LastRequested time.Time    `json:"lastRequested"`
+	// DurationSeconds is the current backoff; it doubles with every further failure.
+	DurationSeconds int64     `json:"durationSeconds"`
+	NextRequestAt   time.Time `json:"nextRequestAt"`
+	Active          bool      `json:"active"`
+}
+
+// CooldownAdminStore lets operators inspect and clear cooldowns.
+type CooldownAdminStore interface {
+	// List pages through cooldowns, newest first; an empty provider lists all providers.
+	List(ctx context.Context, provider ProviderType, page int, pageSize int) (items []Cooldown, total int, err error)
+	// ForCompound returns the compound's cooldowns across providers.
+	ForCompound(ctx context.Context, inchiKey string) ([]Cooldown, error)
+	// Clear deletes cooldowns matching the provider and/or compound; empty values match all,
+	// but at least one must be set.
+	Clear(ctx context.Context, provider ProviderType, inchiKey string) (cleared int64, err error)
+	// ResetProvider deletes the provider's cooldowns caused by outages (transient errors and
+	// rate limits), keeping definitive misses.
+	ResetProvider(ctx context.Context, provider ProviderType) (cleared int64, err error)
+}
+
 type CompoundMetadataStore interface {
 	Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error)
 }
 
 type ImageCache interface {
 	Fetch(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (img *Image, found bool, err error)
+	// Stat describes the provider's cached original without reading it, e.g. to check that it
+	// exists. It does not count as a use of the image.
+	Stat(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (meta *ImageMetadata, found bool, err error)
 	Save(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, img *Image, imgMimeType string) error
+	// FetchVariant and SaveVariant store derived renditions next to the provider's original.
+	FetchVariant(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, variant Variant) (img *Image, found bool, err error)
+	SaveVariant(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, variant Variant, img *Image) error
+	// Evict removes least recently used entries until the cache holds at most maxBytes and
+	// returns how many bytes it freed.
+	Evict(ctx context.Context, maxBytes int64) (freed int64, err error)
+}
+
+// ImageCacheToucher is implemented by caches that evict least recently used entries, so a tier in
+// front of them can report the uses it serves itself.
+type ImageCacheToucher interface {
+	// Touch marks the provider's image (and its variants) for the compound as just used.
+	Touch(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) error
+}
+
+// CacheStats is a snapshot of an in-process cache tier's counters.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// ImageCacheStatter is implemented by caches that count their hits and misses.
+type ImageCacheStatter interface {
+	Stats() CacheStats
+}
+
+type Converter interface {
+	Convert(img *Image, variant Variant) (*Image, error)
 }
 
 type ThirdPartyProvider interface {
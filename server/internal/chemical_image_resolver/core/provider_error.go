@@ -0,0 +1,122 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ProviderErrorKind int
+
+const (
+	// ProviderErrorNotFound is a definitive answer: the provider has no image for the compound.
+	ProviderErrorNotFound ProviderErrorKind = iota
+	// ProviderErrorRateLimited is a 429 answer, optionally with a Retry-After delay.
+	ProviderErrorRateLimited
+	// ProviderErrorTransient covers timeouts, DNS and connection failures and 5xx answers.
+	ProviderErrorTransient
+	// ProviderErrorInvalidResponse is an answer we could not use: unexpected status, oversized
+	// body or a payload that is not a (safe) image.
+	ProviderErrorInvalidResponse
+)
+
+// String is also the reason stored with cooldowns.
+func (k ProviderErrorKind) String() string {
+	switch k {
+	case ProviderErrorNotFound:
+		return "not_found"
+	case ProviderErrorRateLimited:
+		return "rate_limited"
+	case ProviderErrorTransient:
+		return "transient"
+	default:
+		return "invalid_response"
+	}
+}
+
+// ProviderError is a classified provider failure. Not-found errors match ErrNotFound; rate-limited
+// and transient errors match ErrProviderUnavailable.
+type ProviderError struct {
+	Provider ProviderType
+	Kind     ProviderErrorKind
+	// RetryAfter is the delay the provider asked for, if any.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", e.Provider, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProviderError) Is(target error) bool {
+	switch e.Kind {
+	case ProviderErrorNotFound:
+		return target == ErrNotFound
+	case ProviderErrorRateLimited, ProviderErrorTransient:
+		return target == ErrProviderUnavailable
+	}
+	return false
+}
+
+// AsProviderError classifies err for cooldown handling. Errors that are not *ProviderError values
+// are classified by the sentinels they wrap; anything unrecognised counts as an invalid response.
+// Timeouts are transient: a provider that does not answer within its attempt timeout is failing.
+// It returns nil for cancellation, which says nothing about the provider. Callers must check their
+// own context first, since running out of their own time is not the provider's fault either.
+func AsProviderError(provider ProviderType, err error) *ProviderError {
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr
+	}
+	kind := ProviderErrorInvalidResponse
+	switch {
+	case errors.Is(err, ErrNotFound):
+		kind = ProviderErrorNotFound
+	case errors.Is(err, ErrProviderUnavailable), errors.Is(err, context.DeadlineExceeded):
+		kind = ProviderErrorTransient
+	}
+	return &ProviderError{Provider: provider, Kind: kind, Err: err}
+}
+
+// CooldownPolicy is an exponential backoff: the first failure blocks the compound for Initial,
+// every further failure of the same kind doubles that, up to Max.
+type CooldownPolicy struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+type CooldownPolicies map[ProviderErrorKind]CooldownPolicy
+
+// DefaultCooldownPolicies backs off hard on definitive misses and retries soon after failures
+// that are likely to go away on their own.
+func DefaultCooldownPolicies() CooldownPolicies {
+	return CooldownPolicies{
+		ProviderErrorNotFound:        {Initial: time.Hour, Max: 7 * 24 * time.Hour},
+		ProviderErrorInvalidResponse: {Initial: time.Hour, Max: 24 * time.Hour},
+		ProviderErrorTransient:       {Initial: time.Minute, Max: time.Hour},
+		ProviderErrorRateLimited:     {Initial: time.Minute, Max: time.Hour},
+	}
+}
+
+// For returns the backoff for err. A Retry-After delay overrides the policy, so the compound is
+// retried exactly when the provider allows it.
+func (p CooldownPolicies) For(err *ProviderError) CooldownPolicy {
+	if err.Kind == ProviderErrorRateLimited && err.RetryAfter > 0 {
+		return CooldownPolicy{Initial: err.RetryAfter, Max: err.RetryAfter}
+	}
+	if policy, ok := p[err.Kind]; ok {
+		return policy
+	}
+	return DefaultCooldownPolicies()[err.Kind]
+}
@@ -2,7 +2,25 @@ package chemicalimageresolver
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/svgsanitize"
 	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Strategy selects how third-party providers are tried when no cached image exists.
+type Strategy int
+
+const (
+	// StrategySequential tries providers one after another in providerOrder.
+	StrategySequential Strategy = iota
+	// StrategyRace queries every eligible provider in parallel and cancels the losers.
+	StrategyRace
 )
 
 type Resolver struct {
@@ -11,56 +29,678 @@ type Resolver struct {
 	cache         ImageCache
 	providers     map[ProviderType]ThirdPartyProvider
 	providerOrder []ProviderType
+
+	strategy       Strategy
+	raceGrace      time.Duration
+	bookkeeping    time.Duration
+	resolveTimeout time.Duration
+
+	converter Converter
+
+	// revalidateAfter is the age after which cached images are refreshed in the background.
+	revalidateAfter time.Duration
+
+	breakerConfig BreakerConfig
+	breakers      map[ProviderType]*circuitBreaker
+
+	// negative remembers compounds no provider had an image for, so repeated requests skip the
+	// cooldown lookups and cache reads until negativeTTL has passed.
+	negativeTTL time.Duration
+	negativeMu  sync.Mutex
+	negative    map[string]negativeEntry
+
+	// inflight coalesces concurrent resolutions of the same InChIKey (and variant) into one upstream fetch.
+	inflight singleflight.Group
+	// revalidating does the same for background refreshes of stale images.
+	revalidating singleflight.Group
+}
+
+type Option func(*Resolver)
+
+// WithRace makes the resolver race providers. Once a provider succeeds, slower but more preferred
+// providers (earlier in providerOrder) get up to grace to also succeed before the winner is picked.
+func WithRace(grace time.Duration) Option {
+	return func(r *Resolver) {
+		r.strategy = StrategyRace
+		r.raceGrace = grace
+	}
+}
+
+// WithConverter enables Variant; without a converter only the original images can be served.
+func WithConverter(converter Converter) Option {
+	return func(r *Resolver) {
+		r.converter = converter
+	}
+}
+
+// WithRevalidation refreshes cached images older than ttl from their provider in the background,
+// while the stale copy is still served (stale-while-revalidate). A zero ttl keeps images forever.
+func WithRevalidation(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.revalidateAfter = ttl
+	}
+}
+
+// CacheStats returns the image cache's counters; ok is false when the cache does not keep any.
+func (r *Resolver) CacheStats() (stats CacheStats, ok bool) {
+	statter, ok := r.cache.(ImageCacheStatter)
+	if !ok {
+		return CacheStats{}, false
+	}
+	return statter.Stats(), true
+}
+
+// RevalidateAfter is the age after which cached images are refreshed; zero means never.
+func (r *Resolver) RevalidateAfter() time.Duration {
+	return r.revalidateAfter
+}
+
+// WithNegativeCache sets how long a compound every provider answered not found for is answered
+// with ErrNoImage before the providers are asked again. Zero disables negative caching.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.negativeTTL = ttl
+	}
+}
+
+// WithCircuitBreaker overrides DefaultBreakerConfig for the per-provider circuit breakers.
+func WithCircuitBreaker(config BreakerConfig) Option {
+	return func(r *Resolver) {
+		r.breakerConfig = config
+	}
+}
+
+func New(cooldowns RequestCooldownStore, metadata CompoundMetadataStore, cache ImageCache, providers map[ProviderType]ThirdPartyProvider, providerOrder []ProviderType, opts ...Option) *Resolver {
+	r := &Resolver{
+		cooldowns:     cooldowns,
+		metadata:      metadata,
+		cache:         cache,
+		providers:     providers,
+		providerOrder: providerOrder,
+		strategy:      StrategySequential,
+		bookkeeping:   10 * time.Second,
+		// resolveTimeout bounds a shared resolution, which outlives the request that started it.
+		resolveTimeout: 30 * time.Second,
+		negativeTTL:    10 * time.Minute,
+		negative:       map[string]negativeEntry{},
+		breakerConfig:  DefaultBreakerConfig(),
+		breakers:       map[ProviderType]*circuitBreaker{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	for providerType := range providers {
+		r.breakers[providerType] = newCircuitBreaker(providerType, r.breakerConfig)
+	}
+	return r
+}
+
+// BreakerStates reports the circuit breaker state of every provider.
+func (r *Resolver) BreakerStates() map[ProviderType]BreakerState {
+	states := make(map[ProviderType]BreakerState, len(r.breakers))
+	for providerType, breaker := range r.breakers {
+		states[providerType] = breaker.current()
+	}
+	return states
+}
+
+// ResetBreaker closes the provider's circuit, e.g. once an operator knows an outage is over.
+// It reports false for unknown providers.
+func (r *Resolver) ResetBreaker(providerType ProviderType) bool {
+	breaker := r.breakers[providerType]
+	if breaker == nil {
+		return false
+	}
+	breaker.reset()
+	return true
+}
+
+// ForgetMissing drops the negative cache entry for a compound, so the next request asks the
+// providers again. An empty inchiKey clears the whole negative cache.
+func (r *Resolver) ForgetMissing(inchiKey string) {
+	r.negativeMu.Lock()
+	defer r.negativeMu.Unlock()
+	if inchiKey == "" {
+		clear(r.negative)
+		return
+	}
+	delete(r.negative, inchiKey)
+}
+
+// Image returns the image for a compound, or a *NoImageError (matching ErrNoImage and ErrNotFound)
+// when no provider has one. Concurrent calls
+// for the same InChIKey share a single resolution and its result or error; each caller still stops
+// waiting when its own ctx is done.
+func (r *Resolver) Image(ctx context.Context, inchiKey string) (*Image, error) {
+	return r.shared(ctx, inchiKey, func(ctx context.Context) (*Image, error) {
+		return r.resolve(ctx, inchiKey)
+	})
+}
+
+// Variant returns the compound image converted to variant. Conversions are cached next to the
+// original, so each variant is rendered once.
+func (r *Resolver) Variant(ctx context.Context, inchiKey string, variant Variant) (*Image, error) {
+	original, err := r.Image(ctx, inchiKey)
+	if err != nil {
+		return nil, err
+	}
+	return r.VariantOf(ctx, inchiKey, original, variant)
+}
+
+// Convert renders img as variant without caching the result, e.g. for placeholders that are not
+// stored anywhere. It returns ErrUnsupportedVariant when no converter is configured.
+func (r *Resolver) Convert(img *Image, variant Variant) (*Image, error) {
+	if variant.Matches(img) {
+		return img, nil
+	}
+	if r.converter == nil {
+		return nil, ErrUnsupportedVariant
+	}
+	return r.converter.Convert(img, variant)
+}
+
+// VariantOf converts an original returned by Image or ProviderImage to variant.
+func (r *Resolver) VariantOf(ctx context.Context, inchiKey string, original *Image, variant Variant) (*Image, error) {
+	if variant.Matches(original) {
+		return original, nil
+	}
+	if r.converter == nil {
+		return nil, ErrUnsupportedVariant
+	}
+	return r.shared(ctx, inchiKey+"|"+string(original.Provider)+"|"+variant.Key(), func(ctx context.Context) (*Image, error) {
+		// Caches locate images by InChIKey only.
+		compound := domain.CompoundMetadata{InchiKey: inchiKey}
+		img, found, err := r.cache.FetchVariant(ctx, original.Provider, compound, variant)
+		// Variants converted before the original was last refreshed are rendered again.
+		if found && !img.ModTime.Before(original.ModTime) {
+			img.Provider = original.Provider
+			img.CacheHit = original.CacheHit
+			return img, nil
+		}
+		if err != nil {
+			slog.Info("[ChemicalImageResolver.Variant] Failed to fetch variant from cache", "inchiKey", inchiKey, "variant", variant.Key(), "error", err)
+		}
+
+		img, err = r.converter.Convert(original, variant)
+		if err != nil {
+			return nil, err
+		}
+		img.Provider = original.Provider
+		img.CacheHit = original.CacheHit
+		img.ModTime = time.Now()
+		if err := r.cache.SaveVariant(ctx, original.Provider, compound, variant, img); err != nil {
+			slog.Error("[ChemicalImageResolver.Variant] Failed to save variant to cache", "inchiKey", inchiKey, "variant", variant.Key(), "error", err)
+		}
+		return img, nil
+	})
+}
+
+// Selection asks for one provider's rendering instead of the first available in providerOrder,
+// e.g. to compare how providers depict stereochemistry.
+type Selection struct {
+	Provider ProviderType
+	// Force fetches from the provider even while the compound is on cooldown or its circuit is open.
+	Force bool
+}
+
+// ProviderImage returns the image of the selected provider, from the cache or fetched. It returns a
+// *NoImageError when the provider has no image, an error matching ErrCoolingDown when the provider
+// may not be asked yet, and ErrUnknownProvider for providers that are not configured.
+func (r *Resolver) ProviderImage(ctx context.Context, inchiKey string, selection Selection) (*Image, error) {
+	if _, ok := r.providers[selection.Provider]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, selection.Provider)
+	}
+	key := inchiKey + "|provider:" + string(selection.Provider)
+	if selection.Force {
+		key += "|force"
+	}
+	return r.shared(ctx, key, func(ctx context.Context) (*Image, error) {
+		return r.resolveFrom(ctx, inchiKey, selection)
+	})
+}
+
+func (r *Resolver) resolveFrom(ctx context.Context, inchiKey string, selection Selection) (*Image, error) {
+	compound_ptr, err := r.metadata.Get(ctx, inchiKey)
+	if err != nil {
+		slog.Error("[ChemicalImageResolver.ProviderImage] Failed to retrieve compound metadata", "inchiKey", inchiKey, "error", err)
+		return nil, err
+	}
+	compound := *compound_ptr
+	providerType := selection.Provider
+
+	if image, found := r.cached(ctx, providerType, compound); found {
+		return image, nil
+	}
+	if selection.Force {
+		slog.Info("[ChemicalImageResolver.ProviderImage] Forced fetch, ignoring cooldown and circuit breaker", "providerType", providerType, "inchiKey", inchiKey)
+	} else if !r.eligible(ctx, providerType, compound) {
+		return nil, fmt.Errorf("%s: %w", providerType, ErrCoolingDown)
+	}
+
+	img, err := r.fetch(ctx, providerType, compound)
+	if err != nil {
+		r.recordFailure(ctx, providerType, compound, err)
+		if errors.Is(err, ErrNotFound) {
+			return nil, &NoImageError{InchiKey: inchiKey, Name: compound.Name, Formula: compound.Formula, Confirmed: true}
+		}
+		return nil, err
+	}
+	r.recordSuccess(ctx, providerType, compound, img)
+	// The compound has an image now, whatever the other providers said before.
+	r.ForgetMissing(inchiKey)
+	return img, nil
 }
 
-func New(cooldowns RequestCooldownStore, metadata CompoundMetadataStore, cache ImageCache, providers map[ProviderType]ThirdPartyProvider, providerOrder []ProviderType) *Resolver {
-	return &Resolver{cooldowns: cooldowns, metadata: metadata, cache: cache, providers: providers, providerOrder: providerOrder}
+// shared runs fn once for all concurrent callers with the same key.
+func (r *Resolver) shared(ctx context.Context, key string, fn func(ctx context.Context) (*Image, error)) (*Image, error) {
+	ch := r.inflight.DoChan(key, func() (any, error) {
+		// Detached from the first caller, so its disconnect does not fail the other waiters.
+		sharedCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.resolveTimeout)
+		defer cancel()
+		return fn(sharedCtx)
+	})
+	select {
+	case res := <-ch:
+		if res.Shared {
+			slog.Debug("[ChemicalImageResolver.Image] Shared in-flight resolution", "key", key)
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*Image), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
-func (r *Resolver) Image(ctx context.Context, inchiKey string) (image *Image, ok bool) {
+func (r *Resolver) resolve(ctx context.Context, inchiKey string) (*Image, error) {
+	if noImage := r.knownMissing(inchiKey); noImage != nil {
+		return nil, noImage
+	}
 	compound_ptr, err := r.metadata.Get(ctx, inchiKey)
 	if err != nil {
 		slog.Error("[ChemicalImageResolver.Image] Failed to retrieve compound metadata", "inchiKey", inchiKey, "error", err)
-		return nil, false
+		return nil, err
 	}
 	compound := *compound_ptr
 
-	for _, providerType := range r.providerOrder {
-		image, found, err := r.cache.Fetch(ctx, providerType, compound)
-		if found {
-			return image, true
+	var image *Image
+	var ok, confirmed bool
+	if r.strategy == StrategyRace {
+		image, ok, confirmed = r.race(ctx, compound)
+	} else {
+		image, ok, confirmed = r.sequential(ctx, compound)
+	}
+	if !ok {
+		// Running out of time is not evidence that the image does not exist.
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		if err != nil {
-			slog.Info("[ChemicalImageResolver.Resolve] Failed to fetch image from cache", "providerType", providerType, "error", err)
+		noImage := &NoImageError{InchiKey: inchiKey, Name: compound.Name, Formula: compound.Formula}
+		// Outages, cooldowns and open circuits only mean no provider could tell; their own short
+		// backoffs decide when to ask again.
+		if confirmed {
+			noImage.Confirmed = true
+			r.rememberMissing(noImage)
 		}
+		return nil, noImage
+	}
+	return image, nil
+}
+
+type negativeEntry struct {
+	err   *NoImageError
+	until time.Time
+}
 
-		onCooldown, err := r.cooldowns.OnCooldown(ctx, providerType, compound)
-		if onCooldown {
-			slog.Info("[ChemicalImageResolver.Resolve] Provider on cooldown, skipping", "providerType", providerType, "inchiKey", compound.InchiKey)
+// maxNegativeEntries bounds the negative cache; expired entries are dropped once it is reached.
+const maxNegativeEntries = 10000
+
+func (r *Resolver) knownMissing(inchiKey string) *NoImageError {
+	r.negativeMu.Lock()
+	defer r.negativeMu.Unlock()
+	entry, ok := r.negative[inchiKey]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.until) {
+		delete(r.negative, inchiKey)
+		return nil
+	}
+	remembered := *entry.err
+	remembered.Remembered = true
+	return &remembered
+}
+
+func (r *Resolver) rememberMissing(noImage *NoImageError) {
+	if r.negativeTTL <= 0 {
+		return
+	}
+	r.negativeMu.Lock()
+	defer r.negativeMu.Unlock()
+	now := time.Now()
+	if len(r.negative) >= maxNegativeEntries {
+		for key, entry := range r.negative {
+			if now.After(entry.until) {
+				delete(r.negative, key)
+			}
+		}
+	}
+	if len(r.negative) < maxNegativeEntries {
+		r.negative[noImage.InchiKey] = negativeEntry{err: noImage, until: now.Add(r.negativeTTL)}
+	}
+}
+
+// sequential asks the providers in order until one has an image. Without one, confirmed reports
+// that every provider was asked and answered not found.
+func (r *Resolver) sequential(ctx context.Context, compound domain.CompoundMetadata) (img *Image, ok bool, confirmed bool) {
+	confirmed = true
+	asked := 0
+	for _, providerType := range r.providerOrder {
+		if image, found := r.cached(ctx, providerType, compound); found {
+			return image, true, false
+		}
+
+		if !r.eligible(ctx, providerType, compound) {
+			confirmed = confirmed && !r.configured(providerType)
 			continue
 		}
+		asked++
+
+		img, err := r.fetch(ctx, providerType, compound)
 		if err != nil {
-			slog.Error("[ChemicalImageResolver.Resolve] Error checking provider cooldown", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+			r.recordFailure(ctx, providerType, compound, err)
+			confirmed = confirmed && errors.Is(err, ErrNotFound)
 			continue
 		}
+		r.recordSuccess(ctx, providerType, compound, img)
+		return img, true, false
+	}
+	return nil, false, confirmed && asked > 0
+}
 
-		provider := r.providers[providerType]
-		img, err := provider.FetchImage(ctx, compound)
-		if err != nil {
-			slog.Info("[ChemicalImageResolver.Resolve] Error fetching image from provider", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
-			if addErr := r.cooldowns.Add(ctx, providerType, compound); addErr != nil {
-				slog.Error("[ChemicalImageResolver.Resolve] Failed to add cooldown after fetch error", "providerType", providerType, "inchiKey", compound.InchiKey, "error", addErr)
+type raceResult struct {
+	rank     int
+	provider ProviderType
+	img      *Image
+	err      error
+}
+
+// race serves the most preferred cached image if there is one. Otherwise it fetches from every
+// provider not on cooldown at once and returns the most preferred success: immediately when no
+// more preferred provider is still running, or after the grace window following the first success.
+// Providers still running when the winner is chosen are cancelled; cancellation is not counted as
+// a failure, and any late results are still cached / put on cooldown in the background. Without an
+// image, confirmed reports that every provider was asked and answered not found.
+func (r *Resolver) race(ctx context.Context, compound domain.CompoundMetadata) (img *Image, ok bool, confirmed bool) {
+	for _, providerType := range r.providerOrder {
+		if image, found := r.cached(ctx, providerType, compound); found {
+			return image, true, false
+		}
+	}
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	results := make(chan raceResult, len(r.providerOrder))
+	running := map[int]bool{}
+	confirmed = true
+	for rank, providerType := range r.providerOrder {
+		if !r.eligible(ctx, providerType, compound) {
+			confirmed = confirmed && !r.configured(providerType)
+			continue
+		}
+		running[rank] = true
+		go func() {
+			img, err := r.fetch(raceCtx, providerType, compound)
+			results <- raceResult{rank: rank, provider: providerType, img: img, err: err}
+		}()
+	}
+	if len(running) == 0 {
+		cancel()
+		return nil, false, false
+	}
+
+	var best *raceResult
+	var grace <-chan time.Time
+settle:
+	for len(running) > 0 {
+		select {
+		case res := <-results:
+			delete(running, res.rank)
+			if res.err != nil {
+				r.recordFailure(ctx, res.provider, compound, res.err)
+				confirmed = confirmed && errors.Is(res.err, ErrNotFound)
+				continue
+			}
+			r.recordSuccess(ctx, res.provider, compound, res.img)
+			if best == nil || res.rank < best.rank {
+				best = &res
+			}
+			if !anyRunningBefore(running, best.rank) {
+				break settle
 			}
+			if grace == nil {
+				timer := time.NewTimer(r.raceGrace)
+				defer timer.Stop()
+				grace = timer.C
+			}
+		case <-grace:
+			slog.Info("[ChemicalImageResolver.Race] Grace window elapsed, settling for less preferred provider", "providerType", best.provider, "inchiKey", compound.InchiKey)
+			break settle
+		case <-ctx.Done():
+			break settle
+		}
+	}
+
+	cancel()
+	if len(running) > 0 {
+		go r.drainRace(ctx, compound, results, len(running))
+	}
+	if best == nil {
+		return nil, false, confirmed && len(running) == 0
+	}
+	return best.img, true, false
+}
+
+func anyRunningBefore(running map[int]bool, rank int) bool {
+	for other := range running {
+		if other < rank {
+			return true
+		}
+	}
+	return false
+}
+
+// drainRace collects results from providers that were still running when the race settled.
+// Providers cancelled because another one won, or because the request ran out of time, are not
+// penalized; providers that failed on their own, e.g. by timing out, are.
+func (r *Resolver) drainRace(ctx context.Context, compound domain.CompoundMetadata, results <-chan raceResult, remaining int) {
+	bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.bookkeeping)
+	defer cancel()
+	for ; remaining > 0; remaining-- {
+		res := <-results
+		if res.err != nil {
+			if ctx.Err() != nil || errors.Is(res.err, context.Canceled) {
+				slog.Info("[ChemicalImageResolver.Race] Cancelled losing provider", "providerType", res.provider, "inchiKey", compound.InchiKey)
+				r.report(res.provider, outcomeIgnored)
+				continue
+			}
+			r.recordFailure(bgCtx, res.provider, compound, res.err)
 			continue
 		}
+		r.recordSuccess(bgCtx, res.provider, compound, res.img)
+	}
+}
 
-		if err := r.cooldowns.Remove(ctx, providerType, compound); err != nil {
-			slog.Error("[ChemicalImageResolver.Resolve] Failed to remove cooldown on success", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+func (r *Resolver) cached(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata) (*Image, bool) {
+	image, found, err := r.cache.Fetch(ctx, providerType, compound)
+	if err != nil {
+		slog.Info("[ChemicalImageResolver.Resolve] Failed to fetch image from cache", "providerType", providerType, "error", err)
+	}
+	if !found {
+		return nil, false
+	}
+	image.Provider = providerType
+	image.CacheHit = true
+	if image.MimeType == "image/svg+xml" && !image.Sanitized {
+		// Entries cached before sanitization existed are cleaned once and written back.
+		image, err = sanitize(image)
+		if err != nil {
+			slog.Error("[ChemicalImageResolver.Resolve] Cached image failed sanitization, ignoring it", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+			return nil, false
 		}
-		if err := r.cache.Save(ctx, providerType, compound, img, string(img.MimeType)); err != nil {
-			slog.Error("[ChemicalImageResolver.Resolve] Failed to save image to cache", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+		if err := r.cache.Save(ctx, providerType, compound, image, string(image.MimeType)); err != nil {
+			slog.Warn("[ChemicalImageResolver.Resolve] Failed to rewrite sanitized image to cache", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
 		}
-		return img, true
 	}
-	return nil, false
+	if r.revalidateAfter > 0 && time.Since(image.ModTime) > r.revalidateAfter {
+		r.revalidate(ctx, providerType, compound)
+	}
+	return image, true
+}
+
+// revalidate refetches a stale image from the provider it was cached from, in the background and at
+// most once at a time per image. On failure the stale copy stays in the cache, and the provider's
+// cooldown keeps later requests from retrying immediately.
+func (r *Resolver) revalidate(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata) {
+	if _, ok := r.providers[providerType]; !ok {
+		return
+	}
+	r.revalidating.DoChan(string(providerType)+"|"+compound.InchiKey, func() (any, error) {
+		bgCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.resolveTimeout)
+		defer cancel()
+		if !r.eligible(bgCtx, providerType, compound) {
+			return nil, nil
+		}
+		img, err := r.fetch(bgCtx, providerType, compound)
+		if err != nil {
+			slog.Info("[ChemicalImageResolver.Revalidate] Refresh failed, keeping stale image", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+			r.recordFailure(bgCtx, providerType, compound, err)
+			return nil, nil
+		}
+		r.recordSuccess(bgCtx, providerType, compound, img)
+		slog.Info("[ChemicalImageResolver.Revalidate] Refreshed stale image", "providerType", providerType, "inchiKey", compound.InchiKey)
+		return nil, nil
+	})
+}
+
+// fetch asks a provider for an image and sanitizes it; a payload that cannot be sanitized
+// counts as a provider failure.
+func (r *Resolver) fetch(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata) (*Image, error) {
+	img, err := r.providers[providerType].FetchImage(ctx, compound)
+	if err != nil {
+		return nil, err
+	}
+	img.Provider = providerType
+	if img.ModTime.IsZero() {
+		img.ModTime = time.Now()
+	}
+	return sanitize(img)
+}
+
+// sanitize strips active content from SVG, which is served from our own origin. Other formats pass through.
+func sanitize(img *Image) (*Image, error) {
+	if img.MimeType != "image/svg+xml" {
+		return img, nil
+	}
+	clean, err := svgsanitize.Sanitize(img.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	sanitized := *img
+	sanitized.Bytes = clean
+	sanitized.Sanitized = true
+	return &sanitized, nil
+}
+
+// pending lists the providers resolving the compound may ask: none when one of them has the image
+// cached or the compound is known to have no image, otherwise every provider not on cooldown and
+// without an open circuit. It changes no state, so the warmer can pace its requests before joining
+// a shared resolution.
+func (r *Resolver) pending(ctx context.Context, inchiKey string) []ProviderType {
+	if r.knownMissing(inchiKey) != nil {
+		return nil
+	}
+	// Caches and cooldowns locate compounds by InChIKey only.
+	compound := domain.CompoundMetadata{InchiKey: inchiKey}
+	var providers []ProviderType
+	for _, providerType := range r.providerOrder {
+		if _, found, _ := r.cache.Stat(ctx, providerType, compound); found {
+			return nil
+		}
+		if _, ok := r.providers[providerType]; !ok {
+			continue
+		}
+		if onCooldown, err := r.cooldowns.OnCooldown(ctx, providerType, compound); onCooldown || err != nil {
+			continue
+		}
+		if breaker := r.breakers[providerType]; breaker != nil && breaker.current() == BreakerOpen {
+			continue
+		}
+		providers = append(providers, providerType)
+	}
+	return providers
+}
+
+// configured reports whether the provider has a client. Providers without one can still have
+// images in the cache, but cannot be asked.
+func (r *Resolver) configured(providerType ProviderType) bool {
+	_, ok := r.providers[providerType]
+	return ok
+}
+
+func (r *Resolver) eligible(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata) bool {
+	if !r.configured(providerType) {
+		return false
+	}
+	onCooldown, err := r.cooldowns.OnCooldown(ctx, providerType, compound)
+	if onCooldown {
+		slog.Info("[ChemicalImageResolver.Resolve] Provider on cooldown, skipping", "providerType", providerType, "inchiKey", compound.InchiKey)
+		return false
+	}
+	if err != nil {
+		slog.Error("[ChemicalImageResolver.Resolve] Error checking provider cooldown", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+		return false
+	}
+	if breaker := r.breakers[providerType]; breaker != nil && !breaker.allow() {
+		slog.Info("[ChemicalImageResolver.Resolve] Provider circuit open, skipping", "providerType", providerType, "inchiKey", compound.InchiKey)
+		return false
+	}
+	return true
+}
+
+func (r *Resolver) report(providerType ProviderType, o outcome) {
+	if breaker := r.breakers[providerType]; breaker != nil {
+		breaker.report(o)
+	}
+}
+
+// recordFailure puts the compound on cooldown for this provider, with a backoff that depends on
+// the kind of failure. Provider outages, including attempt timeouts, also count towards the circuit
+// breaker. Requests that were cancelled or ran out of the caller's time are not recorded at all.
+func (r *Resolver) recordFailure(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata, err error) {
+	slog.Info("[ChemicalImageResolver.Resolve] Error fetching image from provider", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+	providerErr := AsProviderError(providerType, err)
+	if ctx.Err() != nil || providerErr == nil {
+		r.report(providerType, outcomeIgnored)
+		return
+	}
+	if errors.Is(providerErr, ErrProviderUnavailable) {
+		r.report(providerType, outcomeFailure)
+	} else {
+		// The provider answered; it just has nothing usable for this compound.
+		r.report(providerType, outcomeSuccess)
+	}
+	if addErr := r.cooldowns.Add(ctx, providerType, compound, providerErr); addErr != nil {
+		slog.Error("[ChemicalImageResolver.Resolve] Failed to add cooldown after fetch error", "providerType", providerType, "inchiKey", compound.InchiKey, "reason", providerErr.Kind.String(), "error", addErr)
+	}
+}
+
+func (r *Resolver) recordSuccess(ctx context.Context, providerType ProviderType, compound domain.CompoundMetadata, img *Image) {
+	r.report(providerType, outcomeSuccess)
+	if err := r.cooldowns.Remove(ctx, providerType, compound); err != nil {
+		slog.Error("[ChemicalImageResolver.Resolve] Failed to remove cooldown on success", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+	}
+	if err := r.cache.Save(ctx, providerType, compound, img, string(img.MimeType)); err != nil {
+		slog.Error("[ChemicalImageResolver.Resolve] Failed to save image to cache", "providerType", providerType, "inchiKey", compound.InchiKey, "error", err)
+	}
 }
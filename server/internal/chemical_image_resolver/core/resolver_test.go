@@ -0,0 +1,504 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testInchiKey = "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"
+
+type fakeMetadata struct{}
+
+func (fakeMetadata) Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error) {
+	return &domain.CompoundMetadata{InchiKey: inchiKey}, nil
+}
+
+type fakeCooldowns struct {
+	mu      sync.Mutex
+	added   map[ProviderType]int
+	removed map[ProviderType]int
+	reasons []ProviderErrorKind
+}
+
+func newFakeCooldowns() *fakeCooldowns {
+	return &fakeCooldowns{added: map[ProviderType]int{}, removed: map[ProviderType]int{}}
+}
+
+func (f *fakeCooldowns) OnCooldown(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeCooldowns) Add(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, cause *ProviderError) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added[provider]++
+	f.reasons = append(f.reasons, cause.Kind)
+	return nil
+}
+
+func (f *fakeCooldowns) Remove(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed[provider]++
+	return nil
+}
+
+func (f *fakeCooldowns) addedCount(provider ProviderType) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.added[provider]
+}
+
+type fakeCache struct {
+	mu    sync.Mutex
+	saved map[ProviderType]*Image
+}
+
+func (f *fakeCache) Fetch(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (*Image, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img, ok := f.saved[provider]
+	return img, ok, nil
+}
+
+func (f *fakeCache) Stat(ctx context.Context, provider ProviderType, c domain.CompoundMetadata) (*ImageMetadata, bool, error) {
+	img, ok, err := f.Fetch(ctx, provider, c)
+	if !ok {
+		return nil, false, err
+	}
+	meta := img.Metadata()
+	return &meta, true, nil
+}
+
+func (f *fakeCache) Save(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, img *Image, imgMimeType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved[provider] = img
+	return nil
+}
+
+func (f *fakeCache) FetchVariant(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, variant Variant) (*Image, bool, error) {
+	return nil, false, nil
+}
+
+func (f *fakeCache) SaveVariant(ctx context.Context, provider ProviderType, c domain.CompoundMetadata, variant Variant, img *Image) error {
+	return nil
+}
+
+func (f *fakeCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	return 0, nil
+}
+
+// fakeProvider answers after delay, or returns ctx.Err() if cancelled first.
+type fakeProvider struct {
+	delay time.Duration
+	err   error
+	body  string
+	// mimeType defaults to image/png, which the resolver passes through unsanitized.
+	mimeType MimeType
+}
+
+func (p fakeProvider) FetchImage(ctx context.Context, c domain.CompoundMetadata) (*Image, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	mimeType := p.mimeType
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	return &Image{Bytes: []byte(p.body), MimeType: mimeType}, nil
+}
+
+// countingProvider counts upstream fetches.
+type countingProvider struct {
+	fakeProvider
+	calls *atomic.Int32
+}
+
+func (p countingProvider) FetchImage(ctx context.Context, c domain.CompoundMetadata) (*Image, error) {
+	p.calls.Add(1)
+	return p.fakeProvider.FetchImage(ctx, c)
+}
+
+func newRaceResolver(grace time.Duration, providers map[ProviderType]ThirdPartyProvider, order ...ProviderType) (*Resolver, *fakeCooldowns, *fakeCache) {
+	cooldowns := newFakeCooldowns()
+	cache := &fakeCache{saved: map[ProviderType]*Image{}}
+	return New(cooldowns, fakeMetadata{}, cache, providers, order, WithRace(grace)), cooldowns, cache
+}
+
+func TestRace_FastestWinsAndLoserIsNotCooledDown(t *testing.T) {
+	resolver, cooldowns, _ := newRaceResolver(10*time.Millisecond, map[ProviderType]ThirdPartyProvider{
+		"slow": fakeProvider{delay: 5 * time.Second, body: "slow"},
+		"fast": fakeProvider{delay: time.Millisecond, body: "fast"},
+	}, "slow", "fast")
+
+	start := time.Now()
+	img, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil || string(img.Bytes) != "fast" {
+		t.Fatalf("got %v %v, want fast image", img, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("race waited %v for the slow provider", elapsed)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := cooldowns.addedCount("slow"); n != 0 {
+		t.Errorf("cancelled provider got %d cooldowns, want 0", n)
+	}
+}
+
+func TestRace_PrefersProviderOrderWithinGrace(t *testing.T) {
+	resolver, _, cache := newRaceResolver(500*time.Millisecond, map[ProviderType]ThirdPartyProvider{
+		"preferred": fakeProvider{delay: 30 * time.Millisecond, body: "preferred"},
+		"fallback":  fakeProvider{delay: time.Millisecond, body: "fallback"},
+	}, "preferred", "fallback")
+
+	img, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil || string(img.Bytes) != "preferred" {
+		t.Fatalf("got %v %v, want preferred image", img, err)
+	}
+	if _, ok := cache.saved["fallback"]; !ok {
+		t.Error("fallback success within the grace window was not cached")
+	}
+}
+
+func TestRace_FailuresAreCooledDown(t *testing.T) {
+	resolver, cooldowns, _ := newRaceResolver(10*time.Millisecond, map[ProviderType]ThirdPartyProvider{
+		"broken": fakeProvider{delay: time.Millisecond, err: ErrNotFound},
+		"ok":     fakeProvider{delay: 20 * time.Millisecond, body: "ok"},
+	}, "broken", "ok")
+
+	img, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil || string(img.Bytes) != "ok" {
+		t.Fatalf("got %v %v, want ok image", img, err)
+	}
+	if n := cooldowns.addedCount("broken"); n != 1 {
+		t.Errorf("failed provider got %d cooldowns, want 1", n)
+	}
+}
+
+func TestRace_CallerDeadlineIsNotRecordedAgainstProviders(t *testing.T) {
+	cooldowns := newFakeCooldowns()
+	resolver := New(cooldowns, fakeMetadata{}, &fakeCache{saved: map[ProviderType]*Image{}}, map[ProviderType]ThirdPartyProvider{
+		"slow":   fakeProvider{delay: 5 * time.Second, body: "slow"},
+		"slower": fakeProvider{delay: 10 * time.Second, body: "slower"},
+	}, []ProviderType{"slow", "slower"}, WithRace(10*time.Millisecond), WithCircuitBreaker(BreakerConfig{Window: time.Minute, MinRequests: 1, FailureRatio: 0.5, OpenFor: time.Hour, Probes: 1}))
+	resolver.resolveTimeout = 20 * time.Millisecond
+
+	if _, err := resolver.Image(t.Context(), testInchiKey); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	// Late results are drained in the background.
+	time.Sleep(50 * time.Millisecond)
+	for _, provider := range []ProviderType{"slow", "slower"} {
+		if n := cooldowns.addedCount(provider); n != 0 {
+			t.Errorf("%s: got %d cooldowns for the caller's timeout", provider, n)
+		}
+		if state := resolver.BreakerStates()[provider]; state != BreakerClosed {
+			t.Errorf("%s: got breaker state %v", provider, state)
+		}
+	}
+}
+
+func TestImage_CoalescesConcurrentRequests(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{name: "success"},
+		{name: "failure", err: ErrNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := &atomic.Int32{}
+			cooldowns := newFakeCooldowns()
+			cache := &fakeCache{saved: map[ProviderType]*Image{}}
+			resolver := New(cooldowns, fakeMetadata{}, cache, map[ProviderType]ThirdPartyProvider{
+				"chembl": countingProvider{fakeProvider{delay: 50 * time.Millisecond, err: tc.err, body: "svg"}, calls},
+			}, []ProviderType{"chembl"})
+
+			var wg sync.WaitGroup
+			errs := make([]error, 20)
+			for i := range errs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = resolver.Image(t.Context(), testInchiKey)
+				}()
+			}
+			wg.Wait()
+
+			if n := calls.Load(); n != 1 {
+				t.Errorf("got %d upstream fetches, want 1", n)
+			}
+			for _, err := range errs {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("got error %v, want %v", err, tc.err)
+				}
+			}
+		})
+	}
+}
+
+func TestImage_SanitizesSVGBeforeSaving(t *testing.T) {
+	cooldowns := newFakeCooldowns()
+	cache := &fakeCache{saved: map[ProviderType]*Image{}}
+	resolver := New(cooldowns, fakeMetadata{}, cache, map[ProviderType]ThirdPartyProvider{
+		"scripted": fakeProvider{mimeType: "image/svg+xml", body: `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script></svg>`},
+		"broken":   fakeProvider{mimeType: "image/svg+xml", body: `<html><body>oops</body></html>`},
+	}, []ProviderType{"broken", "scripted"})
+
+	img, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	for _, stored := range []*Image{img, cache.saved["scripted"]} {
+		if stored == nil || strings.Contains(string(stored.Bytes), "alert") {
+			t.Errorf("unsanitized image served or cached: %v", stored)
+		}
+	}
+	if cooldowns.addedCount("broken") != 1 {
+		t.Error("unsanitizable payload did not count as a provider failure")
+	}
+}
+
+func TestImage_SanitizesLegacyCachedSVGOnce(t *testing.T) {
+	cache := &fakeCache{saved: map[ProviderType]*Image{
+		"legacy": {MimeType: "image/svg+xml", ModTime: time.Now(), Bytes: []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)},
+	}}
+	resolver := New(newFakeCooldowns(), fakeMetadata{}, cache, map[ProviderType]ThirdPartyProvider{
+		"legacy": fakeProvider{err: errors.New("should not be asked")},
+	}, []ProviderType{"legacy"})
+
+	img, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	rewritten := cache.saved["legacy"]
+	if strings.Contains(string(img.Bytes), "alert") || strings.Contains(string(rewritten.Bytes), "alert") {
+		t.Fatal("legacy SVG served or kept unsanitized")
+	}
+	if !rewritten.Sanitized {
+		t.Fatal("sanitized SVG was not written back to the cache")
+	}
+
+	// The rewritten entry is served as stored, without another pass through the sanitizer.
+	again, err := resolver.Image(t.Context(), testInchiKey)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	if again != rewritten {
+		t.Error("sanitized cache entry was sanitized again")
+	}
+}
+
+func TestImage_RevalidatesStaleImagesInBackground(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		err     error
+		want    string
+		cooling int
+	}{
+		{name: "refresh succeeds", want: "fresh"},
+		{name: "refresh fails", err: errors.New("provider down"), want: "stale", cooling: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := &atomic.Int32{}
+			cooldowns := newFakeCooldowns()
+			cache := &fakeCache{saved: map[ProviderType]*Image{
+				"chembl": {Bytes: []byte("stale"), MimeType: "image/png", ModTime: time.Now().Add(-2 * time.Hour)},
+			}}
+			resolver := New(cooldowns, fakeMetadata{}, cache, map[ProviderType]ThirdPartyProvider{
+				"chembl": countingProvider{fakeProvider{delay: 20 * time.Millisecond, err: tc.err, body: "fresh"}, calls},
+			}, []ProviderType{"chembl"}, WithRevalidation(time.Hour))
+
+			// The stale copy is served right away, however often it is requested meanwhile.
+			for range 3 {
+				img, err := resolver.Image(t.Context(), testInchiKey)
+				if err != nil || string(img.Bytes) != "stale" {
+					t.Fatalf("got %v %v, want the stale image", img, err)
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if n := calls.Load(); n != 1 {
+				t.Errorf("provider called %d times, want 1", n)
+			}
+			img, _, _ := cache.Fetch(t.Context(), "chembl", domain.CompoundMetadata{})
+			if string(img.Bytes) != tc.want {
+				t.Errorf("cache holds %q, want %q", img.Bytes, tc.want)
+			}
+			if n := cooldowns.addedCount("chembl"); n != tc.cooling {
+				t.Errorf("got %d cooldowns, want %d", n, tc.cooling)
+			}
+		})
+	}
+}
+
+func TestImage_NegativeCache(t *testing.T) {
+	calls := &atomic.Int32{}
+	resolver := New(newFakeCooldowns(), fakeMetadata{}, &fakeCache{saved: map[ProviderType]*Image{}}, map[ProviderType]ThirdPartyProvider{
+		"chembl": countingProvider{fakeProvider{err: ErrNotFound}, calls},
+	}, []ProviderType{"chembl"}, WithNegativeCache(time.Hour))
+
+	for range 3 {
+		_, err := resolver.Image(t.Context(), testInchiKey)
+		var noImage *NoImageError
+		if !errors.As(err, &noImage) || noImage.InchiKey != testInchiKey || !errors.Is(err, ErrNoImage) || !errors.Is(err, ErrNotFound) || !noImage.Confirmed {
+			t.Fatalf("got %v, want a confirmed NoImageError", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("provider called %d times, want 1", n)
+	}
+}
+
+func TestImage_OutagesAreNotRememberedAsMissing(t *testing.T) {
+	for _, strategy := range []Option{WithRace(time.Millisecond), func(*Resolver) {}} {
+		calls := &atomic.Int32{}
+		resolver := New(newFakeCooldowns(), fakeMetadata{}, &fakeCache{saved: map[ProviderType]*Image{}}, map[ProviderType]ThirdPartyProvider{
+			"chembl": countingProvider{fakeProvider{err: &ProviderError{Provider: "chembl", Kind: ProviderErrorTransient}}, calls},
+		}, []ProviderType{"chembl"}, WithNegativeCache(time.Hour), strategy)
+
+		for range 2 {
+			_, err := resolver.Image(t.Context(), testInchiKey)
+			var noImage *NoImageError
+			if !errors.As(err, &noImage) || noImage.Confirmed || noImage.Remembered {
+				t.Fatalf("got %v, want an unconfirmed NoImageError", err)
+			}
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("provider called %d times, want 2", n)
+		}
+	}
+}
+
+func TestImage_OutagesTripBreakerWithShortCooldowns(t *testing.T) {
+	calls := &atomic.Int32{}
+	cooldowns := newFakeCooldowns()
+	resolver := New(cooldowns, fakeMetadata{}, &fakeCache{saved: map[ProviderType]*Image{}}, map[ProviderType]ThirdPartyProvider{
+		"chembl": countingProvider{fakeProvider{err: fmt.Errorf("chembl: %w: status 503", ErrProviderUnavailable)}, calls},
+	}, []ProviderType{"chembl"}, WithNegativeCache(0), WithCircuitBreaker(BreakerConfig{Window: time.Minute, MinRequests: 3, FailureRatio: 0.5, OpenFor: time.Hour, Probes: 1}))
+
+	for range 10 {
+		if _, err := resolver.Image(t.Context(), testInchiKey); !errors.Is(err, ErrNoImage) {
+			t.Fatalf("got %v, want ErrNoImage", err)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("provider called %d times, want 3 before the circuit opened", n)
+	}
+	for _, kind := range cooldowns.reasons {
+		if kind != ProviderErrorTransient {
+			t.Errorf("outage recorded a %v cooldown", kind)
+		}
+	}
+	if state := resolver.BreakerStates()["chembl"]; state != BreakerOpen {
+		t.Errorf("got breaker state %v", state)
+	}
+}
+
+// hungProvider never answers; like the third-party client, it gives up after its own attempt timeout.
+type hungProvider struct {
+	attemptTimeout time.Duration
+	calls          *atomic.Int32
+}
+
+func (p hungProvider) FetchImage(ctx context.Context, c domain.CompoundMetadata) (*Image, error) {
+	p.calls.Add(1)
+	attemptCtx, cancel := context.WithTimeout(ctx, p.attemptTimeout)
+	defer cancel()
+	<-attemptCtx.Done()
+	return nil, fmt.Errorf("chembl: %w", attemptCtx.Err())
+}
+
+func TestImage_AttemptTimeoutsTripBreaker(t *testing.T) {
+	calls := &atomic.Int32{}
+	cooldowns := newFakeCooldowns()
+	resolver := New(cooldowns, fakeMetadata{}, &fakeCache{saved: map[ProviderType]*Image{}}, map[ProviderType]ThirdPartyProvider{
+		"chembl": hungProvider{attemptTimeout: 5 * time.Millisecond, calls: calls},
+	}, []ProviderType{"chembl"}, WithNegativeCache(0), WithCircuitBreaker(BreakerConfig{Window: time.Minute, MinRequests: 3, FailureRatio: 0.5, OpenFor: time.Hour, Probes: 1}))
+
+	for range 5 {
+		if _, err := resolver.Image(t.Context(), testInchiKey); !errors.Is(err, ErrNoImage) {
+			t.Fatalf("got %v, want ErrNoImage", err)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("provider called %d times, want 3 before the circuit opened", n)
+	}
+	if n := cooldowns.addedCount("chembl"); n != 3 {
+		t.Errorf("got %d cooldowns, want 3", n)
+	}
+	for _, kind := range cooldowns.reasons {
+		if kind != ProviderErrorTransient {
+			t.Errorf("timeout recorded a %v cooldown", kind)
+		}
+	}
+	if state := resolver.BreakerStates()["chembl"]; state != BreakerOpen {
+		t.Errorf("got breaker state %v", state)
+	}
+}
+
+func TestCooldownPolicies_For(t *testing.T) {
+	policies := DefaultCooldownPolicies()
+	for _, tc := range []struct {
+		err  error
+		want CooldownPolicy
+	}{
+		{err: ErrNotFound, want: policies[ProviderErrorNotFound]},
+		{err: fmt.Errorf("chembl: %w", ErrProviderUnavailable), want: policies[ProviderErrorTransient]},
+		{err: fmt.Errorf("%w: %w", ErrProviderUnavailable, context.DeadlineExceeded), want: policies[ProviderErrorTransient]},
+		{err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), want: policies[ProviderErrorTransient]},
+		{err: errors.New("payload is not an image"), want: policies[ProviderErrorInvalidResponse]},
+		{err: &ProviderError{Kind: ProviderErrorRateLimited}, want: policies[ProviderErrorRateLimited]},
+		{err: &ProviderError{Kind: ProviderErrorRateLimited, RetryAfter: 90 * time.Second}, want: CooldownPolicy{Initial: 90 * time.Second, Max: 90 * time.Second}},
+	} {
+		if got := policies.For(AsProviderError("chembl", tc.err)); got != tc.want {
+			t.Errorf("%v: got %+v, want %+v", tc.err, got, tc.want)
+		}
+	}
+	if AsProviderError("chembl", fmt.Errorf("fetch: %w", context.Canceled)) != nil {
+		t.Error("cancellation was classified as a provider error")
+	}
+}
+
+func TestProviderImage(t *testing.T) {
+	chemblCalls, cactusCalls := &atomic.Int32{}, &atomic.Int32{}
+	cooldowns := &keyedCooldowns{fakeCooldowns: newFakeCooldowns(), cooling: map[string]bool{testInchiKey: true}}
+	resolver := New(cooldowns, fakeMetadata{}, &keyedCache{}, map[ProviderType]ThirdPartyProvider{
+		"chembl": countingProvider{fakeProvider{body: "chembl"}, chemblCalls},
+		"cactus": countingProvider{fakeProvider{err: ErrNotFound}, cactusCalls},
+	}, []ProviderType{"chembl", "cactus"})
+
+	if _, err := resolver.ProviderImage(t.Context(), testInchiKey, Selection{Provider: "pubchem"}); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("got %v, want ErrUnknownProvider", err)
+	}
+	if _, err := resolver.ProviderImage(t.Context(), testInchiKey, Selection{Provider: "chembl"}); !errors.Is(err, ErrCoolingDown) {
+		t.Errorf("got %v, want ErrCoolingDown", err)
+	}
+	img, err := resolver.ProviderImage(t.Context(), testInchiKey, Selection{Provider: "chembl", Force: true})
+	if err != nil || string(img.Bytes) != "chembl" || img.Provider != "chembl" {
+		t.Fatalf("forced fetch got %v %v", img, err)
+	}
+	// The forced fetch filled the cache, so the image is served despite the cooldown.
+	if img, err := resolver.ProviderImage(t.Context(), testInchiKey, Selection{Provider: "chembl"}); err != nil || !img.CacheHit {
+		t.Errorf("got %v %v, want the cached image", img, err)
+	}
+	if _, err := resolver.ProviderImage(t.Context(), testInchiKey, Selection{Provider: "cactus", Force: true}); !errors.Is(err, ErrNoImage) {
+		t.Errorf("got %v, want ErrNoImage", err)
+	}
+	if n, m := chemblCalls.Load(), cactusCalls.Load(); n != 1 || m != 1 {
+		t.Errorf("providers called %d and %d times, want once each", n, m)
+	}
+}
@@ -0,0 +1,207 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"errors"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/ratelimit"
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrWarmerRunning is returned when a prefetch run is started while another one is in progress.
+var ErrWarmerRunning = errors.New("image prefetch already running")
+
+type CompoundLister interface {
+	List(ctx context.Context, page int, pageSize int) ([]domain.CompoundMetadata, error)
+	Count(ctx context.Context) (int, error)
+}
+
+type WarmerConfig struct {
+	// BatchSize is how many compounds are read from the store at a time.
+	BatchSize int
+	// Concurrency bounds how many compounds are resolved at once.
+	Concurrency int
+	// ProviderLimit paces requests to each provider during a run. The warmer waits for it before
+	// resolving a compound, so live requests for the same compound never wait on it.
+	ProviderLimit ratelimit.Limit
+}
+
+func DefaultWarmerConfig() WarmerConfig {
+	return WarmerConfig{
+		BatchSize:     100,
+		Concurrency:   4,
+		ProviderLimit: ratelimit.PerMinute(60, 5),
+	}
+}
+
+// WarmProgress describes the current or last prefetch run.
+type WarmProgress struct {
+	Running    bool      `json:"running"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	// Total is the number of compounds when the run started.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	// Cached compounds already had an image; Fetched ones got one from a provider.
+	Cached  int `json:"cached"`
+	Fetched int `json:"fetched"`
+	// Failed compounds got no image although providers were asked; Skipped ones were not asked
+	// because every provider was on cooldown, its circuit was open or the compound is known to
+	// have no image.
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Warmer walks all compounds and resolves their images, so the cache is filled before users ask,
+// e.g. after a dataset reload.
+type Warmer struct {
+	resolver  *Resolver
+	compounds CompoundLister
+	config    WarmerConfig
+	limiter   *ratelimit.Limiter
+
+	mu       sync.Mutex
+	progress WarmProgress
+	cancel   context.CancelFunc
+}
+
+func NewWarmer(resolver *Resolver, compounds CompoundLister, config WarmerConfig) *Warmer {
+	return &Warmer{resolver: resolver, compounds: compounds, config: config, limiter: ratelimit.NewLimiter()}
+}
+
+func (w *Warmer) Progress() WarmProgress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress
+}
+
+// Start runs a prefetch in the background. It returns ErrWarmerRunning if one is in progress.
+func (w *Warmer) Start(ctx context.Context) error {
+	ctx, err := w.begin(context.WithoutCancel(ctx))
+	if err != nil {
+		return err
+	}
+	go w.run(ctx)
+	return nil
+}
+
+// Run prefetches all compounds and returns the final progress.
+func (w *Warmer) Run(ctx context.Context) (WarmProgress, error) {
+	ctx, err := w.begin(ctx)
+	if err != nil {
+		return WarmProgress{}, err
+	}
+	err = w.run(ctx)
+	return w.Progress(), err
+}
+
+// Stop cancels the running prefetch, if any.
+func (w *Warmer) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+func (w *Warmer) begin(ctx context.Context) (context.Context, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.progress.Running {
+		return nil, ErrWarmerRunning
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.progress = WarmProgress{Running: true, StartedAt: time.Now()}
+	return ctx, nil
+}
+
+func (w *Warmer) run(ctx context.Context) (err error) {
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.cancel()
+		w.cancel = nil
+		w.progress.Running = false
+		w.progress.FinishedAt = time.Now()
+		if err != nil {
+			w.progress.Error = err.Error()
+		}
+		slog.Info("[ChemicalImageResolver.Warmer] Prefetch finished", "progress", w.progress, "duration", w.progress.FinishedAt.Sub(w.progress.StartedAt))
+	}()
+
+	total, err := w.compounds.Count(ctx)
+	if err != nil {
+		slog.Error("[ChemicalImageResolver.Warmer] Failed to count compounds", "error", err)
+	}
+	w.update(func(p *WarmProgress) { p.Total = total })
+	slog.Info("[ChemicalImageResolver.Warmer] Prefetch started", "total", total, "concurrency", w.config.Concurrency)
+
+	batchSize := max(w.config.BatchSize, 1)
+	for page := 1; ; page++ {
+		batch, err := w.compounds.List(ctx, page, batchSize)
+		if err != nil {
+			return err
+		}
+		group := errgroup.Group{}
+		group.SetLimit(max(w.config.Concurrency, 1))
+		for _, compound := range batch {
+			group.Go(func() error {
+				w.warm(ctx, compound.InchiKey)
+				return nil
+			})
+		}
+		_ = group.Wait()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress := w.Progress()
+		slog.Info("[ChemicalImageResolver.Warmer] Prefetch progress", "processed", progress.Processed, "total", progress.Total,
+			"cached", progress.Cached, "fetched", progress.Fetched, "failed", progress.Failed, "skipped", progress.Skipped)
+		if len(batch) < batchSize {
+			return nil
+		}
+	}
+}
+
+// warm resolves one compound. Every provider the resolution may ask is paced beforehand, outside
+// the resolution live requests share; in sequential mode this also charges the providers after the
+// first success, which costs little as all of them are paced alike.
+func (w *Warmer) warm(ctx context.Context, inchiKey string) {
+	pending := w.resolver.pending(ctx, inchiKey)
+	for _, providerType := range pending {
+		if err := w.limiter.Wait(ctx, "provider:"+string(providerType), w.config.ProviderLimit); err != nil {
+			return
+		}
+	}
+	img, err := w.resolver.Image(ctx, inchiKey)
+	if ctx.Err() != nil {
+		return
+	}
+	w.update(func(p *WarmProgress) {
+		p.Processed++
+		switch {
+		case err == nil && !img.CacheHit:
+			p.Fetched++
+		case err == nil:
+			p.Cached++
+		case errors.Is(err, ErrNoImage) && len(pending) == 0:
+			p.Skipped++
+		default:
+			p.Failed++
+		}
+	})
+	if err != nil && !errors.Is(err, ErrNoImage) {
+		slog.Info("[ChemicalImageResolver.Warmer] Failed to resolve image", "inchiKey", inchiKey, "error", err)
+	}
+}
+
+func (w *Warmer) update(fn func(p *WarmProgress)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn(&w.progress)
+}
@@ -0,0 +1,123 @@
+package chemicalimageresolver
+
+import (
+	"context"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/ratelimit"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLister []domain.CompoundMetadata
+
+func (l fakeLister) List(ctx context.Context, page int, pageSize int) ([]domain.CompoundMetadata, error) {
+	start := min((page-1)*pageSize, len(l))
+	return l[start:min(start+pageSize, len(l))], nil
+}
+
+func (l fakeLister) Count(ctx context.Context) (int, error) {
+	return len(l), nil
+}
+
+// keyedCache stores images per provider and compound, unlike fakeCache.
+type keyedCache struct {
+	fakeCache
+	images sync.Map
+}
+
+func (c *keyedCache) Fetch(ctx context.Context, provider ProviderType, compound domain.CompoundMetadata) (*Image, bool, error) {
+	img, ok := c.images.Load(string(provider) + "/" + compound.InchiKey)
+	if !ok {
+		return nil, false, nil
+	}
+	return img.(*Image), true, nil
+}
+
+func (c *keyedCache) Stat(ctx context.Context, provider ProviderType, compound domain.CompoundMetadata) (*ImageMetadata, bool, error) {
+	img, ok, err := c.Fetch(ctx, provider, compound)
+	if !ok {
+		return nil, false, err
+	}
+	meta := img.Metadata()
+	return &meta, true, nil
+}
+
+func (c *keyedCache) Save(ctx context.Context, provider ProviderType, compound domain.CompoundMetadata, img *Image, imgMimeType string) error {
+	c.images.Store(string(provider)+"/"+compound.InchiKey, img)
+	return nil
+}
+
+// keyedCooldowns puts the listed compounds on cooldown.
+type keyedCooldowns struct {
+	*fakeCooldowns
+	cooling map[string]bool
+}
+
+func (c *keyedCooldowns) OnCooldown(ctx context.Context, provider ProviderType, compound domain.CompoundMetadata) (bool, error) {
+	return c.cooling[compound.InchiKey], nil
+}
+
+// keyedProvider only has images for the listed compounds.
+type keyedProvider map[string]bool
+
+func (p keyedProvider) FetchImage(ctx context.Context, compound domain.CompoundMetadata) (*Image, error) {
+	if !p[compound.InchiKey] {
+		return nil, ErrNotFound
+	}
+	return &Image{Bytes: []byte(compound.InchiKey), MimeType: "image/png"}, nil
+}
+
+func TestWarmer_Run(t *testing.T) {
+	cache := &keyedCache{}
+	cache.images.Store("chembl/CACHED", &Image{Bytes: []byte("cached"), MimeType: "image/png"})
+	cooldowns := &keyedCooldowns{fakeCooldowns: newFakeCooldowns(), cooling: map[string]bool{"COOLING": true}}
+	resolver := New(cooldowns, fakeMetadata{}, cache, map[ProviderType]ThirdPartyProvider{
+		"chembl": keyedProvider{"FETCH-1": true, "FETCH-2": true},
+	}, []ProviderType{"chembl"})
+	compounds := fakeLister{{InchiKey: "CACHED"}, {InchiKey: "FETCH-1"}, {InchiKey: "MISSING"}, {InchiKey: "COOLING"}, {InchiKey: "FETCH-2"}}
+
+	warmer := NewWarmer(resolver, compounds, WarmerConfig{BatchSize: 2, Concurrency: 2, ProviderLimit: ratelimit.PerMinute(6000, 100)})
+	progress, err := warmer.Run(t.Context())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := WarmProgress{Total: 5, Processed: 5, Cached: 1, Fetched: 2, Failed: 1, Skipped: 1}
+	progress.StartedAt, progress.FinishedAt = want.StartedAt, want.FinishedAt
+	if progress != want {
+		t.Errorf("got %+v, want %+v", progress, want)
+	}
+	if _, ok := cache.images.Load("chembl/FETCH-2"); !ok {
+		t.Error("fetched image was not cached")
+	}
+
+	// A second run finds everything fetched before in the cache.
+	progress, _ = warmer.Run(t.Context())
+	if progress.Cached != 3 || progress.Fetched != 0 {
+		t.Errorf("second run got %+v", progress)
+	}
+}
+
+func TestWarmer_LiveRequestsDoNotWaitForPacing(t *testing.T) {
+	resolver := New(newFakeCooldowns(), fakeMetadata{}, &keyedCache{}, map[ProviderType]ThirdPartyProvider{
+		"chembl": keyedProvider{"FIRST": true, "SECOND": true},
+	}, []ProviderType{"chembl"})
+	compounds := fakeLister{{InchiKey: "FIRST"}, {InchiKey: "SECOND"}}
+	// One request per minute: the warmer fetches FIRST, then waits for the budget to ask about SECOND.
+	warmer := NewWarmer(resolver, compounds, WarmerConfig{BatchSize: 1, Concurrency: 1, ProviderLimit: ratelimit.PerMinute(1, 1)})
+	if err := warmer.Start(t.Context()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer warmer.Stop()
+	for warmer.Progress().Processed < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	img, err := resolver.Image(ctx, "SECOND")
+	if err != nil || img.CacheHit {
+		t.Fatalf("got %+v, %v; want a fetched image without waiting for the prefetch budget", img, err)
+	}
+}
@@ -2,20 +2,24 @@ package chemicalimageresolver_disk
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
 	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/inchikey"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 const assetDir = "assets"
 
 func getChemicalAssetDir(compound domain.CompoundMetadata, providerType chemicalimageresolver.ProviderType) (string, error) {
-	inchiKey := compound.InchiKey
-	if len(inchiKey) < 4 {
-		return "", fmt.Errorf("InchiKey too short: got length %d, want at least 4", len(inchiKey))
+	inchiKey, err := inchikey.NormalizeFull(compound.InchiKey)
+	if err != nil {
+		return "", err
 	}
 	// Directory structure:
 	//   {assetDir}/inchikey/{first2}/{next2}/{fullInchiKey}/{providerType}/
@@ -32,7 +36,8 @@ func (d *DiskImageCache) Fetch(ctx context.Context, provider chemicalimageresolv
 		return nil, false, err
 	}
 
-	files, err := filepath.Glob(filepath.Join(imageDir, "*"))
+	// Only the original ("image.<ext>"); derived variants live next to it.
+	files, err := filepath.Glob(filepath.Join(imageDir, "image.*"))
 	if err != nil {
 		slog.Error("[DiskImageCache.Fetch]: Error reading directory", "dir", imageDir, "error", err)
 		return nil, false, err
@@ -46,6 +51,7 @@ func (d *DiskImageCache) Fetch(ctx context.Context, provider chemicalimageresolv
 
 	var (
 		selectedFile string
+		selectedInfo os.FileInfo
 		latestMod    int64
 		fileFound    bool
 		readable     []string
@@ -65,6 +71,7 @@ func (d *DiskImageCache) Fetch(ctx context.Context, provider chemicalimageresolv
 		modTime := info.ModTime().UnixNano()
 		if !fileFound || modTime > latestMod {
 			selectedFile = file
+			selectedInfo = info
 			latestMod = modTime
 			fileFound = true
 		}
@@ -100,7 +107,108 @@ func (d *DiskImageCache) Fetch(ctx context.Context, provider chemicalimageresolv
 		return nil, false, err
 	}
 	mimeType := ExtensionToMimeType(selectedFile)
-	return &chemicalimageresolver.Image{Bytes: data, MimeType: chemicalimageresolver.MimeType(mimeType)}, true, nil
+	img = &chemicalimageresolver.Image{
+		Bytes:    data,
+		MimeType: chemicalimageresolver.MimeType(mimeType),
+		ModTime:  selectedInfo.ModTime(),
+	}
+	// Images cached before metadata was recorded only have the file's mtime.
+	if meta, err := readMetadata(imageDir); err == nil {
+		img.ModTime = meta.FetchedAt
+		img.SourceURL = meta.SourceURL
+		img.Sanitized = meta.Sanitized
+	} else if !os.IsNotExist(err) {
+		slog.Warn("[DiskImageCache.Fetch]: unreadable metadata", "dir", imageDir, "error", err)
+	}
+	touch(imageDir)
+	return img, true, nil
+}
+
+// Stat reads the metadata recorded next to the original. Images cached before metadata was
+// recorded are described by their file alone, without a content hash.
+func (d *DiskImageCache) Stat(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (*chemicalimageresolver.ImageMetadata, bool, error) {
+	imageDir, err := getChemicalAssetDir(c, provider)
+	if err != nil {
+		return nil, false, err
+	}
+	files, err := filepath.Glob(filepath.Join(imageDir, "image.*"))
+	if err != nil {
+		return nil, false, err
+	}
+	var latest os.FileInfo
+	var latestFile string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err == nil && (latest == nil || info.ModTime().After(latest.ModTime())) {
+			latest, latestFile = info, file
+		}
+	}
+	if latest == nil {
+		return nil, false, nil
+	}
+	meta, err := readMetadata(imageDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("[DiskImageCache.Stat]: unreadable metadata", "dir", imageDir, "error", err)
+		}
+		meta = chemicalimageresolver.ImageMetadata{
+			FetchedAt: latest.ModTime(),
+			Provider:  provider,
+			MimeType:  chemicalimageresolver.MimeType(ExtensionToMimeType(latestFile)),
+		}
+	}
+	return &meta, true, nil
+}
+
+const metadataFile = "meta.json"
+
+func readMetadata(dir string) (chemicalimageresolver.ImageMetadata, error) {
+	var meta chemicalimageresolver.ImageMetadata
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// Touch marks the compound's provider directory as used, for tiers that serve it from elsewhere.
+func (d *DiskImageCache) Touch(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) error {
+	dir, err := getChemicalAssetDir(c, provider)
+	if err != nil {
+		return err
+	}
+	touch(dir)
+	return nil
+}
+
+// touch marks a compound's provider directory as used; Evict removes the least recently used
+// directories first.
+func touch(dir string) {
+	now := time.Now()
+	if err := os.Chtimes(dir, now, now); err != nil {
+		slog.Warn("[DiskImageCache]: unable to update access time", "dir", dir, "error", err)
+	}
+}
+
+// writeFileAtomic writes to a temporary file first so concurrent readers never see a partial file.
+func writeFileAtomic(dir string, path string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
 func (d *DiskImageCache) Save(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, img *chemicalimageresolver.Image, imgMimeType string) error {
@@ -116,9 +224,127 @@ func (d *DiskImageCache) Save(ctx context.Context, provider chemicalimageresolve
 	ext := MimeTypeToExtension(imgMimeType)
 	filename := "image" + ext
 	path := filepath.Join(dir, filename)
-	if err := os.WriteFile(path, img.Bytes, 0644); err != nil {
+	if err := writeFileAtomic(dir, path, img.Bytes); err != nil {
 		slog.Error("[DiskImageCache.Save]: unable to write file", "path", path, "error", err)
 		return err
 	}
+	// A refreshed image may have a different format; drop the previous original.
+	if previous, err := filepath.Glob(filepath.Join(dir, "image.*")); err == nil {
+		for _, file := range previous {
+			if file != path {
+				os.Remove(file)
+			}
+		}
+	}
+	meta := img.Metadata()
+	meta.Provider = provider
+	meta.MimeType = chemicalimageresolver.MimeType(imgMimeType)
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dir, filepath.Join(dir, metadataFile), data); err != nil {
+		slog.Error("[DiskImageCache.Save]: unable to write metadata", "dir", dir, "error", err)
+		return err
+	}
+	return nil
+}
+
+func variantPath(dir string, variant chemicalimageresolver.Variant) string {
+	return filepath.Join(dir, "variant-"+variant.Key()+MimeTypeToExtension(string(variant.Format)))
+}
+
+func (d *DiskImageCache) FetchVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, bool, error) {
+	dir, err := getChemicalAssetDir(c, provider)
+	if err != nil {
+		return nil, false, err
+	}
+	path := variantPath(dir, variant)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("[DiskImageCache.FetchVariant]: unable to read file", "path", path, "error", err)
+		return nil, false, err
+	}
+	return &chemicalimageresolver.Image{Bytes: data, MimeType: variant.Format, ModTime: info.ModTime()}, true, nil
+}
+
+func (d *DiskImageCache) SaveVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant, img *chemicalimageresolver.Image) error {
+	dir, err := getChemicalAssetDir(c, provider)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("[DiskImageCache.SaveVariant]: unable to create directory", "dir", dir, "error", err)
+		return err
+	}
+	path := variantPath(dir, variant)
+	if err := writeFileAtomic(dir, path, img.Bytes); err != nil {
+		slog.Error("[DiskImageCache.SaveVariant]: unable to write file", "path", path, "error", err)
+		return err
+	}
 	return nil
 }
+
+type cachedDir struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// Evict removes whole provider directories (original, metadata and variants), least recently
+// used first, until the cache holds at most maxBytes. A directory's mtime is its last use: Fetch
+// touches it and writes update it.
+func (d *DiskImageCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	// {assetDir}/inchikey/{first2}/{next2}/{fullInchiKey}/{providerType}
+	dirs, err := filepath.Glob(filepath.Join(assetDir, "inchikey", "*", "*", "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+	var entries []cachedDir
+	var total int64
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		entry := cachedDir{path: dir, lastUsed: info.ModTime()}
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if fileInfo, err := file.Info(); err == nil && !fileInfo.IsDir() {
+				entry.size += fileInfo.Size()
+			}
+		}
+		entries = append(entries, entry)
+		total += entry.size
+	}
+	if total <= maxBytes {
+		return 0, nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].lastUsed.Before(entries[j].lastUsed) })
+	var freed int64
+	for _, entry := range entries {
+		if total-freed <= maxBytes {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return freed, err
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			slog.Error("[DiskImageCache.Evict]: unable to remove directory", "dir", entry.path, "error", err)
+			continue
+		}
+		freed += entry.size
+	}
+	return freed, nil
+}
@@ -0,0 +1,157 @@
+package chemicalimageresolver_disk
+
+import (
+	"context"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testInchiKey = "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"
+
+func TestDiskImageCache_RoundTripAndStat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	cache := &DiskImageCache{}
+	compound := domain.CompoundMetadata{InchiKey: testInchiKey}
+
+	if _, found, err := cache.Stat(ctx, "chembl", compound); found || err != nil {
+		t.Fatalf("Stat before Save = %v, %v; want a plain miss", found, err)
+	}
+
+	fetchedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	img := &chemicalimageresolver.Image{Bytes: []byte("<svg/>"), MimeType: "image/svg+xml", ModTime: fetchedAt, SourceURL: "https://example.org/x.svg"}
+	if err := cache.Save(ctx, "chembl", compound, img, "image/svg+xml"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	meta, found, err := cache.Stat(ctx, "chembl", compound)
+	if !found || err != nil || !meta.FetchedAt.Equal(fetchedAt) || meta.SHA256 != img.SHA256() || meta.MimeType != "image/svg+xml" || meta.Provider != "chembl" {
+		t.Fatalf("Stat = %+v, %v, %v", meta, found, err)
+	}
+	got, found, err := cache.Fetch(ctx, "chembl", compound)
+	if !found || err != nil || string(got.Bytes) != "<svg/>" || !got.ModTime.Equal(fetchedAt) || got.SourceURL != img.SourceURL {
+		t.Errorf("Fetch = %+v, %v, %v", got, found, err)
+	}
+}
+
+func TestDiskImageCache_MetadataFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	cache := &DiskImageCache{}
+	compound := domain.CompoundMetadata{InchiKey: testInchiKey}
+
+	fetchedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	img := &chemicalimageresolver.Image{Bytes: []byte("<svg/>"), MimeType: "image/svg+xml", ModTime: fetchedAt, SourceURL: "https://example.org/x.svg", Sanitized: true}
+	if err := cache.Save(ctx, "chembl", compound, img, "image/svg+xml"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	dir, err := getChemicalAssetDir(compound, "chembl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readMetadata(dir)
+	want := chemicalimageresolver.ImageMetadata{FetchedAt: fetchedAt, Provider: "chembl", MimeType: "image/svg+xml", SHA256: img.SHA256(), SourceURL: img.SourceURL, Sanitized: true}
+	if err != nil || !meta.FetchedAt.Equal(want.FetchedAt) || meta.Provider != want.Provider || meta.MimeType != want.MimeType || meta.SHA256 != want.SHA256 || meta.SourceURL != want.SourceURL || !meta.Sanitized {
+		t.Fatalf("meta.json = %+v, %v; want %+v", meta, err, want)
+	}
+	got, _, err := cache.Fetch(ctx, "chembl", compound)
+	if err != nil || !got.Sanitized {
+		t.Errorf("Fetch = %+v, %v; want the sanitized marker from meta.json", got, err)
+	}
+
+	// Images cached before meta.json existed fall back to the file's mtime.
+	if err := os.Remove(filepath.Join(dir, metadataFile)); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "image.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := cache.Fetch(ctx, "chembl", compound)
+	if !found || err != nil || !got.ModTime.Equal(info.ModTime()) || got.SourceURL != "" || got.Sanitized {
+		t.Errorf("legacy Fetch = %+v, %v, %v", got, found, err)
+	}
+}
+
+func TestDiskImageCache_EvictsLeastRecentlyUsedFirst(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	cache := &DiskImageCache{}
+	compounds := map[string]domain.CompoundMetadata{
+		"touched": {InchiKey: testInchiKey},
+		"oldest":  {InchiKey: "XLYOFNOQVPJJNP-UHFFFAOYSA-N"},
+		"recent":  {InchiKey: "RYYVLZVUVIJVGH-UHFFFAOYSA-N"},
+	}
+	lastUsed := map[string]time.Time{
+		"touched": time.Now().Add(-3 * time.Hour),
+		"oldest":  time.Now().Add(-2 * time.Hour),
+		"recent":  time.Now().Add(-time.Hour),
+	}
+	dirs := map[string]string{}
+	sizes := map[string]int64{}
+	var total int64
+	for name, compound := range compounds {
+		img := &chemicalimageresolver.Image{Bytes: make([]byte, 1000), MimeType: "image/png", ModTime: time.Now()}
+		if err := cache.Save(ctx, "pubchem", compound, img, "image/png"); err != nil {
+			t.Fatalf("Save %s: %v", name, err)
+		}
+		dir, err := getChemicalAssetDir(compound, "pubchem")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir, lastUsed[name], lastUsed[name]); err != nil {
+			t.Fatal(err)
+		}
+		dirs[name], sizes[name] = dir, dirSize(t, dir)
+		total += sizes[name]
+	}
+
+	// The least recently saved directory is used again and must outlive the other two.
+	if err := cache.Touch(ctx, "pubchem", compounds["touched"]); err != nil {
+		t.Fatalf("Touch: %v", err)
+	}
+	if freed, err := cache.Evict(ctx, total); freed != 0 || err != nil {
+		t.Fatalf("Evict within budget = %d, %v", freed, err)
+	}
+
+	// One directory over budget: only the oldest goes, and eviction stops there.
+	freed, err := cache.Evict(ctx, total-1)
+	if err != nil || freed != sizes["oldest"] {
+		t.Fatalf("Evict = %d, %v; want %d freed", freed, err, sizes["oldest"])
+	}
+	for name, dir := range dirs {
+		_, err := os.Stat(dir)
+		if gone := os.IsNotExist(err); gone != (name == "oldest") {
+			t.Errorf("%s: removed = %v", name, gone)
+		}
+	}
+
+	freed, err = cache.Evict(ctx, sizes["touched"])
+	if err != nil || freed != sizes["recent"] {
+		t.Fatalf("second Evict = %d, %v; want %d freed", freed, err, sizes["recent"])
+	}
+	if _, err := os.Stat(dirs["touched"]); err != nil {
+		t.Errorf("touched directory was evicted: %v", err)
+	}
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+	return size
+}
@@ -0,0 +1,198 @@
+package chemicalimageresolver_http
+
+import (
+	"context"
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/http_helper"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AdminHandler exposes the third-party cooldown store, provider circuit breakers, the image cache
+// counters and the image prefetch job to operators.
+type AdminHandler struct {
+	resolver  *chemicalimageresolver.Resolver
+	cooldowns chemicalimageresolver.CooldownAdminStore
+	warmer    *chemicalimageresolver.Warmer
+}
+
+func NewAdminHandler(resolver *chemicalimageresolver.Resolver, cooldowns chemicalimageresolver.CooldownAdminStore, warmer *chemicalimageresolver.Warmer) *AdminHandler {
+	return &AdminHandler{resolver: resolver, cooldowns: cooldowns, warmer: warmer}
+}
+
+type cooldownListResponse struct {
+	Items    []chemicalimageresolver.Cooldown `json:"items"`
+	Page     int                              `json:"page"`
+	PageSize int                              `json:"pageSize"`
+	Total    int                              `json:"total"`
+}
+
+type compoundCooldownsResponse struct {
+	InchiKey string                           `json:"inchiKey"`
+	Items    []chemicalimageresolver.Cooldown `json:"items"`
+}
+
+type clearCooldownsResponse struct {
+	Cleared int64 `json:"cleared"`
+}
+
+type resetProviderResponse struct {
+	Provider chemicalimageresolver.ProviderType `json:"provider"`
+	Cleared  int64                              `json:"cleared"`
+	Breaker  string                             `json:"breaker,omitempty"`
+}
+
+func parsePositiveInt(value string, fallback int) int {
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// ListCooldownsHandler serves GET /admin/image-cooldowns?provider=&page=&pageSize=.
+func (h *AdminHandler) ListCooldownsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	provider := chemicalimageresolver.ProviderType(query.Get("provider"))
+	page := parsePositiveInt(query.Get("page"), 1)
+	pageSize := min(parsePositiveInt(query.Get("pageSize"), 50), 100)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	items, total, err := h.cooldowns.List(ctx, provider, page, pageSize)
+	if err != nil {
+		slog.Error("[ListCooldownsHandler]: List error", "provider", provider, "page", page, "pageSize", pageSize, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+	if items == nil {
+		items = []chemicalimageresolver.Cooldown{}
+	}
+	http_helper.WriteJSON(w, http.StatusOK, cooldownListResponse{Items: items, Page: page, PageSize: pageSize, Total: total})
+}
+
+// GetCompoundCooldownsHandler serves GET /admin/image-cooldowns/{inchiKey}.
+func (h *AdminHandler) GetCompoundCooldownsHandler(w http.ResponseWriter, r *http.Request) {
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	items, err := h.cooldowns.ForCompound(ctx, inchiKey)
+	if err != nil {
+		slog.Error("[GetCompoundCooldownsHandler]: ForCompound error", "inchiKey", inchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+	if items == nil {
+		items = []chemicalimageresolver.Cooldown{}
+	}
+	http_helper.WriteJSON(w, http.StatusOK, compoundCooldownsResponse{InchiKey: inchiKey, Items: items})
+}
+
+// ClearCompoundCooldownsHandler serves DELETE /admin/image-cooldowns/{inchiKey}?provider=, clearing
+// the compound's cooldowns for one or all providers.
+func (h *AdminHandler) ClearCompoundCooldownsHandler(w http.ResponseWriter, r *http.Request) {
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+	h.clear(w, r, chemicalimageresolver.ProviderType(r.URL.Query().Get("provider")), inchiKey)
+}
+
+// ClearProviderCooldownsHandler serves DELETE /admin/image-cooldowns?provider=, clearing every
+// cooldown of that provider.
+func (h *AdminHandler) ClearProviderCooldownsHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chemicalimageresolver.ProviderType(r.URL.Query().Get("provider"))
+	if provider == "" {
+		http_helper.WriteError(w, http.StatusBadRequest, errors.New("provider is required"))
+		return
+	}
+	h.clear(w, r, provider, "")
+}
+
+func (h *AdminHandler) clear(w http.ResponseWriter, r *http.Request, provider chemicalimageresolver.ProviderType, inchiKey string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	cleared, err := h.cooldowns.Clear(ctx, provider, inchiKey)
+	if err != nil {
+		slog.Error("[ClearCooldownsHandler]: Clear error", "provider", provider, "inchiKey", inchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+	// Compounds that were remembered as having no image should be retried right away too.
+	h.resolver.ForgetMissing(inchiKey)
+
+	slog.Info("[ClearCooldownsHandler]: cooldowns cleared", "provider", provider, "inchiKey", inchiKey, "cleared", cleared)
+	http_helper.WriteJSON(w, http.StatusOK, clearCooldownsResponse{Cleared: cleared})
+}
+
+// ResetProviderHandler serves POST /admin/image-providers/{provider}/reset. After an outage it
+// clears the cooldowns the outage caused, closes the provider's circuit and forgets the compounds
+// remembered as having no image, so they are retried on the next request.
+func (h *AdminHandler) ResetProviderHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chemicalimageresolver.ProviderType(r.PathValue("provider"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	cleared, err := h.cooldowns.ResetProvider(ctx, provider)
+	if err != nil {
+		slog.Error("[ResetProviderHandler]: ResetProvider error", "provider", provider, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+	response := resetProviderResponse{Provider: provider, Cleared: cleared}
+	if h.resolver.ResetBreaker(provider) {
+		response.Breaker = chemicalimageresolver.BreakerClosed.String()
+	}
+	h.resolver.ForgetMissing("")
+
+	slog.Info("[ResetProviderHandler]: provider reset", "provider", provider, "cleared", cleared)
+	http_helper.WriteJSON(w, http.StatusOK, response)
+}
+
+// GetImageCacheHandler serves GET /admin/image-cache with the memory tier's hit, miss and eviction
+// counters, e.g. to size IMAGE_MEMORY_CACHE_MAX_BYTES.
+func (h *AdminHandler) GetImageCacheHandler(w http.ResponseWriter, r *http.Request) {
+	stats, ok := h.resolver.CacheStats()
+	if !ok {
+		http_helper.WriteError(w, http.StatusNotFound, errors.New("the image cache keeps no statistics"))
+		return
+	}
+	http_helper.WriteJSON(w, http.StatusOK, stats)
+}
+
+// GetPrefetchHandler serves GET /admin/image-prefetch with the progress of the current or last run.
+func (h *AdminHandler) GetPrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	http_helper.WriteJSON(w, http.StatusOK, h.warmer.Progress())
+}
+
+// StartPrefetchHandler serves POST /admin/image-prefetch, e.g. after a dataset reload. The run
+// continues in the background; its progress is polled with GET.
+func (h *AdminHandler) StartPrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.warmer.Start(r.Context()); err != nil {
+		http_helper.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	slog.Info("[StartPrefetchHandler]: image prefetch started")
+	http_helper.WriteJSON(w, http.StatusAccepted, h.warmer.Progress())
+}
+
+// StopPrefetchHandler serves DELETE /admin/image-prefetch, cancelling the running prefetch.
+func (h *AdminHandler) StopPrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	h.warmer.Stop()
+	slog.Info("[StopPrefetchHandler]: image prefetch stopped")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package chemicalimageresolver_http
+
+import (
+	"context"
+	"encoding/json"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type missingProvider struct{}
+
+func (missingProvider) FetchImage(ctx context.Context, c domain.CompoundMetadata) (*chemicalimageresolver.Image, error) {
+	return nil, chemicalimageresolver.ErrNotFound
+}
+
+// recordingCooldownAdmin remembers the last call as "method provider inchiKey".
+type recordingCooldownAdmin struct {
+	call string
+}
+
+func (s *recordingCooldownAdmin) List(ctx context.Context, provider chemicalimageresolver.ProviderType, page int, pageSize int) ([]chemicalimageresolver.Cooldown, int, error) {
+	s.call = "List " + string(provider)
+	return []chemicalimageresolver.Cooldown{{Provider: provider, InchiKey: testInchiKey, Reason: "not_found"}}, 1, nil
+}
+func (s *recordingCooldownAdmin) ForCompound(ctx context.Context, inchiKey string) ([]chemicalimageresolver.Cooldown, error) {
+	s.call = "ForCompound " + inchiKey
+	return nil, nil
+}
+func (s *recordingCooldownAdmin) Clear(ctx context.Context, provider chemicalimageresolver.ProviderType, inchiKey string) (int64, error) {
+	s.call = "Clear " + string(provider) + " " + inchiKey
+	return 2, nil
+}
+func (s *recordingCooldownAdmin) ResetProvider(ctx context.Context, provider chemicalimageresolver.ProviderType) (int64, error) {
+	s.call = "ResetProvider " + string(provider)
+	return 3, nil
+}
+
+type statsCache struct {
+	stubCache
+}
+
+func (statsCache) Stats() chemicalimageresolver.CacheStats {
+	return chemicalimageresolver.CacheStats{Hits: 7, Misses: 3, Evictions: 1, Entries: 2, Bytes: 2048}
+}
+
+func TestAdminHandler_ImageCache(t *testing.T) {
+	for _, tt := range []struct {
+		cache chemicalimageresolver.ImageCache
+		want  int
+		body  string
+	}{
+		{cache: stubCache{}, want: http.StatusNotFound},
+		{cache: statsCache{}, want: http.StatusOK, body: `{"hits":7,"misses":3,"evictions":1,"entries":2,"bytes":2048}`},
+	} {
+		resolver := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, tt.cache, nil, nil)
+		rec := httptest.NewRecorder()
+		NewAdminHandler(resolver, nil, nil).GetImageCacheHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/image-cache", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%T: got status %d, want %d", tt.cache, rec.Code, tt.want)
+		}
+		if tt.body != "" && strings.TrimSpace(rec.Body.String()) != tt.body {
+			t.Errorf("%T: got body %s, want %s", tt.cache, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestAdminHandler_Cooldowns(t *testing.T) {
+	resolver := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{}, map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{
+		"chembl": missingProvider{},
+	}, []chemicalimageresolver.ProviderType{"chembl"})
+	store := &recordingCooldownAdmin{}
+	handler := NewAdminHandler(resolver, store, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/image-cooldowns", handler.ListCooldownsHandler)
+	mux.HandleFunc("DELETE /admin/image-cooldowns", handler.ClearProviderCooldownsHandler)
+	mux.HandleFunc("GET /admin/image-cooldowns/{inchiKey}", handler.GetCompoundCooldownsHandler)
+	mux.HandleFunc("DELETE /admin/image-cooldowns/{inchiKey}", handler.ClearCompoundCooldownsHandler)
+	mux.HandleFunc("POST /admin/image-providers/{provider}/reset", handler.ResetProviderHandler)
+
+	tests := []struct {
+		method, target string
+		want           int
+		call           string
+		body           string
+	}{
+		{method: http.MethodGet, target: "/admin/image-cooldowns?provider=chembl&pageSize=500", want: http.StatusOK, call: "List chembl",
+			body: `{"items":[{"provider":"chembl","inchiKey":"` + testInchiKey + `","reason":"not_found","lastRequested":"0001-01-01T00:00:00Z","durationSeconds":0,"nextRequestAt":"0001-01-01T00:00:00Z","active":false}],"page":1,"pageSize":100,"total":1}`},
+		{method: http.MethodGet, target: "/admin/image-cooldowns/" + testInchiKey, want: http.StatusOK, call: "ForCompound " + testInchiKey,
+			body: `{"inchiKey":"` + testInchiKey + `","items":[]}`},
+		{method: http.MethodGet, target: "/admin/image-cooldowns/not-a-key", want: http.StatusBadRequest},
+		{method: http.MethodDelete, target: "/admin/image-cooldowns", want: http.StatusBadRequest},
+		{method: http.MethodDelete, target: "/admin/image-cooldowns?provider=chembl", want: http.StatusOK, call: "Clear chembl ", body: `{"cleared":2}`},
+		{method: http.MethodDelete, target: "/admin/image-cooldowns/" + testInchiKey + "?provider=cactus", want: http.StatusOK, call: "Clear cactus " + testInchiKey, body: `{"cleared":2}`},
+		{method: http.MethodPost, target: "/admin/image-providers/chembl/reset", want: http.StatusOK, call: "ResetProvider chembl", body: `{"provider":"chembl","cleared":3,"breaker":"closed"}`},
+		{method: http.MethodPost, target: "/admin/image-providers/retired/reset", want: http.StatusOK, call: "ResetProvider retired", body: `{"provider":"retired","cleared":3}`},
+	}
+	for _, tt := range tests {
+		store.call = ""
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want || store.call != tt.call {
+			t.Errorf("%s %s: got status %d and call %q, want %d and %q", tt.method, tt.target, rec.Code, store.call, tt.want, tt.call)
+			continue
+		}
+		if tt.body != "" {
+			var got, want any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s %s: %v", tt.method, tt.target, err)
+			}
+			_ = json.Unmarshal([]byte(tt.body), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s %s: got body %s, want %s", tt.method, tt.target, rec.Body, tt.body)
+			}
+		}
+	}
+}
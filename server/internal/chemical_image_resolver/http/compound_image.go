@@ -1,11 +1,17 @@
 package chemicalimageresolver_http
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/auth"
 	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/http_helper"
 	"log/slog"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 )
 
@@ -17,23 +23,140 @@ func NewHandler(resolver *chemicalimageresolver.Resolver) *Handler {
 	return &Handler{resolver: resolver}
 }
 
+// maxImageMaxAge caps how long clients and CDNs reuse an image without revalidating it, so a
+// refreshed image reaches them soon after the cache has it.
+const maxImageMaxAge = 24 * time.Hour
+
+// imageCacheControl lets clients reuse an image for at most the resolver's revalidation TTL; after
+// that they revalidate with the ETag and usually get a 304.
+func (a *Handler) imageCacheControl() string {
+	maxAge := maxImageMaxAge
+	if ttl := a.resolver.RevalidateAfter(); ttl > 0 {
+		maxAge = min(maxAge, ttl)
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// variantSizes are the sizes a client may request, so the variant cache stays bounded.
+var variantSizes = map[int]bool{32: true, 64: true, 128: true, 256: true, 512: true, 1024: true}
+
+var variantFormats = map[string]chemicalimageresolver.MimeType{
+	"png":  "image/png",
+	"webp": "image/webp",
+	"svg":  "image/svg+xml",
+}
+
+// parseVariant reads ?format=png|svg|webp and ?size=N. A size without a format means PNG. ok is
+// false when neither is given, in which case the original image is served.
+func parseVariant(r *http.Request) (variant chemicalimageresolver.Variant, ok bool, err error) {
+	query := r.URL.Query()
+	format, sizeParam := query.Get("format"), query.Get("size")
+	if format == "" && sizeParam == "" {
+		return variant, false, nil
+	}
+	if format == "" {
+		format = "png"
+	}
+	mimeType, known := variantFormats[format]
+	if !known {
+		return variant, false, fmt.Errorf("unsupported format %q (want png, svg or webp)", format)
+	}
+	variant.Format = mimeType
+	if sizeParam != "" {
+		if format == "svg" {
+			return variant, false, errors.New("size cannot be combined with format=svg")
+		}
+		size, err := strconv.Atoi(sizeParam)
+		if err != nil || !variantSizes[size] {
+			return variant, false, fmt.Errorf("unsupported size %q (want 32, 64, 128, 256, 512 or 1024)", sizeParam)
+		}
+		variant.Size = size
+	}
+	return variant, true, nil
+}
+
+// parseSelection reads ?provider=NAME and ?force=true. ok is false when no provider is given, in
+// which case providers are tried in the configured order.
+func parseSelection(r *http.Request) (selection chemicalimageresolver.Selection, ok bool, err error) {
+	query := r.URL.Query()
+	selection.Provider = chemicalimageresolver.ProviderType(query.Get("provider"))
+	switch force := query.Get("force"); force {
+	case "", "false":
+	case "true":
+		selection.Force = true
+	default:
+		return selection, false, fmt.Errorf("invalid force %q (want true or false)", force)
+	}
+	if selection.Provider == "" {
+		if selection.Force {
+			return selection, false, errors.New("force=true requires a provider")
+		}
+		return selection, false, nil
+	}
+	return selection, true, nil
+}
+
 func (a *Handler) GetCompoundImageHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	slog.Info("[GetCompoundImageHandler]: start", "method", r.Method, "path", r.URL.Path)
-	defer slog.Info("[GetCompoundImageHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	defer func() {
+		slog.Info("[GetCompoundImageHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
 
-	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
-	defer cancel()
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
 
-	inchiKey := strings.TrimSpace(r.PathValue("inchiKey"))
-	if inchiKey == "" {
-		http.NotFound(w, r)
+	variant, isVariant, err := parseVariant(r)
+	if err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	selection, isSelection, err := parseSelection(r)
+	if err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if selection.Force && !auth.HasRole(r.Context(), auth.RoleAdmin) {
+		http_helper.WriteError(w, http.StatusForbidden, errors.New("force=true requires role admin"))
 		return
 	}
 
-	image, ok := a.resolver.Image(ctx, inchiKey)
-	if !ok || image == nil {
-		http.NotFound(w, r)
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	var image *chemicalimageresolver.Image
+	if isSelection {
+		image, err = a.resolver.ProviderImage(ctx, inchiKey, selection)
+	} else {
+		image, err = a.resolver.Image(ctx, inchiKey)
+	}
+	if err == nil && isVariant {
+		image, err = a.resolver.VariantOf(ctx, inchiKey, image, variant)
+	}
+	var noImage *chemicalimageresolver.NoImageError
+	var providerErr *chemicalimageresolver.ProviderError
+	if err != nil {
+		switch {
+		case errors.As(err, &noImage):
+			a.writePlaceholder(w, r, noImage, variant, isVariant)
+		case errors.Is(err, chemicalimageresolver.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+		case errors.Is(err, chemicalimageresolver.ErrUnknownProvider):
+			http_helper.WriteError(w, http.StatusBadRequest, err)
+		case errors.Is(err, chemicalimageresolver.ErrCoolingDown):
+			http_helper.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("%w; retry later", err))
+		case errors.Is(err, chemicalimageresolver.ErrProviderUnavailable), errors.As(err, &providerErr):
+			http_helper.WriteError(w, http.StatusBadGateway, err)
+		case errors.Is(err, chemicalimageresolver.ErrUnsupportedVariant):
+			http_helper.WriteError(w, http.StatusNotAcceptable, fmt.Errorf("image is not available as %s", variant.Key()))
+		case errors.Is(err, context.DeadlineExceeded):
+			http_helper.WriteError(w, http.StatusGatewayTimeout, errors.New("image resolution timed out"))
+		default:
+			slog.Error("[GetCompoundImageHandler]: resolve error", "inchiKey", inchiKey, "error", err)
+			http_helper.WriteError(w, http.StatusInternalServerError, errors.New("internal error"))
+		}
 		return
 	}
 	data := image.Bytes
@@ -43,6 +166,7 @@ func (a *Handler) GetCompoundImageHandler(w http.ResponseWriter, r *http.Request
 	if mimeType != "" {
 		w.Header().Set("Content-Type", string(mimeType))
 	}
+	setImageSecurityHeaders(w)
 	slog.Info(
 		"[GetCompoundImageHandler]: image resolved",
 		"inchiKey",
@@ -52,6 +176,93 @@ func (a *Handler) GetCompoundImageHandler(w http.ResponseWriter, r *http.Request
 		"sizeBytes",
 		len(data),
 	)
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(data)
+	// Images are refreshed from their provider once older than the cache TTL, so clients revalidate
+	// through the content-hash ETag. ServeContent answers If-None-Match / If-Modified-Since with
+	// 304 and handles Range requests.
+	w.Header().Set("ETag", image.ETag())
+	w.Header().Set("Cache-Control", a.imageCacheControl())
+	setProvenanceHeaders(w, image)
+	http.ServeContent(w, r, "", image.ModTime, bytes.NewReader(data))
+}
+
+// setProvenanceHeaders tells clients which provider the image came from and whether this request
+// was answered from the image cache or had to fetch it.
+func setProvenanceHeaders(w http.ResponseWriter, image *chemicalimageresolver.Image) {
+	if image.Provider != "" {
+		w.Header().Set("X-Image-Provider", string(image.Provider))
+	}
+	if image.CacheHit {
+		w.Header().Set("X-Image-Cache", "hit")
+	} else {
+		w.Header().Set("X-Image-Cache", "miss")
+	}
+}
+
+// GetCompoundImageInfoHandler serves GET /compounds/{inchiKey}/image/info: the selected image's
+// provenance and content hash, and every provider's cache and cooldown state. It never asks a
+// provider.
+func (a *Handler) GetCompoundImageInfoHandler(w http.ResponseWriter, r *http.Request) {
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	info, err := a.resolver.Info(ctx, inchiKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, chemicalimageresolver.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+		case errors.Is(err, context.DeadlineExceeded):
+			http_helper.WriteError(w, http.StatusGatewayTimeout, errors.New("image resolution timed out"))
+		default:
+			slog.Error("[GetCompoundImageInfoHandler]: resolve error", "inchiKey", inchiKey, "error", err)
+			http_helper.WriteError(w, http.StatusInternalServerError, errors.New("internal error"))
+		}
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http_helper.WriteJSON(w, http.StatusOK, info)
+}
+
+// writePlaceholder answers a known compound without any structure image. The placeholder is
+// rendered in the requested format and size like a real image would be, falling back to SVG when
+// it cannot be converted. It is cached only briefly so a later real image shows up, and not at all
+// when the providers could not say whether they have one.
+func (a *Handler) writePlaceholder(w http.ResponseWriter, r *http.Request, noImage *chemicalimageresolver.NoImageError, variant chemicalimageresolver.Variant, isVariant bool) {
+	slog.Info("[GetCompoundImageHandler]: serving placeholder", "inchiKey", noImage.InchiKey)
+	image := &chemicalimageresolver.Image{Bytes: placeholderSVG(noImage), MimeType: "image/svg+xml"}
+	if isVariant {
+		converted, err := a.resolver.Convert(image, variant)
+		if err != nil {
+			slog.Info("[GetCompoundImageHandler]: serving placeholder as svg", "inchiKey", noImage.InchiKey, "variant", variant.Key(), "error", err)
+		} else {
+			image = converted
+		}
+	}
+	w.Header().Set("Content-Type", string(image.MimeType))
+	setImageSecurityHeaders(w)
+	w.Header().Set("X-Image-Placeholder", "true")
+	w.Header().Set("X-Image-Provider", "placeholder")
+	// A hit means the negative cache answered without asking any provider.
+	if noImage.Remembered {
+		w.Header().Set("X-Image-Cache", "hit")
+	} else {
+		w.Header().Set("X-Image-Cache", "miss")
+	}
+	if noImage.Confirmed {
+		w.Header().Set("Cache-Control", "public, max-age=600")
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image.Bytes))
+}
+
+// setImageSecurityHeaders: images are sanitized, but also forbid scripts, external loads and MIME
+// sniffing in case one is opened directly as a document.
+func setImageSecurityHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 }
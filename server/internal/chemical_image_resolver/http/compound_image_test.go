@@ -0,0 +1,332 @@
+package chemicalimageresolver_http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hydragen-v2/server/internal/auth"
+	chemicalimageresolver_convert "hydragen-v2/server/internal/chemical_image_resolver/convert"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/svgsanitize"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testInchiKey = "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"
+
+type stubMetadata struct{}
+
+func (stubMetadata) Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error) {
+	return &domain.CompoundMetadata{InchiKey: inchiKey}, nil
+}
+
+type stubCooldowns struct{}
+
+func (stubCooldowns) OnCooldown(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (bool, error) {
+	return false, nil
+}
+func (stubCooldowns) Add(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, cause *chemicalimageresolver.ProviderError) error {
+	return nil
+}
+func (stubCooldowns) Remove(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) error {
+	return nil
+}
+
+// stubCache always hits with the same image, or always misses when img is nil.
+type stubCache struct {
+	img *chemicalimageresolver.Image
+}
+
+func (c stubCache) Fetch(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata) (*chemicalimageresolver.Image, bool, error) {
+	return c.img, c.img != nil, nil
+}
+func (c stubCache) Stat(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata) (*chemicalimageresolver.ImageMetadata, bool, error) {
+	if c.img == nil {
+		return nil, false, nil
+	}
+	img := *c.img
+	img.Provider = provider
+	meta := img.Metadata()
+	return &meta, true, nil
+}
+func (c stubCache) Save(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, img *chemicalimageresolver.Image, imgMimeType string) error {
+	return nil
+}
+func (c stubCache) FetchVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, bool, error) {
+	return nil, false, nil
+}
+func (c stubCache) SaveVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, variant chemicalimageresolver.Variant, img *chemicalimageresolver.Image) error {
+	return nil
+}
+func (c stubCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	return 0, nil
+}
+
+func newTestMux(img *chemicalimageresolver.Image) *http.ServeMux {
+	resolver := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{img: img}, nil, []chemicalimageresolver.ProviderType{"chembl"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /compounds/{inchiKey}/image", NewHandler(resolver).GetCompoundImageHandler)
+	return mux
+}
+
+func serve(mux *http.ServeMux, header http.Header) *httptest.ResponseRecorder {
+	return serveQuery(mux, "", header)
+}
+
+func serveQuery(mux *http.ServeMux, query string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/compounds/"+testInchiKey+"/image"+query, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetCompoundImage_CachingHeaders(t *testing.T) {
+	modTime := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	img := &chemicalimageresolver.Image{Bytes: []byte("\x89PNG fake image bytes"), MimeType: "image/png", ModTime: modTime}
+	mux := newTestMux(img)
+
+	first := serve(mux, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("got status %d", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag != img.ETag() || first.Header().Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Errorf("got ETag %q Last-Modified %q", etag, first.Header().Get("Last-Modified"))
+	}
+	if first.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("got Cache-Control %q", first.Header().Get("Cache-Control"))
+	}
+
+	// Clients must not keep an image longer than the cache does before refreshing it.
+	revalidating := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{img: img}, nil, []chemicalimageresolver.ProviderType{"chembl"}, chemicalimageresolver.WithRevalidation(time.Hour))
+	shortMux := http.NewServeMux()
+	shortMux.HandleFunc("GET /compounds/{inchiKey}/image", NewHandler(revalidating).GetCompoundImageHandler)
+	if got := serve(shortMux, nil).Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("got Cache-Control %q with a one hour TTL", got)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "matching etag", header: http.Header{"If-None-Match": {etag}}, want: http.StatusNotModified},
+		{name: "stale etag", header: http.Header{"If-None-Match": {`"other"`}}, want: http.StatusOK},
+		{name: "not modified since", header: http.Header{"If-Modified-Since": {modTime.Add(time.Hour).Format(http.TimeFormat)}}, want: http.StatusNotModified},
+		{name: "range", header: http.Header{"Range": {"bytes=0-3"}}, want: http.StatusPartialContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(mux, tt.header).Code; got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCompoundImage_Variants(t *testing.T) {
+	// The test resolver has no converter, so only the original's own format can be served.
+	mux := newTestMux(&chemicalimageresolver.Image{Bytes: []byte("\x89PNG fake image bytes"), MimeType: "image/png"})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "?format=png", want: http.StatusOK},
+		{query: "?format=webp", want: http.StatusNotAcceptable},
+		{query: "?size=128", want: http.StatusNotAcceptable},
+		{query: "?format=gif", want: http.StatusBadRequest},
+		{query: "?format=png&size=100", want: http.StatusBadRequest},
+		{query: "?format=png&size=big", want: http.StatusBadRequest},
+		{query: "?format=svg&size=128", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := serveQuery(mux, tt.query, nil).Code; got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+type namedMetadata struct{}
+
+func (namedMetadata) Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error) {
+	return &domain.CompoundMetadata{InchiKey: inchiKey, Name: "Aspirin <acid>", Formula: "C9H8O4"}, nil
+}
+
+func TestGetCompoundImage_Placeholder(t *testing.T) {
+	// No providers: nothing can be found for the compound.
+	resolver := chemicalimageresolver.New(stubCooldowns{}, namedMetadata{}, stubCache{}, nil, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /compounds/{inchiKey}/image", NewHandler(resolver).GetCompoundImageHandler)
+
+	rec := serve(mux, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Image-Placeholder") != "true" || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("got status %d, headers %v", rec.Code, rec.Header())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Aspirin &lt;acid&gt;", `C<tspan baseline-shift="sub" font-size="13">9</tspan>H`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("placeholder lacks %q:\n%s", want, body)
+		}
+	}
+	if _, err := svgsanitize.Sanitize(rec.Body.Bytes()); err != nil {
+		t.Errorf("placeholder is not well-formed SVG: %v", err)
+	}
+	// No provider was asked, so a later request may still find an image.
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got Cache-Control %q without any provider answering", got)
+	}
+
+	// Once every provider has answered not found, the placeholder may be cached briefly.
+	confirmed := chemicalimageresolver.New(stubCooldowns{}, namedMetadata{}, stubCache{}, map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{
+		"chembl": missingProvider{},
+	}, []chemicalimageresolver.ProviderType{"chembl"})
+	confirmedMux := http.NewServeMux()
+	confirmedMux.HandleFunc("GET /compounds/{inchiKey}/image", NewHandler(confirmed).GetCompoundImageHandler)
+	first := serve(confirmedMux, nil)
+	if got := first.Header().Get("Cache-Control"); got != "public, max-age=600" {
+		t.Errorf("got Cache-Control %q after the provider answered not found", got)
+	}
+	// The second request is answered by the negative cache.
+	for i, rec := range []*httptest.ResponseRecorder{first, serve(confirmedMux, nil)} {
+		want := []string{"miss", "hit"}[i]
+		if rec.Header().Get("X-Image-Provider") != "placeholder" || rec.Header().Get("X-Image-Cache") != want {
+			t.Errorf("request %d: got provenance %q / %q, want placeholder / %s", i+1, rec.Header().Get("X-Image-Provider"), rec.Header().Get("X-Image-Cache"), want)
+		}
+	}
+}
+
+func TestGetCompoundImage_PlaceholderVariant(t *testing.T) {
+	resolver := chemicalimageresolver.New(stubCooldowns{}, namedMetadata{}, stubCache{}, nil, nil, chemicalimageresolver.WithConverter(chemicalimageresolver_convert.NewConverter()))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /compounds/{inchiKey}/image", NewHandler(resolver).GetCompoundImageHandler)
+
+	rec := serveQuery(mux, "?format=png&size=64", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Image-Placeholder") != "true" || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("got status %d, headers %v", rec.Code, rec.Header())
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("placeholder is not a PNG: %v", err)
+	}
+	if config.Width != 64 || config.Height != 64 {
+		t.Errorf("got %dx%d placeholder, want 64x64", config.Width, config.Height)
+	}
+}
+
+type fixedProvider struct {
+	img chemicalimageresolver.Image
+}
+
+func (p fixedProvider) FetchImage(ctx context.Context, c domain.CompoundMetadata) (*chemicalimageresolver.Image, error) {
+	img := p.img
+	return &img, nil
+}
+
+func TestGetCompoundImage_Provenance(t *testing.T) {
+	img := chemicalimageresolver.Image{Bytes: []byte("\x89PNG fake image bytes"), MimeType: "image/png", SourceURL: "https://example.com/image"}
+	fetching := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{}, map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{
+		"cactus": fixedProvider{img: img},
+	}, []chemicalimageresolver.ProviderType{"chembl", "cactus"})
+	cached := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{img: &img}, nil, []chemicalimageresolver.ProviderType{"chembl", "cactus"})
+
+	for _, tt := range []struct {
+		name             string
+		resolver         *chemicalimageresolver.Resolver
+		provider, cache  string
+		selected         string
+		pending          []chemicalimageresolver.ProviderType
+		cachedByProvider []bool
+	}{
+		// The stub cache keeps nothing, so the info still shows which providers would be asked.
+		{name: "fetched", resolver: fetching, provider: "cactus", cache: "miss", pending: []chemicalimageresolver.ProviderType{"cactus"}, cachedByProvider: []bool{false, false}},
+		{name: "cached", resolver: cached, provider: "chembl", cache: "hit", selected: "chembl", pending: []chemicalimageresolver.ProviderType{}, cachedByProvider: []bool{true, true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			handler := NewHandler(tt.resolver)
+			mux.HandleFunc("GET /compounds/{inchiKey}/image", handler.GetCompoundImageHandler)
+			mux.HandleFunc("GET /compounds/{inchiKey}/image/info", handler.GetCompoundImageInfoHandler)
+
+			rec := serve(mux, nil)
+			if got := rec.Header().Get("X-Image-Provider"); got != tt.provider {
+				t.Errorf("got X-Image-Provider %q, want %q", got, tt.provider)
+			}
+			if got := rec.Header().Get("X-Image-Cache"); got != tt.cache {
+				t.Errorf("got X-Image-Cache %q, want %q", got, tt.cache)
+			}
+
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/compounds/"+testInchiKey+"/image/info", nil))
+			var info chemicalimageresolver.ImageInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, body %s", rec.Code, rec.Body)
+			}
+			if tt.selected == "" && info.Selected != nil {
+				t.Errorf("got selected %+v, want none", info.Selected)
+			}
+			if tt.selected != "" && (info.Selected == nil || string(info.Selected.Provider) != tt.selected || info.Selected.SHA256 != img.SHA256() || info.Selected.SourceURL != img.SourceURL) {
+				t.Errorf("got selected %+v", info.Selected)
+			}
+			if !slices.Equal(info.Pending, tt.pending) {
+				t.Errorf("got pending %v, want %v", info.Pending, tt.pending)
+			}
+			if len(info.Providers) != len(tt.cachedByProvider) {
+				t.Fatalf("got providers %+v", info.Providers)
+			}
+			for i, status := range info.Providers {
+				if (status.Cached != nil) != tt.cachedByProvider[i] {
+					t.Errorf("got provider status %+v", status)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCompoundImage_ProviderSelection(t *testing.T) {
+	img := chemicalimageresolver.Image{Bytes: []byte("\x89PNG fake image bytes"), MimeType: "image/png"}
+	resolver := chemicalimageresolver.New(stubCooldowns{}, stubMetadata{}, stubCache{}, map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{
+		"chembl": fixedProvider{img: img},
+		"cactus": fixedProvider{img: img},
+	}, []chemicalimageresolver.ProviderType{"chembl", "cactus"})
+	handler := NewHandler(resolver).GetCompoundImageHandler
+
+	tests := []struct {
+		query string
+		role  auth.Role
+		want  int
+	}{
+		{query: "?provider=cactus", want: http.StatusOK},
+		{query: "?provider=pubchem", want: http.StatusBadRequest},
+		{query: "?force=true", role: auth.RoleAdmin, want: http.StatusBadRequest},
+		{query: "?provider=cactus&force=yes", role: auth.RoleAdmin, want: http.StatusBadRequest},
+		{query: "?provider=cactus&force=true", role: auth.RoleCurator, want: http.StatusForbidden},
+		{query: "?provider=cactus&force=true", role: auth.RoleAdmin, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/compounds/"+testInchiKey+"/image"+tt.query, nil)
+		req.SetPathValue("inchiKey", testInchiKey)
+		if tt.role != auth.RoleNone {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: "tester", Role: tt.role}))
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s as %v: got status %d, want %d", tt.query, tt.role, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusOK && rec.Header().Get("X-Image-Provider") != "cactus" {
+			t.Errorf("%s: got X-Image-Provider %q", tt.query, rec.Header().Get("X-Image-Provider"))
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package chemicalimageresolver_http
+
+import (
+	"bytes"
+	"encoding/xml"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPlaceholderName keeps long IUPAC names inside the 300px wide placeholder.
+const maxPlaceholderName = 28
+
+// placeholderSVG renders a neutral tile showing the compound's name and formula, or its InChIKey
+// when neither is known. The output needs no sanitizing: all text is escaped.
+func placeholderSVG(noImage *chemicalimageresolver.NoImageError) []byte {
+	name := noImage.Name
+	if name == "" && noImage.Formula == "" {
+		name = noImage.InchiKey
+	}
+	if utf8.RuneCountInString(name) > maxPlaceholderName {
+		name = string([]rune(name)[:maxPlaceholderName-1]) + "…"
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300" viewBox="0 0 300 300">`)
+	b.WriteString(`<rect width="300" height="300" rx="12" fill="#f3f4f6"/>`)
+	b.WriteString(`<g font-family="sans-serif" text-anchor="middle" fill="#6b7280">`)
+	b.WriteString(`<text x="150" y="110" font-size="14">No structure image</text>`)
+	if name != "" {
+		b.WriteString(`<text x="150" y="160" font-size="18" fill="#374151">`)
+		xml.EscapeText(&b, []byte(name))
+		b.WriteString(`</text>`)
+	}
+	if noImage.Formula != "" {
+		b.WriteString(`<text x="150" y="200" font-size="18">`)
+		writeFormula(&b, noImage.Formula)
+		b.WriteString(`</text>`)
+	}
+	b.WriteString(`</g></svg>`)
+	return b.Bytes()
+}
+
+// writeFormula subscripts atom counts, e.g. C9H8O4 -> C<sub>9</sub>H<sub>8</sub>O<sub>4</sub>.
+// Digits that start the formula or follow a dot (hydrate multipliers) stay on the baseline.
+func writeFormula(b *bytes.Buffer, formula string) {
+	runes := []rune(formula)
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && unicode.IsDigit(runes[j]) == unicode.IsDigit(runes[i]) {
+			j++
+		}
+		part := []byte(string(runes[i:j]))
+		subscript := unicode.IsDigit(runes[i]) && i > 0 && !strings.ContainsRune(".·", runes[i-1]) && !unicode.IsSpace(runes[i-1])
+		if subscript {
+			b.WriteString(`<tspan baseline-shift="sub" font-size="13">`)
+			xml.EscapeText(b, part)
+			b.WriteString(`</tspan>`)
+		} else {
+			xml.EscapeText(b, part)
+		}
+		i = j
+	}
+}
@@ -0,0 +1,201 @@
+package chemicalimageresolver_memory
+
+import (
+	"container/list"
+	"context"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultMaxBytes = 64 << 20
+
+// touchInterval limits how often a hot entry's use is passed on to the backing cache.
+const touchInterval = time.Minute
+
+// MaxBytesFromEnv reads IMAGE_MEMORY_CACHE_MAX_BYTES; 0 disables the memory tier.
+func MaxBytesFromEnv() int64 {
+	value, err := strconv.ParseInt(os.Getenv("IMAGE_MEMORY_CACHE_MAX_BYTES"), 10, 64)
+	if err != nil || value < 0 {
+		return DefaultMaxBytes
+	}
+	return value
+}
+
+type entry struct {
+	key string
+	img chemicalimageresolver.Image
+	// touchedAt is when the backing cache last saw a use of this entry.
+	touchedAt time.Time
+}
+
+// TieredImageCache keeps recently used images in memory, bounded by their total size in bytes,
+// in front of a backing ImageCache (usually DiskImageCache). Reads that miss go to the backing
+// cache and are kept; writes go through to the backing cache. Hits are passed on to a backing
+// cache that implements ImageCacheToucher, at most once per touchInterval per entry, so its
+// eviction does not take the hottest images for the coldest.
+type TieredImageCache struct {
+	backing  chemicalimageresolver.ImageCache
+	maxBytes int64
+	now      func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	size    int64
+	hits    int64
+	misses  int64
+	evicted int64
+}
+
+func NewTieredImageCache(backing chemicalimageresolver.ImageCache, maxBytes int64) *TieredImageCache {
+	return &TieredImageCache{
+		backing:  backing,
+		maxBytes: maxBytes,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func cacheKey(provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant string) string {
+	return string(provider) + "/" + c.InchiKey + "/" + variant
+}
+
+func (t *TieredImageCache) Fetch(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (*chemicalimageresolver.Image, bool, error) {
+	key := cacheKey(provider, c, "")
+	if img, ok, stale := t.get(key); ok {
+		if stale {
+			t.touch(ctx, provider, c)
+		}
+		return img, true, nil
+	}
+	img, found, err := t.backing.Fetch(ctx, provider, c)
+	if found {
+		t.put(key, img)
+	}
+	return img, found, err
+}
+
+// Stat answers from memory when it can, without counting a hit or moving the entry.
+func (t *TieredImageCache) Stat(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (*chemicalimageresolver.ImageMetadata, bool, error) {
+	t.mu.Lock()
+	element, ok := t.entries[cacheKey(provider, c, "")]
+	var img chemicalimageresolver.Image
+	if ok {
+		img = element.Value.(*entry).img
+	}
+	t.mu.Unlock()
+	if !ok {
+		return t.backing.Stat(ctx, provider, c)
+	}
+	img.Provider = provider
+	meta := img.Metadata()
+	return &meta, true, nil
+}
+
+func (t *TieredImageCache) Save(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, img *chemicalimageresolver.Image, imgMimeType string) error {
+	if err := t.backing.Save(ctx, provider, c, img, imgMimeType); err != nil {
+		return err
+	}
+	t.put(cacheKey(provider, c, ""), img)
+	return nil
+}
+
+func (t *TieredImageCache) FetchVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, bool, error) {
+	key := cacheKey(provider, c, variant.Key())
+	if img, ok, stale := t.get(key); ok {
+		if stale {
+			t.touch(ctx, provider, c)
+		}
+		return img, true, nil
+	}
+	img, found, err := t.backing.FetchVariant(ctx, provider, c, variant)
+	if found {
+		t.put(key, img)
+	}
+	return img, found, err
+}
+
+func (t *TieredImageCache) SaveVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant, img *chemicalimageresolver.Image) error {
+	if err := t.backing.SaveVariant(ctx, provider, c, variant, img); err != nil {
+		return err
+	}
+	t.put(cacheKey(provider, c, variant.Key()), img)
+	return nil
+}
+
+// Evict applies the budget to the backing cache; the memory tier has its own, fixed budget.
+func (t *TieredImageCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	return t.backing.Evict(ctx, maxBytes)
+}
+
+// Stats reports the memory tier's counters; evictions count entries dropped to stay within maxBytes.
+func (t *TieredImageCache) Stats() chemicalimageresolver.CacheStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return chemicalimageresolver.CacheStats{Hits: t.hits, Misses: t.misses, Evictions: t.evicted, Entries: t.order.Len(), Bytes: t.size}
+}
+
+// get returns a copy of the entry so callers can set fields (e.g. Provider) without touching the
+// cached value; the byte slice is shared and must not be modified. stale reports that the backing
+// cache should be told about the use.
+func (t *TieredImageCache) get(key string) (img *chemicalimageresolver.Image, ok bool, stale bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	element, ok := t.entries[key]
+	if !ok {
+		t.misses++
+		return nil, false, false
+	}
+	t.hits++
+	t.order.MoveToFront(element)
+	e := element.Value.(*entry)
+	if now := t.now(); now.Sub(e.touchedAt) >= touchInterval {
+		e.touchedAt = now
+		stale = true
+	}
+	copied := e.img
+	return &copied, true, stale
+}
+
+func (t *TieredImageCache) touch(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) {
+	toucher, ok := t.backing.(chemicalimageresolver.ImageCacheToucher)
+	if !ok {
+		return
+	}
+	if err := toucher.Touch(ctx, provider, c); err != nil {
+		slog.Warn("[TieredImageCache]: unable to mark image as used", "provider", provider, "inchiKey", c.InchiKey, "error", err)
+	}
+}
+
+// put stores img, evicting least recently used entries until the total fits. Images larger than
+// the whole budget are not kept.
+func (t *TieredImageCache) put(key string, img *chemicalimageresolver.Image) {
+	if img == nil || int64(len(img.Bytes)) > t.maxBytes {
+		return
+	}
+	size := int64(len(img.Bytes))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if element, ok := t.entries[key]; ok {
+		t.remove(element)
+	}
+	for t.size+size > t.maxBytes {
+		t.remove(t.order.Back())
+		t.evicted++
+	}
+	// The backing cache has just read or written the image, which counts as a use.
+	t.entries[key] = t.order.PushFront(&entry{key: key, img: *img, touchedAt: t.now()})
+	t.size += size
+}
+
+func (t *TieredImageCache) remove(element *list.Element) {
+	e := t.order.Remove(element).(*entry)
+	delete(t.entries, e.key)
+	t.size -= int64(len(e.img.Bytes))
+}
@@ -0,0 +1,182 @@
+package chemicalimageresolver_memory
+
+import (
+	"context"
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"testing"
+	"time"
+)
+
+// countingCache is a backing cache that counts reads.
+type countingCache struct {
+	images map[string]*chemicalimageresolver.Image
+	reads  int
+}
+
+func (c *countingCache) Fetch(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata) (*chemicalimageresolver.Image, bool, error) {
+	c.reads++
+	img, ok := c.images[compound.InchiKey]
+	if !ok {
+		return nil, false, errors.New("not cached")
+	}
+	return img, true, nil
+}
+func (c *countingCache) Stat(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata) (*chemicalimageresolver.ImageMetadata, bool, error) {
+	img, ok := c.images[compound.InchiKey]
+	if !ok {
+		return nil, false, nil
+	}
+	meta := img.Metadata()
+	return &meta, true, nil
+}
+func (c *countingCache) Save(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, img *chemicalimageresolver.Image, imgMimeType string) error {
+	c.images[compound.InchiKey] = img
+	return nil
+}
+func (c *countingCache) FetchVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, bool, error) {
+	c.reads++
+	img, ok := c.images[compound.InchiKey+"|"+variant.Key()]
+	return img, ok, nil
+}
+func (c *countingCache) SaveVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata, variant chemicalimageresolver.Variant, img *chemicalimageresolver.Image) error {
+	c.images[compound.InchiKey+"|"+variant.Key()] = img
+	return nil
+}
+func (c *countingCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	return 0, nil
+}
+
+func testImage(size int) *chemicalimageresolver.Image {
+	return &chemicalimageresolver.Image{Bytes: make([]byte, size), MimeType: "image/png"}
+}
+
+func compound(key string) domain.CompoundMetadata {
+	return domain.CompoundMetadata{InchiKey: key}
+}
+
+func TestTieredImageCache_LRU(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingCache{images: map[string]*chemicalimageresolver.Image{
+		"A": testImage(40), "B": testImage(40), "C": testImage(40), "huge": testImage(200),
+	}}
+	cache := NewTieredImageCache(backing, 100)
+
+	fetch := func(key string) {
+		t.Helper()
+		if _, found, err := cache.Fetch(ctx, "chembl", compound(key)); !found || err != nil {
+			t.Fatalf("Fetch(%s) = %v, %v", key, found, err)
+		}
+	}
+	fetch("A")
+	fetch("B")
+	fetch("A") // hit; B is now least recently used
+	fetch("C") // evicts B
+	if backing.reads != 3 {
+		t.Fatalf("backing reads = %d, want 3", backing.reads)
+	}
+	fetch("A")
+	fetch("B")
+	if backing.reads != 4 {
+		t.Errorf("backing reads = %d, want 4 (only B should have been evicted)", backing.reads)
+	}
+
+	fetch("huge")
+	fetch("huge")
+	if backing.reads != 6 {
+		t.Errorf("backing reads = %d, want 6 (images over the budget are not kept)", backing.reads)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 6 || stats.Evictions != 2 || stats.Entries != 2 || stats.Bytes != 80 {
+		t.Errorf("got %+v", stats)
+	}
+
+	// Stat neither reads the backing cache for cached entries nor counts as a use.
+	for _, key := range []string{"A", "C"} {
+		if _, found, err := cache.Stat(ctx, "chembl", compound(key)); !found || err != nil {
+			t.Fatalf("Stat(%s) = %v, %v", key, found, err)
+		}
+	}
+	if after := cache.Stats(); after != stats || backing.reads != 6 {
+		t.Errorf("Stat changed the counters to %+v with %d backing reads", after, backing.reads)
+	}
+}
+
+func TestTieredImageCache_WriteThroughAndVariants(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingCache{images: map[string]*chemicalimageresolver.Image{}}
+	cache := NewTieredImageCache(backing, 1000)
+	variant := chemicalimageresolver.Variant{Format: "image/webp", Size: 64}
+
+	if err := cache.Save(ctx, "chembl", compound("A"), testImage(10), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SaveVariant(ctx, "chembl", compound("A"), variant, testImage(5)); err != nil {
+		t.Fatal(err)
+	}
+	if backing.images["A"] == nil || backing.images["A|webp-64"] == nil {
+		t.Fatalf("writes did not reach the backing cache: %v", backing.images)
+	}
+
+	original, _, _ := cache.Fetch(ctx, "chembl", compound("A"))
+	derived, _, _ := cache.FetchVariant(ctx, "chembl", compound("A"), variant)
+	if len(original.Bytes) != 10 || len(derived.Bytes) != 5 || backing.reads != 0 {
+		t.Errorf("got %d and %d bytes after %d backing reads", len(original.Bytes), len(derived.Bytes), backing.reads)
+	}
+
+	// Callers may annotate the returned image without affecting the cached entry.
+	original.Provider = "cactus"
+	if again, _, _ := cache.Fetch(ctx, "chembl", compound("A")); again.Provider != "" {
+		t.Errorf("cached entry was modified: %q", again.Provider)
+	}
+}
+
+// touchingCache is a backing cache that records the uses reported to it.
+type touchingCache struct {
+	countingCache
+	touches map[string]int
+}
+
+func (c *touchingCache) Touch(ctx context.Context, provider chemicalimageresolver.ProviderType, compound domain.CompoundMetadata) error {
+	c.touches[compound.InchiKey]++
+	return nil
+}
+
+func TestTieredImageCache_PassesHitsOnToBackingLRU(t *testing.T) {
+	ctx := context.Background()
+	backing := &touchingCache{
+		countingCache: countingCache{images: map[string]*chemicalimageresolver.Image{"A": testImage(10)}},
+		touches:       map[string]int{},
+	}
+	backing.images["A|webp-64"] = testImage(5)
+	cache := NewTieredImageCache(backing, 1000)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	variant := chemicalimageresolver.Variant{Format: "image/webp", Size: 64}
+
+	// The miss is read from the backing cache, which counts as a use there.
+	for range 3 {
+		if _, found, _ := cache.Fetch(ctx, "chembl", compound("A")); !found {
+			t.Fatal("not found")
+		}
+	}
+	if backing.touches["A"] != 0 {
+		t.Errorf("got %d touches within the interval, want 0", backing.touches["A"])
+	}
+
+	now = now.Add(touchInterval)
+	cache.Fetch(ctx, "chembl", compound("A"))
+	cache.Fetch(ctx, "chembl", compound("A"))
+	if backing.touches["A"] != 1 {
+		t.Errorf("got %d touches after the interval, want 1", backing.touches["A"])
+	}
+
+	cache.FetchVariant(ctx, "chembl", compound("A"), variant)
+	now = now.Add(touchInterval)
+	cache.FetchVariant(ctx, "chembl", compound("A"), variant)
+	if backing.touches["A"] != 2 {
+		t.Errorf("got %d touches after a variant hit, want 2", backing.touches["A"])
+	}
+}
@@ -10,14 +10,21 @@ import (
 	"time"
 )
 
-func NewPostgresRequestCooldownStore(db *sql.DB) *PostgresRequestCooldownStore {
+// NewPostgresRequestCooldownStore backs off per failure reason; nil policies use
+// chemicalimageresolver.DefaultCooldownPolicies.
+func NewPostgresRequestCooldownStore(db *sql.DB, policies chemicalimageresolver.CooldownPolicies) *PostgresRequestCooldownStore {
+	if policies == nil {
+		policies = chemicalimageresolver.DefaultCooldownPolicies()
+	}
 	return &PostgresRequestCooldownStore{
-		db: db,
+		db:       db,
+		policies: policies,
 	}
 }
 
 type PostgresRequestCooldownStore struct {
-	db *sql.DB
+	db       *sql.DB
+	policies chemicalimageresolver.CooldownPolicies
 }
 
 func (p *PostgresRequestCooldownStore) OnCooldown(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (bool, error) {
@@ -47,12 +54,9 @@ func (p *PostgresRequestCooldownStore) OnCooldown(ctx context.Context, provider
 	return false, nil
 }
 
-const (
-	initialCooldownHours = 1
-	maxCooldownHours     = 24 * 7
-)
-
-func (p *PostgresRequestCooldownStore) Add(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) error {
+// Add doubles the compound's cooldown while it keeps failing for the same reason; a different
+// reason restarts the backoff at that reason's initial duration.
+func (p *PostgresRequestCooldownStore) Add(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, cause *chemicalimageresolver.ProviderError) error {
 	if p.db == nil {
 		return nil
 	}
@@ -60,29 +64,37 @@ func (p *PostgresRequestCooldownStore) Add(ctx context.Context, provider chemica
 	const sqlQuery = `
 		WITH upsert AS (
 			INSERT INTO third_party_cooldown (
-				origin, unique_key, last_requested,
-				current_cooldown_duration_hours, earliest_next_request
+				origin, unique_key, last_requested, reason,
+				current_cooldown_duration_seconds, earliest_next_request
 			)
 			VALUES (
-				$1, $2, NOW(),
-				$3, NOW() + make_interval(hours => $3)
+				$1, $2, NOW(), $5,
+				$3::BIGINT, NOW() + make_interval(secs => $3::BIGINT)
 			)
 			ON CONFLICT (origin, unique_key)
 			DO UPDATE SET
 				last_requested = NOW(),
-				current_cooldown_duration_hours =
-					LEAST($4, GREATEST($3, third_party_cooldown.current_cooldown_duration_hours * 2))
-			RETURNING origin, unique_key, current_cooldown_duration_hours
+				reason = EXCLUDED.reason,
+				current_cooldown_duration_seconds = CASE
+					WHEN third_party_cooldown.reason = EXCLUDED.reason
+						THEN LEAST($4::BIGINT, GREATEST($3::BIGINT, third_party_cooldown.current_cooldown_duration_seconds * 2))
+					ELSE $3::BIGINT
+				END
+			RETURNING origin, unique_key, current_cooldown_duration_seconds
 		)
 		UPDATE third_party_cooldown t
-		SET earliest_next_request = NOW() + make_interval(hours => upsert.current_cooldown_duration_hours)
+		SET earliest_next_request = NOW() + make_interval(secs => upsert.current_cooldown_duration_seconds)
 		FROM upsert
 		WHERE t.origin = upsert.origin AND t.unique_key = upsert.unique_key;
 	`
 
-	_, err := p.db.ExecContext(ctx, sqlQuery, provider, c.InchiKey, initialCooldownHours, maxCooldownHours)
+	policy := p.policies.For(cause)
+	reason := cause.Kind.String()
+	initialSeconds := max(int64(policy.Initial/time.Second), 1)
+	maxSeconds := max(int64(policy.Max/time.Second), initialSeconds)
+	_, err := p.db.ExecContext(ctx, sqlQuery, provider, c.InchiKey, initialSeconds, maxSeconds, reason)
 	if err != nil {
-		slog.Error("[DB RegisterThirdPartyRequestFailure]: postgres error", "error", err, "origin", provider, "uniqueKey", c.InchiKey)
+		slog.Error("[DB RegisterThirdPartyRequestFailure]: postgres error", "error", err, "origin", provider, "uniqueKey", c.InchiKey, "reason", reason)
 		return err
 	}
 	return nil
@@ -106,3 +118,142 @@ func (p *PostgresRequestCooldownStore) Remove(ctx context.Context, provider chem
 
 	return nil
 }
+
+const cooldownColumns = `origin, unique_key, reason, last_requested, current_cooldown_duration_seconds, earliest_next_request, earliest_next_request > NOW()`
+
+func scanCooldown(rows *sql.Rows, extra ...any) (chemicalimageresolver.Cooldown, error) {
+	var cooldown chemicalimageresolver.Cooldown
+	err := rows.Scan(append([]any{
+		&cooldown.Provider,
+		&cooldown.InchiKey,
+		&cooldown.Reason,
+		&cooldown.LastRequested,
+		&cooldown.DurationSeconds,
+		&cooldown.NextRequestAt,
+		&cooldown.Active,
+	}, extra...)...)
+	return cooldown, err
+}
+
+func (p *PostgresRequestCooldownStore) List(ctx context.Context, provider chemicalimageresolver.ProviderType, page int, pageSize int) ([]chemicalimageresolver.Cooldown, int, error) {
+	if p.db == nil {
+		return nil, 0, nil
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	offset := (page - 1) * pageSize
+
+	const sqlQuery = `
+		SELECT ` + cooldownColumns + `, COUNT(*) OVER ()
+		FROM third_party_cooldown
+		WHERE $1 = '' OR origin = $1
+		ORDER BY last_requested DESC, origin, unique_key
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := p.db.QueryContext(ctx, sqlQuery, provider, pageSize, offset)
+	if err != nil {
+		slog.Error("[DB ListThirdPartyCooldowns]: postgres error", "error", err, "origin", provider)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []chemicalimageresolver.Cooldown
+	total := 0
+	for rows.Next() {
+		cooldown, err := scanCooldown(rows, &total)
+		if err != nil {
+			slog.Error("[DB ListThirdPartyCooldowns]: failed to scan row", "error", err, "origin", provider)
+			return nil, 0, err
+		}
+		items = append(items, cooldown)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB ListThirdPartyCooldowns]: rows iteration error", "error", err, "origin", provider)
+		return nil, 0, err
+	}
+	if len(items) == 0 && offset > 0 {
+		// COUNT(*) OVER () has no row to ride on past the last page.
+		if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM third_party_cooldown WHERE $1 = '' OR origin = $1`, provider).Scan(&total); err != nil {
+			slog.Error("[DB ListThirdPartyCooldowns]: count error", "error", err, "origin", provider)
+			return nil, 0, err
+		}
+	}
+	return items, total, nil
+}
+
+func (p *PostgresRequestCooldownStore) ForCompound(ctx context.Context, inchiKey string) ([]chemicalimageresolver.Cooldown, error) {
+	if p.db == nil {
+		return nil, nil
+	}
+
+	const sqlQuery = `
+		SELECT ` + cooldownColumns + `
+		FROM third_party_cooldown
+		WHERE unique_key = $1
+		ORDER BY origin
+	`
+
+	rows, err := p.db.QueryContext(ctx, sqlQuery, inchiKey)
+	if err != nil {
+		slog.Error("[DB GetCompoundCooldowns]: postgres error", "error", err, "uniqueKey", inchiKey)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []chemicalimageresolver.Cooldown
+	for rows.Next() {
+		cooldown, err := scanCooldown(rows)
+		if err != nil {
+			slog.Error("[DB GetCompoundCooldowns]: failed to scan row", "error", err, "uniqueKey", inchiKey)
+			return nil, err
+		}
+		items = append(items, cooldown)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB GetCompoundCooldowns]: rows iteration error", "error", err, "uniqueKey", inchiKey)
+		return nil, err
+	}
+	return items, nil
+}
+
+func (p *PostgresRequestCooldownStore) Clear(ctx context.Context, provider chemicalimageresolver.ProviderType, inchiKey string) (int64, error) {
+	if provider == "" && inchiKey == "" {
+		return 0, &domain.ValidationError{Field: "provider", Message: "provider or inchiKey is required"}
+	}
+	if p.db == nil {
+		return 0, domain.ErrReadOnly
+	}
+
+	const sqlQuery = `
+		DELETE FROM third_party_cooldown
+		WHERE ($1 = '' OR origin = $1) AND ($2 = '' OR unique_key = $2)
+	`
+
+	result, err := p.db.ExecContext(ctx, sqlQuery, provider, inchiKey)
+	if err != nil {
+		slog.Error("[DB ClearThirdPartyCooldowns]: postgres error", "error", err, "origin", provider, "uniqueKey", inchiKey)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (p *PostgresRequestCooldownStore) ResetProvider(ctx context.Context, provider chemicalimageresolver.ProviderType) (int64, error) {
+	if p.db == nil {
+		return 0, domain.ErrReadOnly
+	}
+
+	const sqlQuery = `
+		DELETE FROM third_party_cooldown
+		WHERE origin = $1 AND reason IN ($2, $3)
+	`
+
+	result, err := p.db.ExecContext(ctx, sqlQuery, provider,
+		chemicalimageresolver.ProviderErrorTransient.String(), chemicalimageresolver.ProviderErrorRateLimited.String())
+	if err != nil {
+		slog.Error("[DB ResetThirdPartyCooldowns]: postgres error", "error", err, "origin", provider)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,411 @@
+package chemicalimageresolver_s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/inchikey"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxObjectBytes bounds reads; cached images are far smaller than this.
+const maxObjectBytes = 32 << 20
+
+type Config struct {
+	// Endpoint is the base URL of the S3 API, e.g. https://s3.eu-central-1.amazonaws.com or
+	// http://minio:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every object key, so several deployments can share a bucket.
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses objects as {endpoint}/{bucket}/{key} (MinIO and most self-hosted
+	// stores) instead of {bucket}.{endpoint host}/{key}.
+	PathStyle bool
+	Timeout   time.Duration
+}
+
+// ConfigFromEnv reads S3_ENDPOINT, S3_REGION (default us-east-1), S3_BUCKET, S3_PREFIX,
+// S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PATH_STYLE (default true) and S3_TIMEOUT.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		Prefix:          os.Getenv("S3_PREFIX"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       os.Getenv("S3_PATH_STYLE") != "false",
+		Timeout:         10 * time.Second,
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if value, err := time.ParseDuration(os.Getenv("S3_TIMEOUT")); err == nil && value > 0 {
+		config.Timeout = value
+	}
+	var missing []string
+	for _, required := range []struct{ name, value string }{
+		{"S3_ENDPOINT", config.Endpoint},
+		{"S3_BUCKET", config.Bucket},
+		{"S3_ACCESS_KEY_ID", config.AccessKeyID},
+		{"S3_SECRET_ACCESS_KEY", config.SecretAccessKey},
+	} {
+		if required.value == "" {
+			missing = append(missing, required.name)
+		}
+	}
+	if len(missing) > 0 {
+		return config, fmt.Errorf("s3 image cache: missing %s", strings.Join(missing, ", "))
+	}
+	if _, err := url.Parse(config.Endpoint); err != nil {
+		return config, fmt.Errorf("s3 image cache: invalid S3_ENDPOINT: %w", err)
+	}
+	return config, nil
+}
+
+// S3ImageCache stores images in an S3-compatible bucket, laid out like DiskImageCache:
+//
+//	{prefix}/inchikey/{first2}/{next2}/{fullInchiKey}/{providerType}/image
+//	{prefix}/inchikey/{first2}/{next2}/{fullInchiKey}/{providerType}/variant-{key}
+//
+// The MIME type is kept as the object's Content-Type, so keys carry no extension.
+type S3ImageCache struct {
+	config Config
+	creds  credentials
+	http   *http.Client
+	now    func() time.Time
+}
+
+func NewS3ImageCache(config Config) *S3ImageCache {
+	return &S3ImageCache{
+		config: config,
+		creds:  credentials{accessKeyID: config.AccessKeyID, secretAccessKey: config.SecretAccessKey, region: config.Region},
+		http:   &http.Client{Timeout: config.Timeout},
+		now:    time.Now,
+	}
+}
+
+func (s *S3ImageCache) objectKey(c domain.CompoundMetadata, provider chemicalimageresolver.ProviderType, name string) (string, error) {
+	inchiKey, err := inchikey.NormalizeFull(c.InchiKey)
+	if err != nil {
+		return "", err
+	}
+	key := path.Join("inchikey", inchiKey[0:2], inchiKey[2:4], inchiKey, string(provider), name)
+	if prefix := strings.Trim(s.config.Prefix, "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key, nil
+}
+
+func (s *S3ImageCache) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u := *endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.config.PathStyle {
+		u.Path = basePath + "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = basePath + "/" + key
+	}
+	return &u, nil
+}
+
+func (s *S3ImageCache) do(ctx context.Context, method string, u *url.URL, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyBodySHA256
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	sign(req, s.creds, payloadHash, s.now())
+	return s.http.Do(req)
+}
+
+// get returns found=false for a missing object.
+func (s *S3ImageCache) get(ctx context.Context, key string) (*chemicalimageresolver.Image, bool, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, statusError(resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxObjectBytes {
+		return nil, false, fmt.Errorf("s3 object %s exceeds %d bytes", key, maxObjectBytes)
+	}
+	// Objects written before metadata was recorded fall back to Last-Modified.
+	modTime, err := time.Parse(time.RFC3339Nano, resp.Header.Get("X-Amz-Meta-Fetched-At"))
+	if err != nil {
+		modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	}
+	return &chemicalimageresolver.Image{
+		Bytes:     data,
+		MimeType:  chemicalimageresolver.MimeType(resp.Header.Get("Content-Type")),
+		ModTime:   modTime,
+		SourceURL: resp.Header.Get("X-Amz-Meta-Source-Url"),
+		Sanitized: resp.Header.Get("X-Amz-Meta-Sanitized") == "true",
+	}, true, nil
+}
+
+// put stores data; meta is sent as user metadata (x-amz-meta-*), which S3 returns on GET.
+func (s *S3ImageCache) put(ctx context.Context, key string, data []byte, contentType string, meta map[string]string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	for name, value := range meta {
+		if value != "" {
+			header.Set("X-Amz-Meta-"+name, value)
+		}
+	}
+	resp, err := s.do(ctx, http.MethodPut, u, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// statusError includes the start of S3's XML error document, which names the error code.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+}
+
+func (s *S3ImageCache) Fetch(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (*chemicalimageresolver.Image, bool, error) {
+	key, err := s.objectKey(c, provider, "image")
+	if err != nil {
+		return nil, false, err
+	}
+	img, found, err := s.get(ctx, key)
+	if err != nil {
+		slog.Error("[S3ImageCache.Fetch]: unable to get object", "key", key, "error", err)
+	}
+	return img, found, err
+}
+
+// Stat reads the object's user metadata with a HEAD request.
+func (s *S3ImageCache) Stat(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata) (*chemicalimageresolver.ImageMetadata, bool, error) {
+	key, err := s.objectKey(c, provider, "image")
+	if err != nil {
+		return nil, false, err
+	}
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, u, nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("s3 HEAD %s: %s", u.Path, resp.Status)
+	}
+	fetchedAt, err := time.Parse(time.RFC3339Nano, resp.Header.Get("X-Amz-Meta-Fetched-At"))
+	if err != nil {
+		fetchedAt, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	}
+	return &chemicalimageresolver.ImageMetadata{
+		FetchedAt: fetchedAt,
+		Provider:  provider,
+		MimeType:  chemicalimageresolver.MimeType(resp.Header.Get("Content-Type")),
+		SHA256:    resp.Header.Get("X-Amz-Meta-Sha256"),
+		SourceURL: resp.Header.Get("X-Amz-Meta-Source-Url"),
+		Sanitized: resp.Header.Get("X-Amz-Meta-Sanitized") == "true",
+	}, true, nil
+}
+
+func (s *S3ImageCache) Save(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, img *chemicalimageresolver.Image, imgMimeType string) error {
+	if img == nil {
+		return errors.New("s3 image cache: nil image")
+	}
+	key, err := s.objectKey(c, provider, "image")
+	if err != nil {
+		return err
+	}
+	meta := img.Metadata()
+	err = s.put(ctx, key, img.Bytes, imgMimeType, map[string]string{
+		"Fetched-At": meta.FetchedAt.UTC().Format(time.RFC3339Nano),
+		"Provider":   string(provider),
+		"Sha256":     meta.SHA256,
+		"Source-Url": meta.SourceURL,
+		"Sanitized":  strconv.FormatBool(meta.Sanitized),
+	})
+	if err != nil {
+		slog.Error("[S3ImageCache.Save]: unable to put object", "key", key, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *S3ImageCache) FetchVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant) (*chemicalimageresolver.Image, bool, error) {
+	key, err := s.objectKey(c, provider, "variant-"+variant.Key())
+	if err != nil {
+		return nil, false, err
+	}
+	return s.get(ctx, key)
+}
+
+func (s *S3ImageCache) SaveVariant(ctx context.Context, provider chemicalimageresolver.ProviderType, c domain.CompoundMetadata, variant chemicalimageresolver.Variant, img *chemicalimageresolver.Image) error {
+	key, err := s.objectKey(c, provider, "variant-"+variant.Key())
+	if err != nil {
+		return err
+	}
+	err = s.put(ctx, key, img.Bytes, string(variant.Format), map[string]string{
+		"Fetched-At": img.ModTime.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		slog.Error("[S3ImageCache.SaveVariant]: unable to put object", "key", key, "error", err)
+		return err
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type storedObject struct {
+	key          string
+	lastModified time.Time
+	size         int64
+}
+
+// list returns every object under the configured prefix (ListObjectsV2, paginated).
+func (s *S3ImageCache) list(ctx context.Context) ([]storedObject, error) {
+	bucketURL, err := s.objectURL("")
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(s.config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var objects []storedObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix + "inchikey/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := *bucketURL
+		if s.config.PathStyle {
+			u.Path = strings.TrimSuffix(u.Path, "/")
+		}
+		u.RawQuery = query.Encode()
+		resp, err := s.do(ctx, http.MethodGet, &u, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := statusError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(io.LimitReader(resp.Body, maxObjectBytes)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, content := range page.Contents {
+			objects = append(objects, storedObject{key: content.Key, lastModified: content.LastModified, size: content.Size})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Evict deletes objects, oldest first, until the prefix holds at most maxBytes. S3 does not track
+// reads, so "least recently used" is approximated by least recently written; revalidation
+// rewrites images that are still requested.
+func (s *S3ImageCache) Evict(ctx context.Context, maxBytes int64) (int64, error) {
+	objects, err := s.list(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, object := range objects {
+		total += object.size
+	}
+	if total <= maxBytes {
+		return 0, nil
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].lastModified.Before(objects[j].lastModified) })
+	var freed int64
+	for _, object := range objects {
+		if total-freed <= maxBytes {
+			break
+		}
+		u, err := s.objectURL(object.key)
+		if err != nil {
+			return freed, err
+		}
+		resp, err := s.do(ctx, http.MethodDelete, u, nil, nil)
+		if err != nil {
+			return freed, err
+		}
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			err := statusError(resp)
+			resp.Body.Close()
+			slog.Error("[S3ImageCache.Evict]: unable to delete object", "key", object.key, "error", err)
+			continue
+		}
+		resp.Body.Close()
+		freed += object.size
+	}
+	return freed, nil
+}
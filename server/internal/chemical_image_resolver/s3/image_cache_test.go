@@ -0,0 +1,221 @@
+package chemicalimageresolver_s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testInchiKey = "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"
+
+var testCreds = credentials{accessKeyID: "minio", secretAccessKey: "minio-secret", region: "us-east-1"}
+
+type object struct {
+	data    []byte
+	header  http.Header
+	modTime time.Time
+}
+
+// fakeS3 is an in-process stand-in for a path-style S3 endpoint. It checks request signatures by
+// re-signing the received request with the same credentials.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !f.validSignature(r, body) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		header := http.Header{}
+		for name, values := range r.Header {
+			if name == "Content-Type" || strings.HasPrefix(name, "X-Amz-Meta-") {
+				header[name] = values
+			}
+		}
+		f.objects[r.URL.Path] = object{data: body, header: header, modTime: time.Now()}
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		w.Write(obj.data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers ListObjectsV2 one object per page, to exercise pagination.
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	bucketPath := r.URL.Path + "/"
+	var keys []string
+	for path := range f.objects {
+		key := strings.TrimPrefix(path, bucketPath)
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) && key > r.URL.Query().Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var result listBucketResult
+	if len(keys) > 0 {
+		obj := f.objects[bucketPath+keys[0]]
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			LastModified time.Time `xml:"LastModified"`
+			Size         int64     `xml:"Size"`
+		}{keys[0], obj.modTime, int64(len(obj.data))})
+		result.IsTruncated = len(keys) > 1
+		result.NextContinuationToken = keys[0]
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) validSignature(r *http.Request, body []byte) bool {
+	signedAt, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil || r.Header.Get("X-Amz-Content-Sha256") != hashHex(body) {
+		return false
+	}
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for name, values := range r.Header {
+		if name == "Content-Type" || strings.HasPrefix(name, "X-Amz-Meta-") {
+			check.Header[name] = values
+		}
+	}
+	sign(check, testCreds, hashHex(body), signedAt)
+	return check.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func newTestCache(t *testing.T, secret string) (*S3ImageCache, *fakeS3) {
+	fake := &fakeS3{objects: map[string]object{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	cache := NewS3ImageCache(Config{
+		Endpoint:        server.URL,
+		Region:          testCreds.region,
+		Bucket:          "images",
+		Prefix:          "/prod/",
+		AccessKeyID:     testCreds.accessKeyID,
+		SecretAccessKey: secret,
+		PathStyle:       true,
+		Timeout:         time.Second,
+	})
+	return cache, fake
+}
+
+func TestS3ImageCache_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	cache, fake := newTestCache(t, testCreds.secretAccessKey)
+	compound := domain.CompoundMetadata{InchiKey: testInchiKey}
+
+	if _, found, err := cache.Fetch(ctx, "chembl", compound); found || err != nil {
+		t.Fatalf("Fetch before Save = %v, %v; want a plain miss", found, err)
+	}
+	if _, found, err := cache.Stat(ctx, "chembl", compound); found || err != nil {
+		t.Fatalf("Stat before Save = %v, %v; want a plain miss", found, err)
+	}
+
+	fetchedAt := time.Date(2025, 3, 1, 12, 0, 0, 123, time.UTC)
+	img := &chemicalimageresolver.Image{Bytes: []byte("<svg/>"), MimeType: "image/svg+xml", ModTime: fetchedAt, SourceURL: "https://example.org/x.svg"}
+	if err := cache.Save(ctx, "chembl", compound, img, "image/svg+xml"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	wantPath := "/images/prod/inchikey/BS/YN/" + testInchiKey + "/chembl/image"
+	if _, ok := fake.objects[wantPath]; !ok {
+		t.Fatalf("object not stored at %s: %v", wantPath, fake.objects)
+	}
+
+	meta, found, err := cache.Stat(ctx, "chembl", compound)
+	if !found || err != nil || !meta.FetchedAt.Equal(fetchedAt) || meta.SHA256 != img.SHA256() || meta.MimeType != "image/svg+xml" || meta.SourceURL != img.SourceURL {
+		t.Fatalf("Stat = %+v, %v, %v", meta, found, err)
+	}
+
+	got, found, err := cache.Fetch(ctx, "chembl", compound)
+	if !found || err != nil {
+		t.Fatalf("Fetch = %v, %v", found, err)
+	}
+	if !bytes.Equal(got.Bytes, img.Bytes) || got.MimeType != "image/svg+xml" || !got.ModTime.Equal(fetchedAt) || got.SourceURL != img.SourceURL {
+		t.Errorf("got %+v", got)
+	}
+
+	variant := chemicalimageresolver.Variant{Format: "image/png", Size: 128}
+	if err := cache.SaveVariant(ctx, "chembl", compound, variant, &chemicalimageresolver.Image{Bytes: []byte("png")}); err != nil {
+		t.Fatalf("SaveVariant: %v", err)
+	}
+	got, found, err = cache.FetchVariant(ctx, "chembl", compound, variant)
+	if !found || err != nil || string(got.Bytes) != "png" || got.MimeType != "image/png" {
+		t.Errorf("FetchVariant = %+v, %v, %v", got, found, err)
+	}
+}
+
+func TestS3ImageCache_RejectedSignature(t *testing.T) {
+	cache, _ := newTestCache(t, "wrong-secret")
+	compound := domain.CompoundMetadata{InchiKey: testInchiKey}
+	_, found, err := cache.Fetch(context.Background(), "chembl", compound)
+	if found || err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("got %v, %v; want a SignatureDoesNotMatch error", found, err)
+	}
+}
+
+func TestS3ImageCache_VirtualHostedURL(t *testing.T) {
+	cache := NewS3ImageCache(Config{Endpoint: "https://s3.eu-central-1.amazonaws.com", Bucket: "images"})
+	u, err := cache.objectURL("inchikey/BS/image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.String(); got != "https://images.s3.eu-central-1.amazonaws.com/inchikey/BS/image" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestS3ImageCache_Evict(t *testing.T) {
+	ctx := context.Background()
+	cache, fake := newTestCache(t, testCreds.secretAccessKey)
+	keys := []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N", "XLYOFNOQVPJJNP-UHFFFAOYSA-N", "QTBSBXVTEAMEQO-UHFFFAOYSA-N"}
+	for _, key := range keys {
+		img := &chemicalimageresolver.Image{Bytes: make([]byte, 100), MimeType: "image/png"}
+		if err := cache.Save(ctx, "chembl", domain.CompoundMetadata{InchiKey: key}, img, "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	freed, err := cache.Evict(ctx, 250)
+	if err != nil || freed != 100 {
+		t.Fatalf("Evict = %d, %v; want 100 bytes freed", freed, err)
+	}
+	for i, key := range keys {
+		_, found, _ := cache.Fetch(ctx, "chembl", domain.CompoundMetadata{InchiKey: key})
+		if found != (i > 0) {
+			t.Errorf("%s: found = %v", key, found)
+		}
+	}
+	if len(fake.objects) != 2 {
+		t.Errorf("%d objects left", len(fake.objects))
+	}
+}
@@ -4,17 +4,32 @@ import (
 	"context"
 	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
 	"hydragen-v2/server/internal/domain"
-	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
+const DefaultCactusBaseURL = "https://cactus.nci.nih.gov/chemical/structure"
+
 type CactusThirdPartyProvider struct {
+	// Name is the configured provider name reported in errors; it defaults to "cactus".
+	Name chemicalimageresolver.ProviderType
+	// BaseURL defaults to DefaultCactusBaseURL; Client defaults to a client with DefaultClientConfig.
+	BaseURL string
+	Client  *Client
 }
 
 func (provider *CactusThirdPartyProvider) urlFallbackList(compound domain.CompoundMetadata) []string {
+	baseURL := provider.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultCactusBaseURL
+	}
 
-	url := func(identifier string) string {
-		return "https://cactus.nci.nih.gov/chemical/structure/" + identifier + "/image"
+	imageURL := func(identifier string) string {
+		// Escape '#', '?', spaces etc. in SMILES and names, but keep '/' which Cactus expects verbatim.
+		escaped := (&url.URL{Path: identifier}).EscapedPath()
+		return strings.TrimSuffix(baseURL, "/") + "/" + escaped + "/image"
 	}
 
 	var identifiers = []string{
@@ -23,40 +38,47 @@ func (provider *CactusThirdPartyProvider) urlFallbackList(compound domain.Compou
 		compound.Name,
 	}
 
-	var nonEmptyIdentifiers []string
+	var urls []string
 	for _, id := range identifiers {
 		if id != "" {
-			nonEmptyIdentifiers = append(nonEmptyIdentifiers, id)
+			urls = append(urls, imageURL(id))
 		}
 	}
-	var urls []string
-	for _, id := range nonEmptyIdentifiers {
-		urls = append(urls, url(id))
-	}
 	return urls
-
 }
 
 func (provider *CactusThirdPartyProvider) FetchImage(ctx context.Context, compound domain.CompoundMetadata) (*chemicalimageresolver.Image, error) {
-	fallbackUrls := provider.urlFallbackList(compound)
-	for _, url := range fallbackUrls {
-		resp, err := http.Get(url)
+	client := clientOrDefault(provider.Client)
+	var lastErr error
+	for _, imageURL := range provider.urlFallbackList(compound) {
+		resp, err := client.Get(ctx, imageURL)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Info("[CactusThirdPartyProvider.FetchImage] request failed", "url", imageURL, "error", err)
+			lastErr = err
 			continue
 		}
-		data, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
+		if resp.StatusCode == http.StatusNotFound {
 			continue
 		}
-		if len(data) == 0 {
+		if resp.StatusCode != http.StatusOK {
+			lastErr = client.statusError(nameOrDefault(provider.Name, "cactus"), resp)
 			continue
 		}
-		mimeType := resp.Header.Get("Content-Type")
-		return &chemicalimageresolver.Image{
-			Bytes:    data,
-			MimeType: chemicalimageresolver.MimeType(mimeType),
-		}, nil
+		// Cactus answers unknown identifiers with HTML pages, so the body must be sniffed.
+		img, err := sniffImage(resp.Body)
+		if err != nil {
+			slog.Info("[CactusThirdPartyProvider.FetchImage] rejected payload", "url", imageURL, "error", err)
+			lastErr = invalidResponse(nameOrDefault(provider.Name, "cactus"), err)
+			continue
+		}
+		img.SourceURL = imageURL
+		return img, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
 	}
 	return nil, chemicalimageresolver.ErrNotFound
 }
@@ -4,51 +4,61 @@ import (
 	"context"
 	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
 	"hydragen-v2/server/internal/domain"
-	"io"
 	"net/http"
 	"strings"
 )
 
+const DefaultChemblBaseURL = "https://www.ebi.ac.uk/chembl/api/data"
+
 type ChemblThirdPartyProvider struct {
+	// Name is the configured provider name reported in errors; it defaults to "chembl".
+	Name chemicalimageresolver.ProviderType
+	// BaseURL defaults to DefaultChemblBaseURL; Client defaults to a client with DefaultClientConfig.
+	BaseURL string
+	Client  *Client
 }
 
 func (provider *ChemblThirdPartyProvider) imageURL(inchiKey string) string {
-	return "https://www.ebi.ac.uk/chembl/api/data/image/" + inchiKey + "?format=svg"
+	baseURL := provider.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultChemblBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/image/" + inchiKey + "?format=svg"
+}
+
+func clientOrDefault(client *Client) *Client {
+	if client == nil {
+		return defaultClient
+	}
+	return client
 }
 
-func normalizeMimeType(contentType string) string {
-	if contentType == "" {
-		return ""
+// nameOrDefault is the name a provider reports in its errors: the configured one, which differs from
+// the kind for mirrors, or the kind itself.
+func nameOrDefault(name chemicalimageresolver.ProviderType, kind chemicalimageresolver.ProviderType) chemicalimageresolver.ProviderType {
+	if name == "" {
+		return kind
 	}
-	return strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return name
 }
 
 func (provider *ChemblThirdPartyProvider) FetchImage(ctx context.Context, compound domain.CompoundMetadata) (*chemicalimageresolver.Image, error) {
 	if compound.InchiKey == "" {
 		return nil, chemicalimageresolver.ErrNotFound
 	}
-	url := provider.imageURL(compound.InchiKey)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	data, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	imageURL := provider.imageURL(compound.InchiKey)
+	client := clientOrDefault(provider.Client)
+	resp, err := client.Get(ctx, imageURL)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, chemicalimageresolver.ErrNotFound
+		return nil, client.statusError(nameOrDefault(provider.Name, "chembl"), resp)
 	}
-	if len(data) == 0 {
-		return nil, chemicalimageresolver.ErrNotFound
-	}
-	contentType := normalizeMimeType(resp.Header.Get("Content-Type"))
-	if contentType == "" {
-		contentType = "image/svg+xml"
+	img, err := sniffImage(resp.Body)
+	if err != nil {
+		return nil, invalidResponse(nameOrDefault(provider.Name, "chembl"), err)
 	}
-	return &chemicalimageresolver.Image{
-		Bytes:    data,
-		MimeType: chemicalimageresolver.MimeType(contentType),
-	}, nil
+	img.SourceURL = imageURL
+	return img, nil
 }
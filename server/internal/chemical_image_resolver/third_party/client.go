@@ -0,0 +1,219 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrBodyTooLarge = errors.New("response body exceeds size limit")
+
+// ClientConfig bounds and identifies outbound requests to a third-party image provider.
+type ClientConfig struct {
+	// Timeout applies to each attempt, including reading the body.
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	// MaxRetries is the number of extra attempts after a 5xx or 429 answer or a transport error.
+	MaxRetries int
+	// Backoff is the delay before the first retry; it doubles with every further retry.
+	Backoff time.Duration
+	// MaxRetryAfter caps how long a Retry-After header may make us wait; longer waits give up instead.
+	MaxRetryAfter time.Duration
+	UserAgent     string
+	// ContactEmail is sent in the From header and User-Agent so providers can reach the operator.
+	ContactEmail string
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Timeout:       10 * time.Second,
+		MaxBodyBytes:  5 << 20,
+		MaxRetries:    2,
+		Backoff:       250 * time.Millisecond,
+		MaxRetryAfter: 5 * time.Second,
+		UserAgent:     "hydragen-v2",
+	}
+}
+
+// ClientConfigFromEnv starts from DefaultClientConfig and applies IMAGE_PROVIDER_USER_AGENT,
+// IMAGE_PROVIDER_CONTACT_EMAIL, IMAGE_PROVIDER_MAX_BODY_BYTES, IMAGE_PROVIDER_MAX_RETRIES and
+// IMAGE_PROVIDER_TIMEOUT. The timeout can be overridden per provider, e.g. IMAGE_PROVIDER_CACTUS_TIMEOUT=20s.
+func ClientConfigFromEnv(provider string) ClientConfig {
+	return DefaultClientConfig().withGlobalEnv().withProviderEnv(provider)
+}
+
+// withGlobalEnv applies the variables shared by all providers.
+func (config ClientConfig) withGlobalEnv() ClientConfig {
+	if value := os.Getenv("IMAGE_PROVIDER_USER_AGENT"); value != "" {
+		config.UserAgent = value
+	}
+	config.ContactEmail = os.Getenv("IMAGE_PROVIDER_CONTACT_EMAIL")
+	if value, err := strconv.ParseInt(os.Getenv("IMAGE_PROVIDER_MAX_BODY_BYTES"), 10, 64); err == nil && value > 0 {
+		config.MaxBodyBytes = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_PROVIDER_MAX_RETRIES")); err == nil && value >= 0 {
+		config.MaxRetries = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("IMAGE_PROVIDER_TIMEOUT")); err == nil && value > 0 {
+		config.Timeout = value
+	}
+	return config
+}
+
+// withProviderEnv applies the variables scoped to one provider, e.g. IMAGE_PROVIDER_CACTUS_TIMEOUT.
+func (config ClientConfig) withProviderEnv(provider string) ClientConfig {
+	if value, err := time.ParseDuration(os.Getenv(providerEnvKey(provider, "TIMEOUT"))); err == nil && value > 0 {
+		config.Timeout = value
+	}
+	return config
+}
+
+// providerEnvKey names a per-provider variable, e.g. IMAGE_PROVIDER_CACTUS_TIMEOUT.
+func providerEnvKey(provider string, setting string) string {
+	return "IMAGE_PROVIDER_" + strings.ToUpper(strings.ReplaceAll(provider, "-", "_")) + "_" + setting
+}
+
+// Response is a fully read provider response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Client is the outbound HTTP layer shared by the providers. It honours the caller's context,
+// limits each attempt and the body size, and retries 5xx/429 answers with backoff or Retry-After.
+type Client struct {
+	config ClientConfig
+	http   *http.Client
+	now    func() time.Time
+}
+
+func NewClient(config ClientConfig) *Client {
+	return &Client{config: config, http: &http.Client{}, now: time.Now}
+}
+
+var defaultClient = NewClient(DefaultClientConfig())
+
+func (c *Client) userAgent() string {
+	if c.config.ContactEmail == "" {
+		return c.config.UserAgent
+	}
+	return c.config.UserAgent + " (mailto:" + c.config.ContactEmail + ")"
+}
+
+// Get fetches url. Non-retryable statuses (and the last answer once retries run out) are returned
+// as a Response for the provider to interpret; only transport failures are errors, and those wrap
+// chemicalimageresolver.ErrProviderUnavailable (except ErrBodyTooLarge).
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	backoff := c.config.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, url)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		retryable := err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if !retryable || attempt >= c.config.MaxRetries || errors.Is(err, ErrBodyTooLarge) {
+			if err != nil && !errors.Is(err, ErrBodyTooLarge) {
+				err = fmt.Errorf("%w: %w", chemicalimageresolver.ErrProviderUnavailable, err)
+			}
+			return resp, err
+		}
+
+		wait := backoff
+		backoff *= 2
+		if err == nil {
+			if retryAfter, ok := c.retryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > c.config.MaxRetryAfter {
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, url string) (*Response, error) {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent())
+	if c.config.ContactEmail != "" {
+		req.Header.Set("From", c.config.ContactEmail)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body := io.Reader(resp.Body)
+	if c.config.MaxBodyBytes > 0 {
+		body = io.LimitReader(resp.Body, c.config.MaxBodyBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.MaxBodyBytes > 0 && int64(len(data)) > c.config.MaxBodyBytes {
+		return nil, fmt.Errorf("%w (%d bytes) from %s", ErrBodyTooLarge, c.config.MaxBodyBytes, req.URL.Host)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// statusError classifies a non-200 answer: 404 is a definitive miss, 429 and 5xx mean the provider
+// is unavailable rather than that the compound has no image.
+func (c *Client) statusError(provider chemicalimageresolver.ProviderType, resp *Response) error {
+	providerErr := &chemicalimageresolver.ProviderError{Provider: provider, Err: fmt.Errorf("status %d", resp.StatusCode)}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		providerErr.Kind = chemicalimageresolver.ProviderErrorNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		providerErr.Kind = chemicalimageresolver.ProviderErrorRateLimited
+		providerErr.RetryAfter, _ = c.retryAfter(resp.Header.Get("Retry-After"))
+	case resp.StatusCode >= 500:
+		providerErr.Kind = chemicalimageresolver.ProviderErrorTransient
+	default:
+		providerErr.Kind = chemicalimageresolver.ProviderErrorInvalidResponse
+	}
+	return providerErr
+}
+
+// invalidResponse marks a payload the provider sent that we cannot use.
+func invalidResponse(provider chemicalimageresolver.ProviderType, err error) error {
+	return &chemicalimageresolver.ProviderError{Provider: provider, Kind: chemicalimageresolver.ProviderErrorInvalidResponse, Err: err}
+}
+
+// retryAfter parses both forms of Retry-After: delay-seconds and an HTTP date.
+func (c *Client) retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(c.now()), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,191 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"context"
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testInchiKey = "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300"></svg>`
+
+func testClient(config ClientConfig) *Client {
+	config.Backoff = time.Millisecond
+	return NewClient(config)
+}
+
+func TestChembl_SendsIdentityAndReturnsSVG(t *testing.T) {
+	var userAgent, from, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, from, path = r.UserAgent(), r.Header.Get("From"), r.URL.Path
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+		_, _ = w.Write([]byte(testSVG))
+	}))
+	defer server.Close()
+
+	config := DefaultClientConfig()
+	config.UserAgent = "hydragen-test"
+	config.ContactEmail = "ops@example.com"
+	provider := &ChemblThirdPartyProvider{BaseURL: server.URL, Client: testClient(config)}
+
+	img, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+	if err != nil {
+		t.Fatalf("FetchImage: %v", err)
+	}
+	if img.MimeType != "image/svg+xml" || string(img.Bytes) != testSVG {
+		t.Errorf("got %q %q", img.MimeType, img.Bytes)
+	}
+	if path != "/image/"+testInchiKey {
+		t.Errorf("got path %q", path)
+	}
+	if userAgent != "hydragen-test (mailto:ops@example.com)" || from != "ops@example.com" {
+		t.Errorf("got User-Agent %q From %q", userAgent, from)
+	}
+}
+
+func TestChembl_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	provider := &ChemblThirdPartyProvider{BaseURL: server.URL, Client: testClient(DefaultClientConfig())}
+	_, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+	if !errors.Is(err, chemicalimageresolver.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestChembl_ClassifiesFailures(t *testing.T) {
+	for _, tc := range []struct {
+		status     int
+		retryAfter string
+		kind       chemicalimageresolver.ProviderErrorKind
+		wait       time.Duration
+	}{
+		{status: http.StatusNotFound, kind: chemicalimageresolver.ProviderErrorNotFound},
+		{status: http.StatusTooManyRequests, retryAfter: "120", kind: chemicalimageresolver.ProviderErrorRateLimited, wait: 2 * time.Minute},
+		{status: http.StatusServiceUnavailable, kind: chemicalimageresolver.ProviderErrorTransient},
+		{status: http.StatusForbidden, kind: chemicalimageresolver.ProviderErrorInvalidResponse},
+		{status: http.StatusOK, kind: chemicalimageresolver.ProviderErrorInvalidResponse},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			w.WriteHeader(tc.status)
+			_, _ = w.Write([]byte("<html>not an image</html>"))
+		}))
+		config := DefaultClientConfig()
+		config.MaxRetries = 0
+		provider := &ChemblThirdPartyProvider{BaseURL: server.URL, Client: testClient(config)}
+		_, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+		server.Close()
+
+		var providerErr *chemicalimageresolver.ProviderError
+		if !errors.As(err, &providerErr) || providerErr.Kind != tc.kind || providerErr.RetryAfter != tc.wait {
+			t.Errorf("status %d: got %#v, want %v after %v", tc.status, err, tc.kind, tc.wait)
+		}
+	}
+}
+
+func TestClient_RetriesServerErrorsHonouringRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	resp, err := testClient(DefaultClientConfig()).Get(t.Context(), server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %v %v, want 200", resp, err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+}
+
+func TestClient_GivesUpOnLongRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	resp, err := testClient(DefaultClientConfig()).Get(t.Context(), server.URL)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got %v %v, want 429", resp, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d attempts, want 1", n)
+	}
+}
+
+func TestClient_LimitsBodyAndTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(200 * time.Millisecond):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer server.Close()
+
+	config := DefaultClientConfig()
+	config.MaxBodyBytes = 1024
+	config.MaxRetries = 0
+	config.Timeout = 20 * time.Millisecond
+	client := testClient(config)
+
+	if _, err := client.Get(t.Context(), server.URL+"/big"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("got %v, want ErrBodyTooLarge", err)
+	}
+	if _, err := client.Get(t.Context(), server.URL+"/slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want per-attempt timeout", err)
+	}
+}
+
+func TestCactus_FallsBackToSmiles(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		if strings.HasPrefix(r.URL.Path, "/"+testInchiKey) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write(testRaster(t, "gif", 64, 64))
+	}))
+	defer server.Close()
+
+	provider := &CactusThirdPartyProvider{BaseURL: server.URL, Client: testClient(DefaultClientConfig())}
+	img, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey, Smiles: "C#N"})
+	if err != nil {
+		t.Fatalf("FetchImage: %v", err)
+	}
+	if img.MimeType != "image/gif" {
+		t.Errorf("got mime type %q", img.MimeType)
+	}
+	if len(paths) != 2 || paths[1] != "/C%23N/image" {
+		t.Errorf("got requests %v", paths)
+	}
+}
@@ -0,0 +1,77 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"context"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultPubchemBaseURL = "https://pubchem.ncbi.nlm.nih.gov/rest/pug"
+
+// PubchemThirdPartyProvider fetches 2D depictions (PNG) from PubChem's PUG REST API.
+type PubchemThirdPartyProvider struct {
+	// Name is the configured provider name reported in errors; it defaults to "pubchem".
+	Name chemicalimageresolver.ProviderType
+	// BaseURL defaults to DefaultPubchemBaseURL; Client defaults to a client with DefaultClientConfig.
+	BaseURL string
+	Client  *Client
+}
+
+// urlFallbackList asks by InChIKey first, then by SMILES. SMILES go into the query string, since
+// they may contain '/' which PUG REST would take as a path separator.
+func (provider *PubchemThirdPartyProvider) urlFallbackList(compound domain.CompoundMetadata) []string {
+	baseURL := provider.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultPubchemBaseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var urls []string
+	if compound.InchiKey != "" {
+		urls = append(urls, baseURL+"/compound/inchikey/"+url.PathEscape(compound.InchiKey)+"/PNG")
+	}
+	if compound.Smiles != "" {
+		urls = append(urls, baseURL+"/compound/smiles/PNG?"+url.Values{"smiles": {compound.Smiles}}.Encode())
+	}
+	return urls
+}
+
+func (provider *PubchemThirdPartyProvider) FetchImage(ctx context.Context, compound domain.CompoundMetadata) (*chemicalimageresolver.Image, error) {
+	client := clientOrDefault(provider.Client)
+	var lastErr error
+	for _, imageURL := range provider.urlFallbackList(compound) {
+		resp, err := client.Get(ctx, imageURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Info("[PubchemThirdPartyProvider.FetchImage] request failed", "url", imageURL, "error", err)
+			lastErr = err
+			continue
+		}
+		// PUG REST answers unknown identifiers with 404 and SMILES it cannot parse with 400.
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = client.statusError(nameOrDefault(provider.Name, "pubchem"), resp)
+			continue
+		}
+		img, err := sniffImage(resp.Body)
+		if err != nil {
+			slog.Info("[PubchemThirdPartyProvider.FetchImage] rejected payload", "url", imageURL, "error", err)
+			lastErr = invalidResponse(nameOrDefault(provider.Name, "pubchem"), err)
+			continue
+		}
+		img.SourceURL = imageURL
+		return img, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, chemicalimageresolver.ErrNotFound
+}
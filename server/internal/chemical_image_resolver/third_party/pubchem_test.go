@@ -0,0 +1,62 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPubchem_FallsBackToSmiles(t *testing.T) {
+	const smiles = "C[C@H](N)C(=O)O/C=C/#N"
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch {
+		case r.URL.Path == "/compound/inchikey/"+testInchiKey+"/PNG":
+			http.Error(w, `{"Fault": {"Code": "PUGREST.NotFound"}}`, http.StatusNotFound)
+		case r.URL.Path == "/compound/smiles/PNG" && r.URL.Query().Get("smiles") == smiles:
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(testRaster(t, "png", 300, 300))
+		default:
+			http.Error(w, `{"Fault": {"Code": "PUGREST.BadRequest"}}`, http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	provider := &PubchemThirdPartyProvider{BaseURL: server.URL, Client: testClient(DefaultClientConfig())}
+	img, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey, Smiles: smiles})
+	if err != nil {
+		t.Fatalf("FetchImage: %v", err)
+	}
+	if img.MimeType != "image/png" || img.SourceURL == "" {
+		t.Errorf("got mime type %q, source %q", img.MimeType, img.SourceURL)
+	}
+	if len(requests) != 2 {
+		t.Errorf("got requests %v", requests)
+	}
+
+	// Neither identifier is known: a definitive miss. A parse failure on the SMILES counts as one too.
+	_, err = provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey, Smiles: "not a smiles"})
+	if !errors.Is(err, chemicalimageresolver.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPubchem_ServerBusy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"Fault": {"Code": "PUGREST.ServerBusy"}}`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := DefaultClientConfig()
+	config.MaxRetries = 0
+	provider := &PubchemThirdPartyProvider{BaseURL: server.URL, Client: testClient(config)}
+	_, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+	var providerErr *chemicalimageresolver.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Kind != chemicalimageresolver.ProviderErrorTransient || providerErr.Provider != "pubchem" {
+		t.Errorf("got %v, want a transient pubchem error", err)
+	}
+}
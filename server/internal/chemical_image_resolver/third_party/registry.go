@@ -0,0 +1,271 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// providerKinds are the provider implementations a registry entry can use. Providers report
+// errors under the entry's name, so a mirror's failures are not blamed on the public service.
+var providerKinds = map[string]func(name chemicalimageresolver.ProviderType, baseURL string, client *Client) chemicalimageresolver.ThirdPartyProvider{
+	"chembl": func(name chemicalimageresolver.ProviderType, baseURL string, client *Client) chemicalimageresolver.ThirdPartyProvider {
+		return &ChemblThirdPartyProvider{Name: name, BaseURL: baseURL, Client: client}
+	},
+	"pubchem": func(name chemicalimageresolver.ProviderType, baseURL string, client *Client) chemicalimageresolver.ThirdPartyProvider {
+		return &PubchemThirdPartyProvider{Name: name, BaseURL: baseURL, Client: client}
+	},
+	"cactus": func(name chemicalimageresolver.ProviderType, baseURL string, client *Client) chemicalimageresolver.ThirdPartyProvider {
+		return &CactusThirdPartyProvider{Name: name, BaseURL: baseURL, Client: client}
+	},
+}
+
+// Duration reads durations like "10s" or "168h" from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type ProviderConfig struct {
+	Name string `json:"name"`
+	// Kind selects the implementation (chembl, pubchem or cactus) and defaults to Name, so a mirror
+	// can run next to the public service under its own name.
+	Kind     string `json:"kind,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// BaseURL defaults to the public service of the kind.
+	BaseURL    string   `json:"baseUrl,omitempty"`
+	Timeout    Duration `json:"timeout,omitempty"`
+	MaxRetries *int     `json:"maxRetries,omitempty"`
+}
+
+func (p ProviderConfig) kind() string {
+	if p.Kind == "" {
+		return p.Name
+	}
+	return p.Kind
+}
+
+type CooldownConfig struct {
+	Initial Duration `json:"initial"`
+	Max     Duration `json:"max"`
+}
+
+// RegistryConfig lists the image providers in resolution order, with the cooldowns applied after
+// their failures.
+type RegistryConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+	// Cooldowns is keyed by failure reason (not_found, rate_limited, transient, invalid_response);
+	// missing reasons keep DefaultCooldownPolicies.
+	Cooldowns map[string]CooldownConfig `json:"cooldowns,omitempty"`
+}
+
+// DefaultRegistryConfig asks ChEMBL first, then PubChem, then Cactus.
+func DefaultRegistryConfig() RegistryConfig {
+	return RegistryConfig{
+		Providers: []ProviderConfig{{Name: "chembl"}, {Name: "pubchem"}, {Name: "cactus"}},
+	}
+}
+
+// RegistryConfigFromEnv reads the JSON file named by IMAGE_PROVIDERS_CONFIG (DefaultRegistryConfig
+// when unset), then applies overrides:
+//   - IMAGE_PROVIDER_ORDER=chembl,cactus sets the order; providers not listed are disabled.
+//   - IMAGE_PROVIDER_<NAME>_ENABLED=false disables a provider.
+//   - IMAGE_PROVIDER_<NAME>_BASE_URL points a provider at a mirror.
+//   - IMAGE_COOLDOWN_<REASON>_INITIAL and IMAGE_COOLDOWN_<REASON>_MAX, e.g. IMAGE_COOLDOWN_NOT_FOUND_MAX=72h.
+//
+// Timeouts and retries set in the file take precedence over IMAGE_PROVIDER_TIMEOUT and
+// IMAGE_PROVIDER_MAX_RETRIES, which only fill in what the file leaves unset; a provider's own
+// IMAGE_PROVIDER_<NAME>_TIMEOUT overrides the file.
+func RegistryConfigFromEnv() (RegistryConfig, error) {
+	config := DefaultRegistryConfig()
+	if path := os.Getenv("IMAGE_PROVIDERS_CONFIG"); path != "" {
+		var err error
+		if config, err = LoadRegistryConfig(path); err != nil {
+			return RegistryConfig{}, err
+		}
+	}
+
+	if order := os.Getenv("IMAGE_PROVIDER_ORDER"); order != "" {
+		var providers []ProviderConfig
+		for name := range strings.SplitSeq(order, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			index := slices.IndexFunc(config.Providers, func(p ProviderConfig) bool { return p.Name == name })
+			provider := ProviderConfig{Name: name}
+			if index >= 0 {
+				provider = config.Providers[index]
+			}
+			provider.Disabled = false
+			providers = append(providers, provider)
+		}
+		for _, provider := range config.Providers {
+			if !slices.ContainsFunc(providers, func(p ProviderConfig) bool { return p.Name == provider.Name }) {
+				provider.Disabled = true
+				providers = append(providers, provider)
+			}
+		}
+		config.Providers = providers
+	}
+
+	for i := range config.Providers {
+		provider := &config.Providers[i]
+		if value := os.Getenv(providerEnvKey(provider.Name, "ENABLED")); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return RegistryConfig{}, fmt.Errorf("%s: %w", providerEnvKey(provider.Name, "ENABLED"), err)
+			}
+			provider.Disabled = !enabled
+		}
+		if value := os.Getenv(providerEnvKey(provider.Name, "BASE_URL")); value != "" {
+			provider.BaseURL = value
+		}
+	}
+
+	for kind, defaults := range chemicalimageresolver.DefaultCooldownPolicies() {
+		reason := kind.String()
+		cooldown, configured := config.Cooldowns[reason]
+		if !configured {
+			cooldown = CooldownConfig{Initial: Duration(defaults.Initial), Max: Duration(defaults.Max)}
+		}
+		changed := false
+		for setting, target := range map[string]*Duration{"INITIAL": &cooldown.Initial, "MAX": &cooldown.Max} {
+			key := "IMAGE_COOLDOWN_" + strings.ToUpper(reason) + "_" + setting
+			value := os.Getenv(key)
+			if value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return RegistryConfig{}, fmt.Errorf("%s: %w", key, err)
+			}
+			*target = Duration(parsed)
+			changed = true
+		}
+		if changed {
+			if config.Cooldowns == nil {
+				config.Cooldowns = map[string]CooldownConfig{}
+			}
+			config.Cooldowns[reason] = cooldown
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return RegistryConfig{}, err
+	}
+	return config, nil
+}
+
+// LoadRegistryConfig reads a registry file; see image-providers.example.json in the repository root.
+func LoadRegistryConfig(path string) (RegistryConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RegistryConfig{}, err
+	}
+	var config RegistryConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return RegistryConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c RegistryConfig) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, provider := range c.Providers {
+		switch {
+		case provider.Name == "":
+			errs = append(errs, errors.New("provider without a name"))
+			continue
+		case seen[provider.Name]:
+			errs = append(errs, fmt.Errorf("provider %q: listed twice", provider.Name))
+		case providerKinds[provider.kind()] == nil:
+			errs = append(errs, fmt.Errorf("provider %q: unknown kind %q", provider.Name, provider.kind()))
+		}
+		seen[provider.Name] = true
+		if provider.BaseURL != "" {
+			if parsed, err := url.Parse(provider.BaseURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				errs = append(errs, fmt.Errorf("provider %q: baseUrl must be an absolute http(s) URL", provider.Name))
+			}
+		}
+		if provider.Timeout < 0 || (provider.MaxRetries != nil && *provider.MaxRetries < 0) {
+			errs = append(errs, fmt.Errorf("provider %q: timeout and maxRetries must not be negative", provider.Name))
+		}
+	}
+	reasons := map[string]bool{}
+	for kind := range chemicalimageresolver.DefaultCooldownPolicies() {
+		reasons[kind.String()] = true
+	}
+	for reason, cooldown := range c.Cooldowns {
+		if !reasons[reason] {
+			errs = append(errs, fmt.Errorf("cooldowns: unknown reason %q", reason))
+			continue
+		}
+		if cooldown.Initial <= 0 || cooldown.Max < cooldown.Initial {
+			errs = append(errs, fmt.Errorf("cooldowns %q: initial must be positive and max at least initial", reason))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Build creates the enabled providers and their resolution order.
+func (c RegistryConfig) Build() (map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider, []chemicalimageresolver.ProviderType, error) {
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	providers := map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{}
+	var order []chemicalimageresolver.ProviderType
+	for _, provider := range c.Providers {
+		if provider.Disabled {
+			continue
+		}
+		// Global variables < file < provider-scoped variables.
+		clientConfig := DefaultClientConfig().withGlobalEnv()
+		if provider.Timeout > 0 {
+			clientConfig.Timeout = time.Duration(provider.Timeout)
+		}
+		if provider.MaxRetries != nil {
+			clientConfig.MaxRetries = *provider.MaxRetries
+		}
+		providerType := chemicalimageresolver.ProviderType(provider.Name)
+		providers[providerType] = providerKinds[provider.kind()](providerType, provider.BaseURL, NewClient(clientConfig.withProviderEnv(provider.Name)))
+		order = append(order, providerType)
+	}
+	return providers, order, nil
+}
+
+// CooldownPolicies returns DefaultCooldownPolicies with the configured reasons replaced.
+func (c RegistryConfig) CooldownPolicies() chemicalimageresolver.CooldownPolicies {
+	policies := chemicalimageresolver.DefaultCooldownPolicies()
+	for kind := range policies {
+		if cooldown, ok := c.Cooldowns[kind.String()]; ok {
+			policies[kind] = chemicalimageresolver.CooldownPolicy{Initial: time.Duration(cooldown.Initial), Max: time.Duration(cooldown.Max)}
+		}
+	}
+	return policies
+}
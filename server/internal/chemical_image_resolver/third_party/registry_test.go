@@ -0,0 +1,158 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"errors"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"hydragen-v2/server/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRegistryConfigFromEnv_FileWithOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	err := os.WriteFile(path, []byte(`{
+		"providers": [
+			{"name": "chembl"},
+			{"name": "chembl-mirror", "kind": "chembl", "baseUrl": "https://mirror.example.com/chembl", "disabled": true},
+			{"name": "pubchem"},
+			{"name": "cactus", "timeout": "20s"}
+		],
+		"cooldowns": {"not_found": {"initial": "2h", "max": "48h"}}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IMAGE_PROVIDERS_CONFIG", path)
+	t.Setenv("IMAGE_PROVIDER_ORDER", "chembl-mirror,cactus,pubchem")
+	t.Setenv("IMAGE_PROVIDER_PUBCHEM_ENABLED", "false")
+	t.Setenv("IMAGE_PROVIDER_CACTUS_BASE_URL", "http://cactus.internal/structure")
+	t.Setenv("IMAGE_COOLDOWN_TRANSIENT_MAX", "30m")
+
+	config, err := RegistryConfigFromEnv()
+	if err != nil {
+		t.Fatalf("RegistryConfigFromEnv: %v", err)
+	}
+	providers, order, err := config.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if want := []chemicalimageresolver.ProviderType{"chembl-mirror", "cactus"}; !slices.Equal(order, want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	if len(providers) != len(order) {
+		t.Errorf("got %d providers for order %v", len(providers), order)
+	}
+	if mirror, ok := providers["chembl-mirror"].(*ChemblThirdPartyProvider); !ok || mirror.BaseURL != "https://mirror.example.com/chembl" {
+		t.Errorf("got mirror %#v", providers["chembl-mirror"])
+	}
+	cactus, ok := providers["cactus"].(*CactusThirdPartyProvider)
+	if !ok || cactus.BaseURL != "http://cactus.internal/structure" || cactus.Client.config.Timeout != 20*time.Second {
+		t.Errorf("got cactus %#v", providers["cactus"])
+	}
+
+	policies := config.CooldownPolicies()
+	if got := policies[chemicalimageresolver.ProviderErrorNotFound]; got.Initial != 2*time.Hour || got.Max != 48*time.Hour {
+		t.Errorf("got not_found policy %+v", got)
+	}
+	if got := policies[chemicalimageresolver.ProviderErrorTransient]; got.Initial != time.Minute || got.Max != 30*time.Minute {
+		t.Errorf("got transient policy %+v", got)
+	}
+	if got, want := policies[chemicalimageresolver.ProviderErrorRateLimited], chemicalimageresolver.DefaultCooldownPolicies()[chemicalimageresolver.ProviderErrorRateLimited]; got != want {
+		t.Errorf("got rate_limited policy %+v, want default %+v", got, want)
+	}
+}
+
+func TestRegistryConfig_ClientSettingPrecedence(t *testing.T) {
+	maxRetries := 0
+	config := RegistryConfig{Providers: []ProviderConfig{
+		{Name: "chembl"},
+		{Name: "pubchem", Timeout: Duration(15 * time.Second)},
+		{Name: "cactus", Timeout: Duration(20 * time.Second), MaxRetries: &maxRetries},
+	}}
+	t.Setenv("IMAGE_PROVIDER_TIMEOUT", "5s")
+	t.Setenv("IMAGE_PROVIDER_MAX_RETRIES", "4")
+	t.Setenv("IMAGE_PROVIDER_PUBCHEM_TIMEOUT", "30s")
+
+	providers, _, err := config.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	tests := []struct {
+		provider   chemicalimageresolver.ProviderType
+		client     *Client
+		timeout    time.Duration
+		maxRetries int
+	}{
+		// Global variables fill in what the file leaves unset...
+		{provider: "chembl", client: providers["chembl"].(*ChemblThirdPartyProvider).Client, timeout: 5 * time.Second, maxRetries: 4},
+		// ...provider-scoped ones override the file...
+		{provider: "pubchem", client: providers["pubchem"].(*PubchemThirdPartyProvider).Client, timeout: 30 * time.Second, maxRetries: 4},
+		// ...and the file overrides global variables.
+		{provider: "cactus", client: providers["cactus"].(*CactusThirdPartyProvider).Client, timeout: 20 * time.Second, maxRetries: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.client.config; got.Timeout != tt.timeout || got.MaxRetries != tt.maxRetries {
+			t.Errorf("%s: got timeout %v and %d retries, want %v and %d", tt.provider, got.Timeout, got.MaxRetries, tt.timeout, tt.maxRetries)
+		}
+	}
+}
+
+func TestRegistryConfig_ExampleFileLoads(t *testing.T) {
+	config, err := LoadRegistryConfig("../../../../image-providers.example.json")
+	if err != nil {
+		t.Fatalf("LoadRegistryConfig: %v", err)
+	}
+	if _, order, err := config.Build(); err != nil || len(order) != 3 {
+		t.Errorf("got order %v, error %v", order, err)
+	}
+}
+
+func TestRegistryConfig_Validate(t *testing.T) {
+	tests := map[string]RegistryConfig{
+		"unknown kind":      {Providers: []ProviderConfig{{Name: "chemspider"}}},
+		"duplicate name":    {Providers: []ProviderConfig{{Name: "chembl"}, {Name: "chembl"}}},
+		"relative base url": {Providers: []ProviderConfig{{Name: "cactus", BaseURL: "cactus.internal"}}},
+		"unknown reason":    {Cooldowns: map[string]CooldownConfig{"gone": {Initial: Duration(time.Hour), Max: Duration(time.Hour)}}},
+		"max below initial": {Cooldowns: map[string]CooldownConfig{"not_found": {Initial: Duration(time.Hour), Max: Duration(time.Minute)}}},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := config.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if err := DefaultRegistryConfig().Validate(); err != nil {
+		t.Errorf("default config: %v", err)
+	}
+}
+
+func TestRegistryConfig_MirrorsReportTheirOwnName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	maxRetries := 0
+	config := RegistryConfig{Providers: []ProviderConfig{
+		{Name: "chembl-mirror", Kind: "chembl", BaseURL: server.URL, MaxRetries: &maxRetries},
+		{Name: "pubchem-mirror", Kind: "pubchem", BaseURL: server.URL, MaxRetries: &maxRetries},
+		{Name: "cactus-mirror", Kind: "cactus", BaseURL: server.URL, MaxRetries: &maxRetries},
+	}}
+	providers, order, err := config.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for _, name := range order {
+		_, err := providers[name].FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+		var providerErr *chemicalimageresolver.ProviderError
+		if !errors.As(err, &providerErr) || providerErr.Provider != name {
+			t.Errorf("%s: got %v, want an error naming the mirror", name, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidImage marks payloads that are not a usable structure image (HTML error pages, truncated
+// or tiny placeholder images). The resolver treats it like any other provider failure.
+var ErrInvalidImage = errors.New("invalid image payload")
+
+// minImageDimension rejects spacer/placeholder images; real structure depictions are far larger.
+const minImageDimension = 16
+
+// maxImagePixels bounds the rasters that are fully decoded, since a small compressed body can
+// declare huge dimensions.
+const maxImagePixels = 25_000_000
+
+var rasterSignatures = []struct {
+	magic    []byte
+	mimeType chemicalimageresolver.MimeType
+}{
+	{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{[]byte("GIF87a"), "image/gif"},
+	{[]byte("GIF89a"), "image/gif"},
+	{[]byte{0xFF, 0xD8, 0xFF}, "image/jpeg"},
+}
+
+// sniffImage identifies body by its content rather than the Content-Type header, checks that it
+// fully decodes (rasters, so truncated or corrupt pixel data is rejected) or is well-formed with an
+// <svg> root (SVG), and enforces minimum dimensions.
+func sniffImage(body []byte) (*chemicalimageresolver.Image, error) {
+	for _, sig := range rasterSignatures {
+		if bytes.HasPrefix(body, sig.magic) {
+			config, _, err := image.DecodeConfig(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidImage, sig.mimeType, err)
+			}
+			if err := checkDimensions(float64(config.Width), float64(config.Height)); err != nil {
+				return nil, err
+			}
+			if config.Width*config.Height > maxImagePixels {
+				return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrInvalidImage, config.Width, config.Height, maxImagePixels)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(body)); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidImage, sig.mimeType, err)
+			}
+			return &chemicalimageresolver.Image{Bytes: body, MimeType: sig.mimeType}, nil
+		}
+	}
+	if err := validateSVG(body); err != nil {
+		return nil, err
+	}
+	return &chemicalimageresolver.Image{Bytes: body, MimeType: "image/svg+xml"}, nil
+}
+
+func checkDimensions(width float64, height float64) error {
+	if width < minImageDimension || height < minImageDimension {
+		return fmt.Errorf("%w: %gx%g is smaller than %dx%d", ErrInvalidImage, width, height, minImageDimension, minImageDimension)
+	}
+	return nil
+}
+
+// validateSVG parses the whole document, so truncated or non-XML bodies (e.g. HTML) are rejected.
+// Dimensions come from width/height, falling back to the viewBox; an SVG declaring neither scales
+// freely and is accepted.
+func validateSVG(body []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = true
+	sawRoot := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: malformed SVG: %v", ErrInvalidImage, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || sawRoot {
+			continue
+		}
+		sawRoot = true
+		if start.Name.Local != "svg" {
+			return fmt.Errorf("%w: root element is <%s>, not <svg>", ErrInvalidImage, start.Name.Local)
+		}
+		if err := checkSVGDimensions(start.Attr); err != nil {
+			return err
+		}
+	}
+	if !sawRoot {
+		return fmt.Errorf("%w: empty document", ErrInvalidImage)
+	}
+	return nil
+}
+
+func checkSVGDimensions(attrs []xml.Attr) error {
+	var width, height, viewBox string
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "viewBox":
+			viewBox = attr.Value
+		}
+	}
+	w, wOK := svgLength(width)
+	h, hOK := svgLength(height)
+	if wOK && hOK {
+		return checkDimensions(w, h)
+	}
+	fields := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+	if len(fields) == 4 {
+		w, errW := strconv.ParseFloat(fields[2], 64)
+		h, errH := strconv.ParseFloat(fields[3], 64)
+		if errW == nil && errH == nil {
+			return checkDimensions(w, h)
+		}
+	}
+	return nil
+}
+
+// svgLength parses absolute lengths such as "300", "300px" or "300.5". Relative units (%, em)
+// say nothing about the drawing size and are ignored.
+func svgLength(value string) (float64, bool) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+	n, err := strconv.ParseFloat(value, 64)
+	return n, err == nil
+}
@@ -0,0 +1,89 @@
+package chemicalimageresolver_thirdparty
+
+import (
+	"bytes"
+	"errors"
+	"hydragen-v2/server/internal/domain"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testRaster(t *testing.T, format string, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	img := image.NewPaletted(image.Rect(0, 0, width, height), []color.Color{color.White, color.Black})
+	var err error
+	if format == "gif" {
+		err = gif.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniffImage(t *testing.T) {
+	png := testRaster(t, "png", 300, 300)
+	gif := testRaster(t, "gif", 100, 80)
+	// Flipping a byte of the compressed pixel data breaks the IDAT chunk's checksum.
+	corruptPNG := bytes.Clone(png)
+	corruptPNG[bytes.Index(png, []byte("IDAT"))+8] ^= 0xFF
+	tests := []struct {
+		name     string
+		body     []byte
+		wantMime string
+	}{
+		{name: "png", body: png, wantMime: "image/png"},
+		{name: "gif", body: gif, wantMime: "image/gif"},
+		{name: "svg", body: []byte(`<?xml version="1.0"?><!DOCTYPE svg><svg xmlns="http://www.w3.org/2000/svg" width="300px" height="300px"><path d="M0 0"/></svg>`), wantMime: "image/svg+xml"},
+		{name: "svg viewBox only", body: []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 150"/>`), wantMime: "image/svg+xml"},
+		{name: "html error page", body: []byte(`<html><body><h1>Page not found</h1></body></html>`)},
+		{name: "not markup", body: []byte("Internal Server Error")},
+		{name: "truncated svg", body: []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300"><g>`)},
+		{name: "tiny svg", body: []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"/>`)},
+		{name: "tiny png", body: testRaster(t, "png", 1, 1)},
+		{name: "truncated png header", body: png[:20]},
+		{name: "truncated png pixel data", body: png[:len(png)-20]},
+		{name: "corrupt png pixel data", body: corruptPNG},
+		{name: "truncated gif", body: gif[:len(gif)-10]},
+		{name: "huge png", body: testRaster(t, "png", 6000, 6000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := sniffImage(tt.body)
+			if tt.wantMime == "" {
+				if !errors.Is(err, ErrInvalidImage) {
+					t.Errorf("got %v, want ErrInvalidImage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sniffImage: %v", err)
+			}
+			if string(img.MimeType) != tt.wantMime {
+				t.Errorf("got mime type %q, want %q", img.MimeType, tt.wantMime)
+			}
+		})
+	}
+}
+
+func TestCactus_RejectsHTMLServedAsImage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write([]byte("<html><body>Error</body></html>"))
+	}))
+	defer server.Close()
+
+	provider := &CactusThirdPartyProvider{BaseURL: server.URL, Client: testClient(DefaultClientConfig())}
+	_, err := provider.FetchImage(t.Context(), domain.CompoundMetadata{InchiKey: testInchiKey})
+	if !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("got %v, want ErrInvalidImage", err)
+	}
+}
@@ -9,6 +9,22 @@ type MetadataStore interface {
 	List(ctx context.Context, page int, pageSize int) ([]domain.CompoundMetadata, error)
 	Count(ctx context.Context) (int, error)
 	Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error)
+	ListBySkeleton(ctx context.Context, skeleton string) ([]domain.CompoundMetadata, error)
+	ListRelated(ctx context.Context, skeleton string) ([]domain.RelatedCompound, error)
+	Search(ctx context.Context, query string, page int, pageSize int) ([]domain.CompoundMetadata, error)
+	SearchCount(ctx context.Context, query string) (int, error)
+	Synonyms(ctx context.Context, inchiKey string) ([]string, error)
+	Identifiers(ctx context.Context, inchiKey string) (map[string][]string, error)
+	MetadataWriteStore
+}
+
+// RelatedGroup collects every compound sharing one InChIKey skeleton together with the
+// merged spectrum counts, so spectra recorded under a sibling key are not missed.
+type RelatedGroup struct {
+	Skeleton            string                   `json:"skeleton"`
+	TotalSpectrumCount  int                      `json:"totalSpectrumCount"`
+	VariantsWithSpectra int                      `json:"variantsWithSpectra"`
+	Items               []domain.RelatedCompound `json:"items"`
 }
 
 type Service struct {
@@ -34,11 +50,65 @@ func (s *Service) Count(ctx context.Context) (int, error) {
 	return s.store.Count(ctx)
 }
 
+// Get returns a compound with its synonyms and external identifiers.
 func (s *Service) Get(ctx context.Context, inchiKey string) (*domain.CompoundMetadata, error) {
 	record, err := s.store.Get(ctx, inchiKey)
 	if err != nil {
 		return nil, err
 	}
+	record.Synonyms, err = s.store.Synonyms(ctx, inchiKey)
+	if err != nil {
+		return nil, err
+	}
+	record.Identifiers, err = s.store.Identifiers(ctx, inchiKey)
+	if err != nil {
+		return nil, err
+	}
 	record.AddImageUrl()
 	return record, nil
 }
+
+// Search matches compounds by InChIKey, external identifier (CAS, PubChem CID, ...), name or synonym.
+func (s *Service) Search(ctx context.Context, query string, page int, pageSize int) ([]domain.CompoundMetadata, error) {
+	compounds, err := s.store.Search(ctx, query, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range compounds {
+		compounds[i].AddImageUrl()
+	}
+	return compounds, nil
+}
+
+func (s *Service) SearchCount(ctx context.Context, query string) (int, error) {
+	return s.store.SearchCount(ctx, query)
+}
+
+// ListBySkeleton returns every compound whose InChIKey starts with the given first block,
+// i.e. all stereoisomers and protonation variants of one connectivity skeleton.
+func (s *Service) ListBySkeleton(ctx context.Context, skeleton string) ([]domain.CompoundMetadata, error) {
+	compounds, err := s.store.ListBySkeleton(ctx, skeleton)
+	if err != nil {
+		return nil, err
+	}
+	for i := range compounds {
+		compounds[i].AddImageUrl()
+	}
+	return compounds, nil
+}
+
+func (s *Service) Related(ctx context.Context, skeleton string) (*RelatedGroup, error) {
+	compounds, err := s.store.ListRelated(ctx, skeleton)
+	if err != nil {
+		return nil, err
+	}
+	group := &RelatedGroup{Skeleton: skeleton, Items: compounds}
+	for i := range group.Items {
+		group.Items[i].AddImageUrl()
+		group.TotalSpectrumCount += group.Items[i].SpectrumCount
+		if group.Items[i].SpectrumCount > 0 {
+			group.VariantsWithSpectra++
+		}
+	}
+	return group, nil
+}
@@ -0,0 +1,63 @@
+package compoundmetadatastore
+
+import (
+	"context"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/inchikey"
+	"strings"
+)
+
+type MetadataWriteStore interface {
+	Create(ctx context.Context, c domain.CompoundMetadata) error
+	Update(ctx context.Context, c domain.CompoundMetadata) error
+	Delete(ctx context.Context, inchiKey string) error
+}
+
+// ValidateCompound normalizes the identifying fields of c in place and checks the rest.
+func ValidateCompound(c *domain.CompoundMetadata) error {
+	key, err := inchikey.NormalizeFull(c.InchiKey)
+	if err != nil {
+		return &domain.ValidationError{Field: "inchiKey", Message: err.Error()}
+	}
+	c.InchiKey = key
+	c.Name = strings.TrimSpace(c.Name)
+	c.Inchi = strings.TrimSpace(c.Inchi)
+	c.Smiles = strings.TrimSpace(c.Smiles)
+	c.Formula = strings.TrimSpace(c.Formula)
+
+	if c.Name == "" {
+		return &domain.ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if !strings.HasPrefix(c.Inchi, "InChI=") {
+		return &domain.ValidationError{Field: "inchi", Message: `must start with "InChI="`}
+	}
+	if c.Smiles == "" {
+		return &domain.ValidationError{Field: "smiles", Message: "must not be empty"}
+	}
+	return domain.ValidateFormula(c.Formula)
+}
+
+func (s *Service) Create(ctx context.Context, c domain.CompoundMetadata) (*domain.CompoundMetadata, error) {
+	if err := ValidateCompound(&c); err != nil {
+		return nil, err
+	}
+	if err := s.store.Create(ctx, c); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, c.InchiKey)
+}
+
+func (s *Service) Update(ctx context.Context, c domain.CompoundMetadata) (*domain.CompoundMetadata, error) {
+	if err := ValidateCompound(&c); err != nil {
+		return nil, err
+	}
+	if err := s.store.Update(ctx, c); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, c.InchiKey)
+}
+
+// Delete removes a compound and all of its mass spectra.
+func (s *Service) Delete(ctx context.Context, inchiKey string) error {
+	return s.store.Delete(ctx, inchiKey)
+}
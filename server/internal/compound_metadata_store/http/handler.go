@@ -7,9 +7,11 @@ import (
 	compoundmetadatastore "hydragen-v2/server/internal/compound_metadata_store/core"
 	"hydragen-v2/server/internal/domain"
 	"hydragen-v2/server/internal/http_helper"
+	"hydragen-v2/server/internal/inchikey"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +23,12 @@ func NewHandler(service *compoundmetadatastore.Service) *Handler {
 	return &Handler{service: *service}
 }
 
+type compoundsBySkeletonResponse struct {
+	Skeleton string                    `json:"skeleton"`
+	Count    int                       `json:"count"`
+	Items    []domain.CompoundMetadata `json:"items"`
+}
+
 type compoundsListResponse struct {
 	Items    []domain.CompoundMetadata `json:"items"`
 	Page     int                       `json:"page"`
@@ -42,24 +50,38 @@ func parsePositiveInt(value string, fallback int) int {
 func (h *Handler) GetCompoundListHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	slog.Info("[GetCompoundListHandler]: start", "method", r.Method, "path", r.URL.Path, "rawQuery", r.URL.RawQuery)
-	defer slog.Info("[GetCompoundListHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	defer func() {
+		slog.Info("[GetCompoundListHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
 
 	query := r.URL.Query()
 	page := parsePositiveInt(query.Get("page"), 1)
 	pageSize := parsePositiveInt(query.Get("pageSize"), 20)
+	search := strings.TrimSpace(query.Get("q"))
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	compounds, err := h.service.List(ctx, page, pageSize)
+	var compounds []domain.CompoundMetadata
+	var err error
+	if search != "" {
+		compounds, err = h.service.Search(ctx, search, page, pageSize)
+	} else {
+		compounds, err = h.service.List(ctx, page, pageSize)
+	}
 	if err != nil {
-		slog.Error("[GetCompoundListHandler]: service.List error", "error", err, "page", page, "pageSize", pageSize)
+		slog.Error("[GetCompoundListHandler]: service.List error", "error", err, "page", page, "pageSize", pageSize, "q", search)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	count, err := h.service.Count(ctx)
+	var count int
+	if search != "" {
+		count, err = h.service.SearchCount(ctx, search)
+	} else {
+		count, err = h.service.Count(ctx)
+	}
 	if err != nil {
-		slog.Error("[GetCompoundListHandler]: db.ListCompounds error", "error", err, "page", page, "pageSize", pageSize)
+		slog.Error("[GetCompoundListHandler]: db.ListCompounds error", "error", err, "page", page, "pageSize", pageSize, "q", search)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -72,18 +94,24 @@ func (h *Handler) GetCompoundListHandler(w http.ResponseWriter, r *http.Request)
 func (h *Handler) GetCompoundDetailHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	slog.Info("[GetCompoundDetailHandler]: start", "method", r.Method, "path", r.URL.Path)
-	defer slog.Info("[GetCompoundDetailHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	defer func() {
+		slog.Info("[GetCompoundDetailHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
 
-	inchiKey := r.PathValue("inchiKey")
-	if inchiKey == "" {
-		slog.Error("[GetCompoundDetailHandler]: Empty inchiKey", "inchiKey", inchiKey)
-		http.NotFound(w, r)
+	inchiKey, ok := http_helper.PathInchiKey(w, r, true)
+	if !ok {
+		slog.Error("[GetCompoundDetailHandler]: Invalid inchiKey", "inchiKey", r.PathValue("inchiKey"))
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	if inchikey.IsSkeleton(inchiKey) {
+		h.getCompoundsBySkeleton(ctx, w, r, inchiKey)
+		return
+	}
+
 	record, err := h.service.Get(ctx, inchiKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -99,3 +127,58 @@ func (h *Handler) GetCompoundDetailHandler(w http.ResponseWriter, r *http.Reques
 	slog.Info("[GetCompoundDetailHandler]: successful response", "inchiKey", inchiKey)
 	http_helper.WriteJSON(w, http.StatusOK, record)
 }
+
+func (h *Handler) getCompoundsBySkeleton(ctx context.Context, w http.ResponseWriter, r *http.Request, skeleton string) {
+	compounds, err := h.service.ListBySkeleton(ctx, skeleton)
+	if err != nil {
+		slog.Error("[GetCompoundDetailHandler]: ListBySkeleton error", "skeleton", skeleton, "error", err)
+		http_helper.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(compounds) == 0 {
+		slog.Error("[GetCompoundDetailHandler]: No compounds found for skeleton", "skeleton", skeleton)
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Info("[GetCompoundDetailHandler]: successful skeleton response", "skeleton", skeleton, "count", len(compounds))
+	http_helper.WriteJSON(w, http.StatusOK, compoundsBySkeletonResponse{Skeleton: skeleton, Count: len(compounds), Items: compounds})
+}
+
+type relatedCompoundsResponse struct {
+	InchiKey string `json:"inchiKey"`
+	compoundmetadatastore.RelatedGroup
+}
+
+func (h *Handler) GetRelatedCompoundsHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[GetRelatedCompoundsHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[GetRelatedCompoundsHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	inchiKey, ok := http_helper.PathInchiKey(w, r, true)
+	if !ok {
+		slog.Error("[GetRelatedCompoundsHandler]: Invalid inchiKey", "inchiKey", r.PathValue("inchiKey"))
+		return
+	}
+	skeleton := inchikey.Skeleton(inchiKey)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	group, err := h.service.Related(ctx, skeleton)
+	if err != nil {
+		slog.Error("[GetRelatedCompoundsHandler]: service.Related error", "skeleton", skeleton, "error", err)
+		http_helper.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(group.Items) == 0 {
+		slog.Error("[GetRelatedCompoundsHandler]: No compounds found for skeleton", "skeleton", skeleton)
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Info("[GetRelatedCompoundsHandler]: successful response", "skeleton", skeleton, "count", len(group.Items), "totalSpectrumCount", group.TotalSpectrumCount)
+	http_helper.WriteJSON(w, http.StatusOK, relatedCompoundsResponse{InchiKey: inchiKey, RelatedGroup: *group})
+}
@@ -0,0 +1,119 @@
+package compoundmetadatastore_http
+
+import (
+	"context"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/http_helper"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type compoundWriteRequest struct {
+	InchiKey string `json:"inchiKey"`
+	Name     string `json:"name"`
+	Inchi    string `json:"inchi"`
+	Smiles   string `json:"smiles"`
+	Formula  string `json:"formula"`
+}
+
+func (req compoundWriteRequest) toDomain() domain.CompoundMetadata {
+	return domain.CompoundMetadata{
+		InchiKey: req.InchiKey,
+		Name:     req.Name,
+		Inchi:    req.Inchi,
+		Smiles:   req.Smiles,
+		Formula:  req.Formula,
+	}
+}
+
+func (h *Handler) CreateCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[CreateCompoundHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[CreateCompoundHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	var req compoundWriteRequest
+	if err := http_helper.ReadJSON(w, r, &req); err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	record, err := h.service.Create(ctx, req.toDomain())
+	if err != nil {
+		slog.Error("[CreateCompoundHandler]: service.Create error", "inchiKey", req.InchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[CreateCompoundHandler]: compound created", "inchiKey", record.InchiKey)
+	http_helper.WriteJSON(w, http.StatusCreated, record)
+}
+
+func (h *Handler) UpdateCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[UpdateCompoundHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[UpdateCompoundHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req compoundWriteRequest
+	if err := http_helper.ReadJSON(w, r, &req); err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.InchiKey != "" && !strings.EqualFold(strings.TrimSpace(req.InchiKey), inchiKey) {
+		http_helper.WriteError(w, http.StatusBadRequest, fmt.Errorf("inchiKey in body (%s) does not match path (%s)", req.InchiKey, inchiKey))
+		return
+	}
+	req.InchiKey = inchiKey
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	record, err := h.service.Update(ctx, req.toDomain())
+	if err != nil {
+		slog.Error("[UpdateCompoundHandler]: service.Update error", "inchiKey", inchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[UpdateCompoundHandler]: compound updated", "inchiKey", inchiKey)
+	http_helper.WriteJSON(w, http.StatusOK, record)
+}
+
+func (h *Handler) DeleteCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[DeleteCompoundHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[DeleteCompoundHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.service.Delete(ctx, inchiKey); err != nil {
+		slog.Error("[DeleteCompoundHandler]: service.Delete error", "inchiKey", inchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[DeleteCompoundHandler]: compound deleted", "inchiKey", inchiKey)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -11,8 +11,19 @@ type CompoundMetadata struct {
 	MolecularWeight *float64 `json:"molecularWeight"`
 	HasMassSpectrum bool     `json:"hasMassSpectrum"`
 	ImageUrl        string   `json:"imageUrl"`
+
+	// Only populated on detail lookups.
+	Synonyms    []string            `json:"synonyms,omitempty"`
+	Identifiers map[string][]string `json:"identifiers,omitempty"`
 }
 
+// Identifier kinds (compound_identifiers.kind) whose values are stored without the prefix users
+// type, so search has to strip it. Other kinds keep theirs, e.g. CHEMBL25 or HMDB0001879.
+const (
+	IdentifierPubchemCID = "pubchem_cid"
+	IdentifierChEBI      = "chebi"
+)
+
 func (c *CompoundMetadata) AddImageUrl() {
 	c.ImageUrl = origin.BACKEND_URL_PREFIX + "compounds/" + c.InchiKey + "/image"
 }
@@ -35,3 +46,10 @@ func NewCompoundMetadata(
 	c.AddImageUrl()
 	return c
 }
+
+// RelatedCompound is a compound sharing an InChIKey skeleton (first block) with another,
+// e.g. a stereoisomer, tautomer or protonation variant.
+type RelatedCompound struct {
+	CompoundMetadata
+	SpectrumCount int `json:"spectrumCount"`
+}
@@ -1,5 +1,8 @@
 package domain
 
+// MZ_SCALE is the factor m/z values are multiplied by to be stored as int4.
+const MZ_SCALE = 10000
+
 type MassSpectraRecord struct {
 	ID              int64     `json:"id"`
 	InchiKey        string    `json:"inchiKey"`
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrConflict = errors.New("conflicts with an existing record")
+	ErrReadOnly = errors.New("store is read-only")
+)
+
+// ValidationError reports an invalid field in a write request.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+var elementSymbols = map[string]bool{}
+
+func init() {
+	const symbols = "H He Li Be B C N O F Ne Na Mg Al Si P S Cl Ar K Ca Sc Ti V Cr Mn Fe Co Ni Cu Zn Ga Ge As Se Br Kr " +
+		"Rb Sr Y Zr Nb Mo Tc Ru Rh Pd Ag Cd In Sn Sb Te I Xe Cs Ba La Ce Pr Nd Pm Sm Eu Gd Tb Dy Ho Er Tm Yb Lu " +
+		"Hf Ta W Re Os Ir Pt Au Hg Tl Pb Bi Po At Rn Fr Ra Ac Th Pa U Np Pu Am Cm Bk Cf Es Fm Md No Lr " +
+		"Rf Db Sg Bh Hs Mt Ds Rg Cn Nh Fl Mc Lv Ts Og D T"
+	for _, symbol := range strings.Fields(symbols) {
+		elementSymbols[symbol] = true
+	}
+}
+
+var (
+	// One component of a (possibly dotted, e.g. hydrate) formula with an optional charge suffix.
+	formulaComponentPattern = regexp.MustCompile(`^\d*((?:\[\d+[A-Z][a-z]?\]|[A-Z][a-z]?)\d*)+(?:[+-]\d*|\d*[+-])?$`)
+	formulaElementPattern   = regexp.MustCompile(`\[\d+([A-Z][a-z]?)\]|([A-Z][a-z]?)`)
+)
+
+// ValidateFormula checks that formula is a molecular formula made of known element symbols,
+// e.g. "C6H12O6", "C2H3O2-", "CuSO4.5H2O" or "[13C]H4".
+func ValidateFormula(formula string) error {
+	if strings.TrimSpace(formula) == "" {
+		return &ValidationError{Field: "formula", Message: "must not be empty"}
+	}
+	for _, component := range strings.Split(formula, ".") {
+		if !formulaComponentPattern.MatchString(component) {
+			return &ValidationError{Field: "formula", Message: "malformed molecular formula " + `"` + formula + `"`}
+		}
+		for _, match := range formulaElementPattern.FindAllStringSubmatch(component, -1) {
+			symbol := match[1] + match[2]
+			if !elementSymbols[symbol] {
+				return &ValidationError{Field: "formula", Message: "unknown element " + `"` + symbol + `"`}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "testing"
+
+func TestValidateFormula(t *testing.T) {
+	valid := []string{"CH4O", "C6H12O6", "C2H3O2-", "C9H14N+", "CuSO4.5H2O", "[13C]H4", "C20H25N3O", "Cl2"}
+	for _, formula := range valid {
+		if err := ValidateFormula(formula); err != nil {
+			t.Errorf("ValidateFormula(%q): unexpected error %v", formula, err)
+		}
+	}
+
+	invalid := []string{"", "   ", "c6h12o6", "C6H12O6 ", "Xx2", "C6H12(O6", "<svg>", "C6..H6"}
+	for _, formula := range invalid {
+		if err := ValidateFormula(formula); err == nil {
+			t.Errorf("ValidateFormula(%q): expected error", formula)
+		}
+	}
+}
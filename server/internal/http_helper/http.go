@@ -1,7 +1,12 @@
 package http_helper
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/inchikey"
 	"log"
 	"net/http"
 )
@@ -21,11 +26,41 @@ func WriteError(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
 }
 
+const maxJSONBodyBytes = 10 << 20
+
+// ReadJSON decodes a JSON request body into dst, rejecting unknown fields and bodies over 10 MiB.
+func ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+// WriteStoreError maps errors from a store write (validation, missing row, conflict) to a status code.
+func WriteStoreError(w http.ResponseWriter, err error) {
+	var validationErr *domain.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		WriteError(w, http.StatusBadRequest, err)
+	case errors.Is(err, sql.ErrNoRows):
+		WriteError(w, http.StatusNotFound, errors.New("not found"))
+	case errors.Is(err, domain.ErrConflict):
+		WriteError(w, http.StatusConflict, err)
+	case errors.Is(err, domain.ErrReadOnly):
+		WriteError(w, http.StatusServiceUnavailable, err)
+	default:
+		WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
 func WithCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-None-Match, If-Modified-Since")
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, ETag, X-Image-Placeholder, X-Image-Provider, X-Image-Cache")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -33,3 +68,18 @@ func WithCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// PathInchiKey reads and normalizes the {inchiKey} path value. When it is not a valid
+// InChIKey (or a skeleton block while allowSkeleton is false) a 400 is written and ok is false.
+func PathInchiKey(w http.ResponseWriter, r *http.Request, allowSkeleton bool) (key string, ok bool) {
+	normalize := inchikey.NormalizeFull
+	if allowSkeleton {
+		normalize = inchikey.Normalize
+	}
+	key, err := normalize(r.PathValue("inchiKey"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	return key, true
+}
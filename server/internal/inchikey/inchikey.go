@@ -0,0 +1,117 @@
+package inchikey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// An InChIKey looks like "XLYOFNOQVPJJNP-UHFFFAOYSA-N":
+//
+//	block 1 (14 chars): hash of the connectivity layer (the "skeleton")
+//	block 2 (10 chars): 8 chars hash of the remaining layers, 1 char flag (S/N), 1 char version (A)
+//	block 3 (1 char):   protonation indicator (N = neutral)
+const (
+	Length         = 27
+	SkeletonLength = 14
+)
+
+var ErrEmpty = errors.New("InChIKey is empty")
+
+type InvalidError struct {
+	Key    string
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("invalid InChIKey %q: %s", e.Key, e.Reason)
+}
+
+// Normalize trims and upper-cases raw, then validates it as either a full InChIKey
+// or a 14-character skeleton block.
+func Normalize(raw string) (string, error) {
+	key := strings.ToUpper(strings.TrimSpace(raw))
+	if key == "" {
+		return "", ErrEmpty
+	}
+	if len(key) == SkeletonLength {
+		if err := validateHashBlock(key); err != nil {
+			return "", &InvalidError{Key: raw, Reason: "skeleton block " + err.Error()}
+		}
+		return key, nil
+	}
+	if err := validateFull(key); err != nil {
+		return "", &InvalidError{Key: raw, Reason: err.Error()}
+	}
+	return key, nil
+}
+
+// NormalizeFull is like Normalize but rejects skeleton blocks.
+func NormalizeFull(raw string) (string, error) {
+	key, err := Normalize(raw)
+	if err != nil {
+		return "", err
+	}
+	if IsSkeleton(key) {
+		return "", &InvalidError{Key: raw, Reason: fmt.Sprintf("expected a full %d-character InChIKey, got a skeleton block", Length)}
+	}
+	return key, nil
+}
+
+// IsSkeleton reports whether a normalized key is only the first (connectivity) block.
+func IsSkeleton(key string) bool {
+	return len(key) == SkeletonLength
+}
+
+// Skeleton returns the first block of a normalized key.
+func Skeleton(key string) string {
+	if len(key) < SkeletonLength {
+		return key
+	}
+	return key[:SkeletonLength]
+}
+
+func validateFull(key string) error {
+	if len(key) != Length {
+		return fmt.Errorf("expected %d characters (or a %d-character skeleton block), got %d", Length, SkeletonLength, len(key))
+	}
+	if key[14] != '-' || key[25] != '-' {
+		return errors.New("expected '-' separators at positions 15 and 26")
+	}
+	if err := validateHashBlock(key[0:14]); err != nil {
+		return fmt.Errorf("first block %w", err)
+	}
+	if err := validateHashBlock(key[15:23]); err != nil {
+		return fmt.Errorf("second block %w", err)
+	}
+	if flag := key[23]; flag != 'S' && flag != 'N' {
+		return fmt.Errorf("expected standard flag 'S' or 'N' at position 24, got %q", flag)
+	}
+	if version := key[24]; version != 'A' {
+		return fmt.Errorf("expected version character 'A' at position 25, got %q", version)
+	}
+	if !isUpperLetter(key[26]) {
+		return fmt.Errorf("expected protonation character A-Z at position 27, got %q", key[26])
+	}
+	return nil
+}
+
+// validateHashBlock checks a base-26 hash block: uppercase letters only, encoded as
+// triplets followed by a trailing doublet, where no triplet may start with 'E'.
+func validateHashBlock(block string) error {
+	for i := 0; i < len(block); i++ {
+		if !isUpperLetter(block[i]) {
+			return fmt.Errorf("must contain only letters A-Z, got %q at offset %d", block[i], i)
+		}
+	}
+	for i := 0; i+3 <= len(block)-2; i += 3 {
+		if block[i] == 'E' {
+			return fmt.Errorf("has a triplet starting with 'E' at offset %d", i)
+		}
+	}
+	return nil
+}
+
+func isUpperLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,54 @@
+package inchikey
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{name: "full key", raw: "XLYOFNOQVPJJNP-UHFFFAOYSA-N", want: "XLYOFNOQVPJJNP-UHFFFAOYSA-N"},
+		{name: "whitespace and lowercase", raw: "  xlyofnoqvpjjnp-uhfffaoysa-n\n", want: "XLYOFNOQVPJJNP-UHFFFAOYSA-N"},
+		{name: "non-standard flag", raw: "XLYOFNOQVPJJNP-UHFFFAOYNA-M", want: "XLYOFNOQVPJJNP-UHFFFAOYNA-M"},
+		{name: "skeleton block", raw: "xlyofnoqvpjjnp", want: "XLYOFNOQVPJJNP"},
+		{name: "too short", raw: "XLYOFNOQVPJJNP-UHFF", wantErr: true},
+		{name: "missing separator", raw: "XLYOFNOQVPJJNPXUHFFFAOYSA-N", wantErr: true},
+		{name: "digit in block", raw: "XLYOFNOQVPJJN1-UHFFFAOYSA-N", wantErr: true},
+		{name: "triplet starting with E", raw: "XLYEFNOQVPJJNP-UHFFFAOYSA-N", wantErr: true},
+		{name: "bad flag", raw: "XLYOFNOQVPJJNP-UHFFFAOYXA-N", wantErr: true},
+		{name: "bad version", raw: "XLYOFNOQVPJJNP-UHFFFAOYSB-N", wantErr: true},
+		{name: "bad protonation", raw: "XLYOFNOQVPJJNP-UHFFFAOYSA-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.raw)
+			if tt.wantErr {
+				var invalid *InvalidError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("Normalize(%q): expected InvalidError, got %v", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeFull_RejectsSkeleton(t *testing.T) {
+	if _, err := NormalizeFull("XLYOFNOQVPJJNP"); err == nil {
+		t.Fatal("expected skeleton block to be rejected")
+	}
+	if _, err := NormalizeFull(" "); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+}
@@ -8,10 +8,18 @@ import (
 
 type MassSpecStore interface {
 	GetSpectra(ctx context.Context, inchiKey string) ([]domain.MassSpectraRecord, error)
+	GetSpectraBySkeleton(ctx context.Context, skeleton string) ([]domain.MassSpectraRecord, error)
+	CreateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (int64, error)
+	UpdateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) error
+	DeleteSpectrum(ctx context.Context, inchiKey string, id int64) error
 }
 
 type Service interface {
 	GetSpectra(ctx context.Context, inchiKey string) ([]domain.MassSpectraRecord, error)
+	GetSpectraBySkeleton(ctx context.Context, skeleton string) ([]domain.MassSpectraRecord, error)
+	CreateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (*domain.MassSpectraRecord, error)
+	UpdateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (*domain.MassSpectraRecord, error)
+	DeleteSpectrum(ctx context.Context, inchiKey string, id int64) error
 }
 
 type MassSpectraCrudService struct {
@@ -29,11 +37,56 @@ func (h *MassSpectraCrudService) GetSpectra(ctx context.Context, inchiKey string
 		return nil, err
 	}
 
+	return fillInMissingMz(spectra), nil
+}
+
+func (h *MassSpectraCrudService) GetSpectraBySkeleton(ctx context.Context, skeleton string) ([]domain.MassSpectraRecord, error) {
+	spectra, err := h.store.GetSpectraBySkeleton(ctx, skeleton)
+	if err != nil {
+		slog.Error("[MassSpecCrudHandler.GetSpectraBySkeleton] failed to retrieve spectra", "skeleton", skeleton, "error", err)
+		return nil, err
+	}
+	return fillInMissingMz(spectra), nil
+}
+
+func (h *MassSpectraCrudService) CreateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (*domain.MassSpectraRecord, error) {
+	if err := ValidateSpectrum(&rec); err != nil {
+		return nil, err
+	}
+	id, err := h.store.CreateSpectrum(ctx, rec)
+	if err != nil {
+		slog.Error("[MassSpecCrudHandler.CreateSpectrum] failed to create spectrum", "inchiKey", rec.InchiKey, "error", err)
+		return nil, err
+	}
+	rec.ID = id
+	return &rec, nil
+}
+
+func (h *MassSpectraCrudService) UpdateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (*domain.MassSpectraRecord, error) {
+	if err := ValidateSpectrum(&rec); err != nil {
+		return nil, err
+	}
+	if err := h.store.UpdateSpectrum(ctx, rec); err != nil {
+		slog.Error("[MassSpecCrudHandler.UpdateSpectrum] failed to update spectrum", "inchiKey", rec.InchiKey, "id", rec.ID, "error", err)
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (h *MassSpectraCrudService) DeleteSpectrum(ctx context.Context, inchiKey string, id int64) error {
+	if err := h.store.DeleteSpectrum(ctx, inchiKey, id); err != nil {
+		slog.Error("[MassSpecCrudHandler.DeleteSpectrum] failed to delete spectrum", "inchiKey", inchiKey, "id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+func fillInMissingMz(spectra []domain.MassSpectraRecord) []domain.MassSpectraRecord {
 	processedSpectra := make([]domain.MassSpectraRecord, len(spectra))
 	for i := 0; i < len(spectra); i++ {
 		processedSpectra[i] = MassSpectraFillInMissingMz(spectra[i])
 	}
-	return processedSpectra, nil
+	return processedSpectra
 }
 
 func Round(f float32) int {
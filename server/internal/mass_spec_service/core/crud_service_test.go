@@ -2,7 +2,9 @@ package massspecservice
 
 import (
 	"context"
+	"errors"
 	"hydragen-v2/server/internal/domain"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +21,29 @@ func (m *mockMassSpecStore) GetSpectra(ctx context.Context, inchiKey string) ([]
 	return recs, nil
 }
 
+func (m *mockMassSpecStore) GetSpectraBySkeleton(ctx context.Context, skeleton string) ([]domain.MassSpectraRecord, error) {
+	var recs []domain.MassSpectraRecord
+	for inchiKey, spectra := range m.spectra {
+		if strings.HasPrefix(inchiKey, skeleton) {
+			recs = append(recs, spectra...)
+		}
+	}
+	return recs, nil
+}
+
+func (m *mockMassSpecStore) CreateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (int64, error) {
+	m.spectra[rec.InchiKey] = append(m.spectra[rec.InchiKey], rec)
+	return int64(len(m.spectra[rec.InchiKey])), nil
+}
+
+func (m *mockMassSpecStore) UpdateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) error {
+	return nil
+}
+
+func (m *mockMassSpecStore) DeleteSpectrum(ctx context.Context, inchiKey string, id int64) error {
+	return nil
+}
+
 func makeRecord(inchiKey string, mz []float32, peaks []int) domain.MassSpectraRecord {
 	return domain.MassSpectraRecord{
 		ID:              125454,
@@ -80,3 +105,46 @@ func TestGetSpectra_MockedPostgres_PeaksTranslatedCorrectly(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateSpectrum_RejectsInvalidPeaks(t *testing.T) {
+	inchiKey := "QQONPFPTGQHPMA-UHFFFAOYSA-N"
+	tests := []struct {
+		name  string
+		mz    []float32
+		peaks []int
+	}{
+		{name: "no peaks", mz: nil, peaks: nil},
+		{name: "length mismatch", mz: []float32{12, 13}, peaks: []int{1}},
+		{name: "not ascending", mz: []float32{13, 12}, peaks: []int{1, 2}},
+		{name: "duplicate after scaling", mz: []float32{12.00001, 12.00002}, peaks: []int{1, 2}},
+		{name: "negative intensity", mz: []float32{12, 13}, peaks: []int{1, -2}},
+		{name: "m/z out of int4 range", mz: []float32{12, 300000}, peaks: []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &mockMassSpecStore{spectra: map[string][]domain.MassSpectraRecord{}}
+			svc := NewMassSpectraCrudService(mockStore)
+			_, err := svc.CreateSpectrum(context.Background(), makeRecord(inchiKey, tt.mz, tt.peaks))
+			var validationErr *domain.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			if len(mockStore.spectra) != 0 {
+				t.Fatalf("invalid spectrum reached the store")
+			}
+		})
+	}
+}
+
+func TestCreateSpectrum_NormalizesInchiKey(t *testing.T) {
+	mockStore := &mockMassSpecStore{spectra: map[string][]domain.MassSpectraRecord{}}
+	svc := NewMassSpectraCrudService(mockStore)
+
+	got, err := svc.CreateSpectrum(context.Background(), makeRecord(" qqonpfptgqhpma-uhfffaoysa-n", []float32{12, 13.5}, []int{10, 20}))
+	if err != nil {
+		t.Fatalf("CreateSpectrum: %v", err)
+	}
+	if got.InchiKey != "QQONPFPTGQHPMA-UHFFFAOYSA-N" || got.ID != 1 {
+		t.Fatalf("unexpected record: inchiKey=%q id=%d", got.InchiKey, got.ID)
+	}
+}
@@ -0,0 +1,60 @@
+package massspecservice
+
+import (
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/inchikey"
+	"math"
+	"strings"
+)
+
+// m/z values are stored as int4 scaled by domain.MZ_SCALE, which bounds the largest m/z.
+const maxMz = math.MaxInt32 / domain.MZ_SCALE
+
+// ValidateSpectrum normalizes the identifying fields of rec in place and checks the peak arrays:
+// m/z and intensity arrays must be the same non-zero length, m/z strictly ascending and in range,
+// and intensities non-negative.
+func ValidateSpectrum(rec *domain.MassSpectraRecord) error {
+	key, err := inchikey.NormalizeFull(rec.InchiKey)
+	if err != nil {
+		return &domain.ValidationError{Field: "inchiKey", Message: err.Error()}
+	}
+	rec.InchiKey = key
+	rec.DBNumber = strings.TrimSpace(rec.DBNumber)
+	rec.Source = strings.TrimSpace(rec.Source)
+
+	if rec.DBNumber == "" {
+		return &domain.ValidationError{Field: "dbNumber", Message: "must not be empty"}
+	}
+	if rec.Source == "" {
+		return &domain.ValidationError{Field: "source", Message: "must not be empty"}
+	}
+	if math.IsNaN(rec.MolecularWeight) || rec.MolecularWeight <= 0 {
+		return &domain.ValidationError{Field: "molecularWeight", Message: "must be a positive number"}
+	}
+
+	if len(rec.MZ) == 0 {
+		return &domain.ValidationError{Field: "mZ", Message: "must contain at least one peak"}
+	}
+	if len(rec.MZ) != len(rec.Peaks) {
+		return &domain.ValidationError{Field: "peaks", Message: fmt.Sprintf("length %d does not match mZ length %d", len(rec.Peaks), len(rec.MZ))}
+	}
+	previous := -1
+	for i, mz := range rec.MZ {
+		value := float64(mz)
+		if math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 || value > maxMz {
+			return &domain.ValidationError{Field: "mZ", Message: fmt.Sprintf("mZ[%d]=%v must be in (0, %d]", i, mz, maxMz)}
+		}
+		scaled := int(math.Round(value * domain.MZ_SCALE))
+		if scaled <= previous {
+			return &domain.ValidationError{Field: "mZ", Message: fmt.Sprintf("mZ[%d]=%v must be strictly greater than the previous value", i, mz)}
+		}
+		previous = scaled
+	}
+	for i, intensity := range rec.Peaks {
+		if intensity < 0 || intensity > math.MaxInt32 {
+			return &domain.ValidationError{Field: "peaks", Message: fmt.Sprintf("peaks[%d]=%d must be in [0, %d]", i, intensity, math.MaxInt32)}
+		}
+	}
+	return nil
+}
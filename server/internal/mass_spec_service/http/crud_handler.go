@@ -4,10 +4,10 @@ import (
 	"context"
 	"hydragen-v2/server/internal/domain"
 	"hydragen-v2/server/internal/http_helper"
+	"hydragen-v2/server/internal/inchikey"
 	massspecservice "hydragen-v2/server/internal/mass_spec_service/core"
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -28,19 +28,26 @@ type massSpectrumResponse struct {
 func (handler *Handler) GetMassSpectraHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	slog.Info("[GetMassSpectraHandler]: start", "method", r.Method, "path", r.URL.Path)
-	defer slog.Info("[GetMassSpectraHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	defer func() {
+		slog.Info("[GetMassSpectraHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
 
-	inchiKey := strings.TrimSpace(r.PathValue("inchiKey"))
-	if inchiKey == "" {
-		slog.Error("[GetMassSpectraHandler]: Empty inchiKey", "inchiKey", inchiKey)
-		http.NotFound(w, r)
+	inchiKey, ok := http_helper.PathInchiKey(w, r, true)
+	if !ok {
+		slog.Error("[GetMassSpectraHandler]: Invalid inchiKey", "inchiKey", r.PathValue("inchiKey"))
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	spectra, err := handler.crudService.GetSpectra(ctx, inchiKey)
+	var spectra []domain.MassSpectraRecord
+	var err error
+	if inchikey.IsSkeleton(inchiKey) {
+		spectra, err = handler.crudService.GetSpectraBySkeleton(ctx, inchiKey)
+	} else {
+		spectra, err = handler.crudService.GetSpectra(ctx, inchiKey)
+	}
 	if err != nil {
 		slog.Error("[GetMassSpectraHandler]: db.GetMassSpectra error", "inchiKey", inchiKey, "error", err)
 		http.NotFound(w, r)
@@ -54,7 +61,7 @@ func (handler *Handler) GetMassSpectraHandler(w http.ResponseWriter, r *http.Req
 
 	slog.Info("[GetMassSpectraHandler]: successful response", "inchiKey", inchiKey, "spectraCount", len(spectra))
 	http_helper.WriteJSON(w, http.StatusOK, massSpectrumResponse{
-		InchiKey: spectra[0].InchiKey,
+		InchiKey: inchiKey,
 		Count:    len(spectra),
 		Items:    spectra,
 	})
@@ -0,0 +1,122 @@
+package massspecservice_http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+	"hydragen-v2/server/internal/http_helper"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func pathSpectrumID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http_helper.WriteError(w, http.StatusBadRequest, errors.New("spectrum id must be a positive integer"))
+		return 0, false
+	}
+	return id, true
+}
+
+func (handler *Handler) CreateMassSpectrumHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[CreateMassSpectrumHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[CreateMassSpectrumHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	var rec domain.MassSpectraRecord
+	if err := http_helper.ReadJSON(w, r, &rec); err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	rec.ID = 0
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	created, err := handler.crudService.CreateSpectrum(ctx, rec)
+	if err != nil {
+		slog.Error("[CreateMassSpectrumHandler]: CreateSpectrum error", "inchiKey", rec.InchiKey, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[CreateMassSpectrumHandler]: spectrum created", "inchiKey", created.InchiKey, "id", created.ID)
+	http_helper.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (handler *Handler) UpdateMassSpectrumHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[UpdateMassSpectrumHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[UpdateMassSpectrumHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+	id, ok := pathSpectrumID(w, r)
+	if !ok {
+		return
+	}
+
+	var rec domain.MassSpectraRecord
+	if err := http_helper.ReadJSON(w, r, &rec); err != nil {
+		http_helper.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if rec.InchiKey != "" && !strings.EqualFold(strings.TrimSpace(rec.InchiKey), inchiKey) {
+		http_helper.WriteError(w, http.StatusBadRequest, fmt.Errorf("inchiKey in body (%s) does not match path (%s)", rec.InchiKey, inchiKey))
+		return
+	}
+	rec.InchiKey = inchiKey
+	rec.ID = id
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	updated, err := handler.crudService.UpdateSpectrum(ctx, rec)
+	if err != nil {
+		slog.Error("[UpdateMassSpectrumHandler]: UpdateSpectrum error", "inchiKey", inchiKey, "id", id, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[UpdateMassSpectrumHandler]: spectrum updated", "inchiKey", inchiKey, "id", id)
+	http_helper.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (handler *Handler) DeleteMassSpectrumHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	slog.Info("[DeleteMassSpectrumHandler]: start", "method", r.Method, "path", r.URL.Path)
+	defer func() {
+		slog.Info("[DeleteMassSpectrumHandler]: end", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	}()
+
+	inchiKey, ok := http_helper.PathInchiKey(w, r, false)
+	if !ok {
+		return
+	}
+	id, ok := pathSpectrumID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := handler.crudService.DeleteSpectrum(ctx, inchiKey, id); err != nil {
+		slog.Error("[DeleteMassSpectrumHandler]: DeleteSpectrum error", "inchiKey", inchiKey, "id", id, "error", err)
+		http_helper.WriteStoreError(w, err)
+		return
+	}
+
+	slog.Info("[DeleteMassSpectrumHandler]: spectrum deleted", "inchiKey", inchiKey, "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -48,6 +48,73 @@ func (store *PostgresCompoundMetadataStore) Get(ctx context.Context, inchiKey st
 	return &result, nil
 }
 
+func (store *PostgresCompoundMetadataStore) ListBySkeleton(ctx context.Context, skeleton string) ([]domain.CompoundMetadata, error) {
+	related, err := store.querySkeleton(ctx, "[DB QueryCompoundsBySkeleton]", skeleton, "c.inchikey ASC")
+	if err != nil {
+		return nil, err
+	}
+	var results []domain.CompoundMetadata
+	for _, item := range related {
+		results = append(results, item.CompoundMetadata)
+	}
+	return results, nil
+}
+
+func (store *PostgresCompoundMetadataStore) ListRelated(ctx context.Context, skeleton string) ([]domain.RelatedCompound, error) {
+	return store.querySkeleton(ctx, "[DB QueryRelatedCompounds]", skeleton, "COUNT(ms.id) DESC, c.inchikey ASC")
+}
+
+// querySkeleton lists the compounds whose InChIKey starts with skeleton, in the given ORDER BY,
+// which must be a constant.
+func (store *PostgresCompoundMetadataStore) querySkeleton(ctx context.Context, logTag string, skeleton string, orderBy string) ([]domain.RelatedCompound, error) {
+	skeletonSQL := `
+		SELECT
+			c.inchikey,
+			c.name,
+			c.inchi,
+			c.smiles,
+			c.formula,
+			MIN(ms.molecular_weight) AS molecular_weight,
+			COUNT(ms.id) AS spectrum_count
+		FROM compounds c
+		LEFT JOIN mass_spectra ms ON ms.inchikey = c.inchikey
+		WHERE LEFT(c.inchikey, 14) = $1
+		GROUP BY c.inchikey, c.name, c.inchi, c.smiles, c.formula
+		ORDER BY ` + orderBy
+
+	rows, err := store.db.QueryContext(ctx, skeletonSQL, skeleton)
+	if err != nil {
+		slog.Error(logTag+": postgres error", "error", err, "skeleton", skeleton)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.RelatedCompound
+	for rows.Next() {
+		var item domain.RelatedCompound
+		err := rows.Scan(
+			&item.InchiKey,
+			&item.Name,
+			&item.Inchi,
+			&item.Smiles,
+			&item.Formula,
+			&item.MolecularWeight,
+			&item.SpectrumCount,
+		)
+		if err != nil {
+			slog.Error(logTag+": failed to scan compound row", "error", err, "skeleton", skeleton)
+			return nil, err
+		}
+		item.HasMassSpectrum = item.SpectrumCount > 0
+		results = append(results, item)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error(logTag+": rows iteration error", "error", err, "skeleton", skeleton)
+		return nil, err
+	}
+	return results, nil
+}
+
 func (store *PostgresCompoundMetadataStore) List(ctx context.Context, page int, pageSize int) ([]domain.CompoundMetadata, error) {
 	if pageSize > 100 {
 		pageSize = 100
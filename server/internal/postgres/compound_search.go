@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+	"strings"
+)
+
+// compoundMatchesSQL ranks compounds matching a free-text query: InChIKey (or skeleton) first,
+// then external identifiers (CAS, PubChem CID, ...), exact names/synonyms, and finally substrings.
+//
+//	$1 upper-cased query (InChIKey), $2 upper-cased query (identifiers), $3 identifier kind and
+//	$4 value for prefixed identifiers such as "CID 2244", $5 lower-cased query (names),
+//	$6 escaped ILIKE pattern
+//
+// Every branch can use an index: prefixed identifiers are compared through UPPER(value) like the
+// others (their values are digits), and the ILIKE branches use the trigram indexes from V010.
+const compoundMatchesSQL = `
+	matches AS (
+		SELECT inchikey, 0 AS rank FROM compounds WHERE inchikey = $1 OR LEFT(inchikey, 14) = $1
+		UNION ALL
+		SELECT inchikey, 1 FROM compound_identifiers WHERE UPPER(value) = $2 OR (UPPER(value) = $4 AND kind = $3)
+		UNION ALL
+		SELECT inchikey, 2 FROM compounds WHERE LOWER(name) = $5
+		UNION ALL
+		SELECT inchikey, 3 FROM compound_synonyms WHERE LOWER(synonym) = $5
+		UNION ALL
+		SELECT inchikey, 4 FROM compounds WHERE name ILIKE $6
+		UNION ALL
+		SELECT inchikey, 5 FROM compound_synonyms WHERE synonym ILIKE $6
+	),
+	ranked AS (
+		SELECT inchikey, MIN(rank) AS rank FROM matches GROUP BY inchikey
+	)
+`
+
+// identifierPrefixes are the prefixes users type in front of numeric identifiers. The dataset
+// loader stores these identifiers without them.
+var identifierPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"CID:", domain.IdentifierPubchemCID},
+	{"CID", domain.IdentifierPubchemCID},
+	{"CHEBI:", domain.IdentifierChEBI},
+}
+
+// prefixedIdentifier recognizes queries like "CID 2244" or "CHEBI:15365". The prefix only counts
+// when digits follow, so names such as "cidofovir" are left alone.
+func prefixedIdentifier(upper string) (kind string, value string) {
+	for _, candidate := range identifierPrefixes {
+		rest, found := strings.CutPrefix(upper, candidate.prefix)
+		rest = strings.TrimSpace(rest)
+		if found && rest != "" && strings.Trim(rest, "0123456789") == "" {
+			return candidate.kind, rest
+		}
+	}
+	return "", ""
+}
+
+// searchArgs builds the positional arguments for compoundMatchesSQL.
+func searchArgs(query string) []any {
+	trimmed := strings.TrimSpace(query)
+	upper := strings.ToUpper(trimmed)
+	kind, value := prefixedIdentifier(upper)
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	pattern := "%" + escaper.Replace(trimmed) + "%"
+	return []any{upper, upper, kind, value, strings.ToLower(trimmed), pattern}
+}
+
+func (store *PostgresCompoundMetadataStore) Search(ctx context.Context, query string, page int, pageSize int) ([]domain.CompoundMetadata, error) {
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	offset := (page - 1) * pageSize
+	count := pageSize
+
+	searchSQL := `
+		WITH ` + compoundMatchesSQL + `
+		SELECT
+			c.inchikey,
+			c.name,
+			c.inchi,
+			c.smiles,
+			c.formula,
+			MIN(ms.molecular_weight) AS molecular_weight,
+			COUNT(ms.id) > 0 AS has_mass_spectrum
+		FROM ranked r
+		JOIN compounds c ON c.inchikey = r.inchikey
+		LEFT JOIN mass_spectra ms ON ms.inchikey = c.inchikey
+		GROUP BY r.rank, c.inchikey, c.name, c.inchi, c.smiles, c.formula
+		ORDER BY r.rank ASC, MIN(ms.molecular_weight) ASC NULLS LAST, c.name ASC
+		LIMIT $7 OFFSET $8
+	`
+
+	args := append(searchArgs(query), count, offset)
+	rows, err := store.db.QueryContext(ctx, searchSQL, args...)
+	if err != nil {
+		slog.Error("[DB SearchCompounds]: postgres error", "error", err, "query", query, "count", count, "offset", offset)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []domain.CompoundMetadata
+	for rows.Next() {
+		var item domain.CompoundMetadata
+		err := rows.Scan(
+			&item.InchiKey,
+			&item.Name,
+			&item.Inchi,
+			&item.Smiles,
+			&item.Formula,
+			&item.MolecularWeight,
+			&item.HasMassSpectrum,
+		)
+		if err != nil {
+			slog.Error("[DB SearchCompounds]: failed to scan compound row", "error", err, "query", query)
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB SearchCompounds]: rows iteration error", "error", err, "query", query)
+		return nil, err
+	}
+	return results, nil
+}
+
+func (store *PostgresCompoundMetadataStore) SearchCount(ctx context.Context, query string) (int, error) {
+	countSQL := `WITH ` + compoundMatchesSQL + ` SELECT COUNT(*) FROM ranked`
+	var total int
+	err := store.db.QueryRowContext(ctx, countSQL, searchArgs(query)...).Scan(&total)
+	if err != nil {
+		slog.Error("[DB CountSearchCompounds]: db error", "error", err, "query", query)
+		return 0, err
+	}
+	return total, nil
+}
+
+func (store *PostgresCompoundMetadataStore) Synonyms(ctx context.Context, inchiKey string) ([]string, error) {
+	const synonymsSQL = `
+		SELECT synonym
+		FROM compound_synonyms
+		WHERE inchikey = $1
+		ORDER BY synonym ASC
+	`
+
+	rows, err := store.db.QueryContext(ctx, synonymsSQL, inchiKey)
+	if err != nil {
+		slog.Error("[DB QueryCompoundSynonyms]: postgres error", "error", err, "inchiKey", inchiKey)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var synonyms []string
+	for rows.Next() {
+		var synonym string
+		if err := rows.Scan(&synonym); err != nil {
+			slog.Error("[DB QueryCompoundSynonyms]: failed to scan row", "error", err, "inchiKey", inchiKey)
+			return nil, err
+		}
+		synonyms = append(synonyms, synonym)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB QueryCompoundSynonyms]: rows iteration error", "error", err, "inchiKey", inchiKey)
+		return nil, err
+	}
+	return synonyms, nil
+}
+
+func (store *PostgresCompoundMetadataStore) Identifiers(ctx context.Context, inchiKey string) (map[string][]string, error) {
+	const identifiersSQL = `
+		SELECT kind, value
+		FROM compound_identifiers
+		WHERE inchikey = $1
+		ORDER BY kind ASC, value ASC
+	`
+
+	rows, err := store.db.QueryContext(ctx, identifiersSQL, inchiKey)
+	if err != nil {
+		slog.Error("[DB QueryCompoundIdentifiers]: postgres error", "error", err, "inchiKey", inchiKey)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identifiers := map[string][]string{}
+	for rows.Next() {
+		var kind, value string
+		if err := rows.Scan(&kind, &value); err != nil {
+			slog.Error("[DB QueryCompoundIdentifiers]: failed to scan row", "error", err, "inchiKey", inchiKey)
+			return nil, err
+		}
+		identifiers[kind] = append(identifiers[kind], value)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("[DB QueryCompoundIdentifiers]: rows iteration error", "error", err, "inchiKey", inchiKey)
+		return nil, err
+	}
+	return identifiers, nil
+}
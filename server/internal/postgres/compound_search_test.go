@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"hydragen-v2/server/internal/domain"
+	"slices"
+	"testing"
+)
+
+func TestSearchArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []any
+	}{
+		{"pubchem cid", "CID 2244", []any{"CID 2244", "CID 2244", domain.IdentifierPubchemCID, "2244", "cid 2244", "%CID 2244%"}},
+		{"pubchem cid with colon", " cid:2244 ", []any{"CID:2244", "CID:2244", domain.IdentifierPubchemCID, "2244", "cid:2244", "%cid:2244%"}},
+		{"chebi", "CHEBI:15365", []any{"CHEBI:15365", "CHEBI:15365", domain.IdentifierChEBI, "15365", "chebi:15365", "%CHEBI:15365%"}},
+		{"bare number", "2244", []any{"2244", "2244", "", "", "2244", "%2244%"}},
+		{"inchikey", "bsynrymutxbxsq-uhfffaoysa-n", []any{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N", "BSYNRYMUTXBXSQ-UHFFFAOYSA-N", "", "", "bsynrymutxbxsq-uhfffaoysa-n", "%bsynrymutxbxsq-uhfffaoysa-n%"}},
+		{"smiles", "CC(=O)OC1=CC=CC=C1C(=O)O", []any{"CC(=O)OC1=CC=CC=C1C(=O)O", "CC(=O)OC1=CC=CC=C1C(=O)O", "", "", "cc(=o)oc1=cc=cc=c1c(=o)o", "%CC(=O)OC1=CC=CC=C1C(=O)O%"}},
+		{"name starting with cid", "Cidofovir", []any{"CIDOFOVIR", "CIDOFOVIR", "", "", "cidofovir", "%Cidofovir%"}},
+		{"name with wildcards", "50%_acid", []any{"50%_ACID", "50%_ACID", "", "", "50%_acid", `%50\%\_acid%`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchArgs(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("searchArgs(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := openTestDB(t)
+	const seedSQL = `
+		INSERT INTO compounds (inchikey, name, inchi, smiles, formula) VALUES
+			('BSYNRYMUTXBXSQ-UHFFFAOYSA-N', 'Aspirin', 'InChI=1S/C9H8O4', 'CC(=O)OC1=CC=CC=C1C(=O)O', 'C9H8O4'),
+			('VWFJDQUYCIWHTN-YFKPBYRVSA-N', 'Cidofovir', 'InChI=1S/C8H14N3O6P', 'C1=CN(C(=O)N=C1N)C[C@@H](CO)OCP(=O)(O)O', 'C8H14N3O6P'),
+			('XEKOWRVHYACXOJ-UHFFFAOYSA-N', 'Ethyl acetate', 'InChI=1S/C4H8O2', 'CCOC(C)=O', 'C4H8O2');
+		INSERT INTO compound_synonyms (inchikey, synonym) VALUES
+			('BSYNRYMUTXBXSQ-UHFFFAOYSA-N', 'Acetylsalicylic acid');
+		INSERT INTO compound_identifiers (inchikey, kind, value) VALUES
+			('BSYNRYMUTXBXSQ-UHFFFAOYSA-N', 'pubchem_cid', '2244'),
+			('BSYNRYMUTXBXSQ-UHFFFAOYSA-N', 'cas', '50-78-2');
+	`
+	if _, err := db.ExecContext(t.Context(), seedSQL); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	store := NewPostgresCompoundMetadataStore(db)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"CID 2244", []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N"}},
+		{"50-78-2", []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N"}},
+		{"bsynrymutxbxsq", []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N"}},
+		{"acetylsalicylic acid", []string{"BSYNRYMUTXBXSQ-UHFFFAOYSA-N"}},
+		{"cidofovir", []string{"VWFJDQUYCIWHTN-YFKPBYRVSA-N"}},
+		// Name substrings rank before synonym substrings.
+		{"acet", []string{"XEKOWRVHYACXOJ-UHFFFAOYSA-N", "BSYNRYMUTXBXSQ-UHFFFAOYSA-N"}},
+		{"ethyl acetate", []string{"XEKOWRVHYACXOJ-UHFFFAOYSA-N"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := store.Search(t.Context(), tt.query, 1, 20)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.InchiKey)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			total, err := store.SearchCount(t.Context(), tt.query)
+			if err != nil || total != len(tt.want) {
+				t.Errorf("SearchCount(%q) = %d, %v", tt.query, total, err)
+			}
+		})
+	}
+}
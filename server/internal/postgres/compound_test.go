@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// openTestDB connects to TEST_DATABASE_URL and shadows the compound tables with empty temporary
+// ones, so tests neither see nor touch real data. Tests are skipped without a database.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	// Temporary tables live in one session; a single connection keeps every query in it.
+	db.SetMaxOpenConns(1)
+
+	const schemaSQL = `
+		CREATE TEMPORARY TABLE compounds (
+			inchikey CHAR(27) PRIMARY KEY,
+			name     TEXT NOT NULL,
+			inchi    TEXT NOT NULL,
+			smiles   TEXT NOT NULL,
+			formula  TEXT NOT NULL
+		);
+		CREATE TEMPORARY TABLE mass_spectra (
+			id               BIGSERIAL PRIMARY KEY,
+			inchikey         CHAR(27) NOT NULL,
+			molecular_weight DOUBLE PRECISION NOT NULL
+		);
+		CREATE TEMPORARY TABLE compound_synonyms (
+			inchikey CHAR(27) NOT NULL,
+			synonym  TEXT NOT NULL
+		);
+		CREATE TEMPORARY TABLE compound_identifiers (
+			inchikey CHAR(27) NOT NULL,
+			kind     TEXT NOT NULL,
+			value    TEXT NOT NULL
+		);
+	`
+	if _, err := db.ExecContext(t.Context(), schemaSQL); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	return db
+}
+
+func TestListRelated(t *testing.T) {
+	db := openTestDB(t)
+	const seedSQL = `
+		INSERT INTO compounds (inchikey, name, inchi, smiles, formula) VALUES
+			('QNAYBMKLOCPYGJ-REOHCLBHSA-N', 'L-alanine', 'InChI=1S/C3H7NO2', 'C[C@H](N)C(=O)O', 'C3H7NO2'),
+			('QNAYBMKLOCPYGJ-UWTATZPHSA-N', 'D-alanine', 'InChI=1S/C3H7NO2', 'C[C@@H](N)C(=O)O', 'C3H7NO2'),
+			('QNAYBMKLOCPYGJ-UHFFFAOYSA-N', 'alanine', 'InChI=1S/C3H7NO2', 'CC(N)C(=O)O', 'C3H7NO2'),
+			('XLYOFNOQVPJJNP-UHFFFAOYSA-N', 'water', 'InChI=1S/H2O', 'O', 'H2O');
+		INSERT INTO mass_spectra (inchikey, molecular_weight) VALUES
+			('QNAYBMKLOCPYGJ-UWTATZPHSA-N', 89.09),
+			('QNAYBMKLOCPYGJ-UWTATZPHSA-N', 89.09),
+			('QNAYBMKLOCPYGJ-REOHCLBHSA-N', 89.09),
+			('XLYOFNOQVPJJNP-UHFFFAOYSA-N', 18.02);
+	`
+	if _, err := db.ExecContext(t.Context(), seedSQL); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	store := NewPostgresCompoundMetadataStore(db)
+
+	related, err := store.ListRelated(t.Context(), "QNAYBMKLOCPYGJ")
+	if err != nil {
+		t.Fatalf("ListRelated: %v", err)
+	}
+	want := []struct {
+		inchiKey      string
+		spectrumCount int
+	}{
+		{"QNAYBMKLOCPYGJ-UWTATZPHSA-N", 2},
+		{"QNAYBMKLOCPYGJ-REOHCLBHSA-N", 1},
+		{"QNAYBMKLOCPYGJ-UHFFFAOYSA-N", 0},
+	}
+	if len(related) != len(want) {
+		t.Fatalf("got %d compounds, want %d", len(related), len(want))
+	}
+	for i, item := range related {
+		if item.InchiKey != want[i].inchiKey || item.SpectrumCount != want[i].spectrumCount {
+			t.Errorf("item %d: got %s with %d spectra, want %s with %d", i, item.InchiKey, item.SpectrumCount, want[i].inchiKey, want[i].spectrumCount)
+		}
+		if item.HasMassSpectrum != (item.SpectrumCount > 0) {
+			t.Errorf("item %d: HasMassSpectrum %v with %d spectra", i, item.HasMassSpectrum, item.SpectrumCount)
+		}
+		if (item.MolecularWeight == nil) != (item.SpectrumCount == 0) {
+			t.Errorf("item %d: unexpected molecular weight %v", i, item.MolecularWeight)
+		}
+	}
+
+	bySkeleton, err := store.ListBySkeleton(t.Context(), "QNAYBMKLOCPYGJ")
+	if err != nil {
+		t.Fatalf("ListBySkeleton: %v", err)
+	}
+	if len(bySkeleton) != 3 || bySkeleton[0].InchiKey != "QNAYBMKLOCPYGJ-REOHCLBHSA-N" {
+		t.Errorf("got %+v, want the three alanines ordered by InChIKey", bySkeleton)
+	}
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+)
+
+func (store *PostgresCompoundMetadataStore) Create(ctx context.Context, c domain.CompoundMetadata) error {
+	if store.db == nil {
+		return domain.ErrReadOnly
+	}
+
+	const insertSQL = `
+		INSERT INTO compounds (inchikey, name, inchi, smiles, formula)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err := store.db.ExecContext(ctx, insertSQL, c.InchiKey, c.Name, c.Inchi, c.Smiles, c.Formula)
+	if err != nil {
+		slog.Error("[DB CreateCompound]: postgres error", "error", err, "inchiKey", c.InchiKey)
+		return mapWriteError(err)
+	}
+	return nil
+}
+
+func (store *PostgresCompoundMetadataStore) Update(ctx context.Context, c domain.CompoundMetadata) error {
+	if store.db == nil {
+		return domain.ErrReadOnly
+	}
+
+	const updateSQL = `
+		UPDATE compounds
+		SET name = $2, inchi = $3, smiles = $4, formula = $5
+		WHERE inchikey = $1
+	`
+
+	result, err := store.db.ExecContext(ctx, updateSQL, c.InchiKey, c.Name, c.Inchi, c.Smiles, c.Formula)
+	if err != nil {
+		slog.Error("[DB UpdateCompound]: postgres error", "error", err, "inchiKey", c.InchiKey)
+		return mapWriteError(err)
+	}
+	return requireAffectedRow(result)
+}
+
+// Delete removes a compound together with its mass spectra.
+func (store *PostgresCompoundMetadataStore) Delete(ctx context.Context, inchiKey string) error {
+	if store.db == nil {
+		return domain.ErrReadOnly
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("[DB DeleteCompound]: unable to begin transaction", "error", err, "inchiKey", inchiKey)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mass_spectra WHERE inchikey = $1`, inchiKey); err != nil {
+		slog.Error("[DB DeleteCompound]: unable to delete mass spectra", "error", err, "inchiKey", inchiKey)
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM compounds WHERE inchikey = $1`, inchiKey)
+	if err != nil {
+		slog.Error("[DB DeleteCompound]: postgres error", "error", err, "inchiKey", inchiKey)
+		return mapWriteError(err)
+	}
+	if err := requireAffectedRow(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func requireAffectedRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"hydragen-v2/server/internal/domain"
 	"log/slog"
+	"strings"
 )
 
 var fallbackSpectra = map[string][]domain.MassSpectraRecord{
@@ -16,8 +17,6 @@ var fallbackSpectra = map[string][]domain.MassSpectraRecord{
 	},
 }
 
-const MZ_SCALE = 10000
-
 type PostgresMassSpecStore struct {
 	db          *sql.DB
 	useFallback bool
@@ -31,11 +30,15 @@ func (s *PostgresMassSpecStore) GetSpectra(ctx context.Context, inchiKey string)
 	return GetMassSpectra(ctx, s.db, inchiKey, s.useFallback)
 }
 
+func (s *PostgresMassSpecStore) GetSpectraBySkeleton(ctx context.Context, skeleton string) ([]domain.MassSpectraRecord, error) {
+	return GetMassSpectraBySkeleton(ctx, s.db, skeleton, s.useFallback)
+}
+
 func scaleDownMzFromDb(rawValue []int) []float32 {
 	var result []float32
 	result = make([]float32, len(rawValue))
 	for i, val := range rawValue {
-		result[i] = float32(val) / float32(MZ_SCALE)
+		result[i] = float32(val) / float32(domain.MZ_SCALE)
 	}
 	return result
 }
@@ -49,7 +52,28 @@ func GetMassSpectra(ctx context.Context, db *sql.DB, inchiKey string, useFallbac
 		return records, nil
 
 	}
-	const spectraSQL = `
+	return queryMassSpectra(ctx, db, "inchikey = $1", inchiKey)
+}
+
+// GetMassSpectraBySkeleton returns the spectra of every compound whose InChIKey starts with skeleton.
+func GetMassSpectraBySkeleton(ctx context.Context, db *sql.DB, skeleton string, useFallback bool) ([]domain.MassSpectraRecord, error) {
+	if useFallback {
+		var records []domain.MassSpectraRecord
+		for inchiKey, spectra := range fallbackSpectra {
+			if strings.HasPrefix(inchiKey, skeleton) {
+				records = append(records, spectra...)
+			}
+		}
+		if len(records) == 0 {
+			return nil, sql.ErrNoRows
+		}
+		return records, nil
+	}
+	return queryMassSpectra(ctx, db, "LEFT(inchikey, 14) = $1", skeleton)
+}
+
+func queryMassSpectra(ctx context.Context, db *sql.DB, whereClause string, key string) ([]domain.MassSpectraRecord, error) {
+	spectraSQL := `
 		SELECT
 			id,
 			inchikey,
@@ -69,13 +93,13 @@ func GetMassSpectra(ctx context.Context, db *sql.DB, inchiKey string, useFallbac
 			m_z,
 			peaks
 		FROM mass_spectra
-		WHERE inchikey = $1
+		WHERE ` + whereClause + `
 		ORDER BY id ASC
 	`
 
-	rows, err := db.QueryContext(ctx, spectraSQL, inchiKey)
+	rows, err := db.QueryContext(ctx, spectraSQL, key)
 	if err != nil {
-		slog.Error("GetMassSpectra: database query error", "error", err, "inchiKey", inchiKey)
+		slog.Error("GetMassSpectra: database query error", "error", err, "key", key)
 		return nil, err
 	}
 	defer rows.Close()
@@ -107,13 +131,13 @@ func GetMassSpectra(ctx context.Context, db *sql.DB, inchiKey string, useFallbac
 		rec.MZ = scaleDownMzFromDb(MZ_raw)
 		rec.Peaks = Peaks_raw
 		if err != nil {
-			slog.Error("GetMassSpectra: failed to scan row", "error", err, "inchiKey", inchiKey)
+			slog.Error("GetMassSpectra: failed to scan row", "error", err, "key", key)
 			return nil, err
 		}
 		spectra = append(spectra, rec)
 	}
 	if err := rows.Err(); err != nil {
-		slog.Error("GetMassSpectra: rows iteration error", "error", err, "inchiKey", inchiKey)
+		slog.Error("GetMassSpectra: rows iteration error", "error", err, "key", key)
 		return nil, err
 	}
 
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"hydragen-v2/server/internal/domain"
+	"log/slog"
+	"math"
+)
+
+func scaleUpMzToDb(mz []float32) PgInt4Array {
+	result := make(PgInt4Array, len(mz))
+	for i, val := range mz {
+		result[i] = int(math.Round(float64(val) * domain.MZ_SCALE))
+	}
+	return result
+}
+
+func (s *PostgresMassSpecStore) CreateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) (int64, error) {
+	if s.useFallback {
+		return 0, domain.ErrReadOnly
+	}
+
+	const insertSQL = `
+		INSERT INTO mass_spectra (
+			inchikey, molecular_weight, exact_mass, precursor_mz, precursor_type,
+			ion_mode, collision_energy, spectrum_type, instrument, instrument_type,
+			splash, db_number, source, comments, m_z, peaks
+		) VALUES (
+			$1, $2, $3, $4, $5,
+			$6, $7, $8, $9, $10,
+			$11, $12, $13, $14, $15, $16
+		)
+		RETURNING id
+	`
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, insertSQL,
+		rec.InchiKey, rec.MolecularWeight, rec.ExactMass, rec.PrecursorMz, rec.PrecursorType,
+		rec.IonMode, rec.CollisionEnergy, rec.SpectrumType, rec.Instrument, rec.InstrumentType,
+		rec.Splash, rec.DBNumber, rec.Source, rec.Comments, scaleUpMzToDb(rec.MZ), PgInt4Array(rec.Peaks),
+	).Scan(&id)
+	if err != nil {
+		slog.Error("[DB CreateMassSpectrum]: postgres error", "error", err, "inchiKey", rec.InchiKey, "dbNumber", rec.DBNumber)
+		return 0, mapWriteError(err)
+	}
+	return id, nil
+}
+
+// UpdateSpectrum replaces every column of the spectrum identified by (rec.InchiKey, rec.ID).
+func (s *PostgresMassSpecStore) UpdateSpectrum(ctx context.Context, rec domain.MassSpectraRecord) error {
+	if s.useFallback {
+		return domain.ErrReadOnly
+	}
+
+	const updateSQL = `
+		UPDATE mass_spectra SET
+			molecular_weight = $3,
+			exact_mass = $4,
+			precursor_mz = $5,
+			precursor_type = $6,
+			ion_mode = $7,
+			collision_energy = $8,
+			spectrum_type = $9,
+			instrument = $10,
+			instrument_type = $11,
+			splash = $12,
+			db_number = $13,
+			source = $14,
+			comments = $15,
+			m_z = $16,
+			peaks = $17
+		WHERE id = $1 AND inchikey = $2
+	`
+
+	result, err := s.db.ExecContext(ctx, updateSQL,
+		rec.ID, rec.InchiKey,
+		rec.MolecularWeight, rec.ExactMass, rec.PrecursorMz, rec.PrecursorType,
+		rec.IonMode, rec.CollisionEnergy, rec.SpectrumType, rec.Instrument, rec.InstrumentType,
+		rec.Splash, rec.DBNumber, rec.Source, rec.Comments, scaleUpMzToDb(rec.MZ), PgInt4Array(rec.Peaks),
+	)
+	if err != nil {
+		slog.Error("[DB UpdateMassSpectrum]: postgres error", "error", err, "inchiKey", rec.InchiKey, "id", rec.ID)
+		return mapWriteError(err)
+	}
+	return requireAffectedRow(result)
+}
+
+func (s *PostgresMassSpecStore) DeleteSpectrum(ctx context.Context, inchiKey string, id int64) error {
+	if s.useFallback {
+		return domain.ErrReadOnly
+	}
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM mass_spectra WHERE id = $1 AND inchikey = $2`, id, inchiKey)
+	if err != nil {
+		slog.Error("[DB DeleteMassSpectrum]: postgres error", "error", err, "inchiKey", inchiKey, "id", id)
+		return err
+	}
+	return requireAffectedRow(result)
+}
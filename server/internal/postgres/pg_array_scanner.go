@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"strconv"
 	"strings"
@@ -38,3 +39,16 @@ func (s *PgInt4Array) Scan(src interface{}) error {
 	*s = arr
 	return nil
 }
+
+func (s PgInt4Array) Value() (driver.Value, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range s {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(v))
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"hydragen-v2/server/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+)
+
+// mapWriteError translates constraint violations into domain errors the HTTP layer can report.
+func mapWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %s", domain.ErrConflict, pgErr.Detail)
+	case pgForeignKeyViolation:
+		return &domain.ValidationError{Field: "inchiKey", Message: "referenced compound does not exist"}
+	case pgCheckViolation:
+		return &domain.ValidationError{Field: pgErr.ColumnName, Message: pgErr.Message}
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token-bucket budget: Rate tokens per second refill a bucket holding at most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func PerMinute(requests int, burst int) Limit {
+	return Limit{Rate: float64(requests) / 60, Burst: burst}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// Limiter keeps one token bucket per key (e.g. "key:12" or "ip:203.0.113.7").
+// Buckets idle long enough to have refilled completely are dropped.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewLimiter() *Limiter {
+	return newLimiterWithClock(time.Now)
+}
+
+func newLimiterWithClock(now func() time.Time) *Limiter {
+	return &Limiter{buckets: map[string]*bucket{}, now: now, lastSweep: now()}
+}
+
+// Allow takes one token from key's bucket. When the bucket is empty it returns false and
+// how long until a token is available.
+func (l *Limiter) Allow(key string, limit Limit) (ok bool, retryAfter time.Duration) {
+	return l.AllowN(key, limit, 1)
+}
+
+func (l *Limiter) AllowN(key string, limit Limit, n int) (ok bool, retryAfter time.Duration) {
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		return true, 0
+	}
+	missing := float64(n) - b.tokens
+	return false, time.Duration(missing / limit.Rate * float64(time.Second))
+}
+
+// Wait blocks until key's bucket has a token and takes it, or returns ctx.Err() when ctx is done first.
+func (l *Limiter) Wait(ctx context.Context, key string, limit Limit) error {
+	for {
+		ok, retryAfter := l.Allow(key, limit)
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		// A bucket that would be full again carries no state worth keeping.
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) && now.Sub(b.last) > sweepInterval {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiter_BurstThenRefill(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	limiter := newLimiterWithClock(clock.Now)
+	limit := PerMinute(60, 3) // 1 token per second, burst of 3
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.Allow("ip:1", limit); !ok {
+			t.Fatalf("request %d within burst was rejected", i)
+		}
+	}
+	ok, retryAfter := limiter.Allow("ip:1", limit)
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("unexpected retryAfter %v", retryAfter)
+	}
+
+	if ok, _ := limiter.Allow("ip:2", limit); !ok {
+		t.Fatal("buckets must be independent per key")
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	if ok, _ := limiter.Allow("ip:1", limit); !ok {
+		t.Fatal("bucket did not refill after one second")
+	}
+	if ok, _ := limiter.Allow("ip:1", limit); ok {
+		t.Fatal("bucket refilled more than one token in one second")
+	}
+}
+
+func TestLimiter_RefillIsCappedAtBurst(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	limiter := newLimiterWithClock(clock.Now)
+	limit := PerMinute(600, 2)
+
+	limiter.Allow("key:1", limit)
+	clock.now = clock.now.Add(time.Hour)
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if ok, _ := limiter.Allow("key:1", limit); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Fatalf("allowed %d requests after idling, want burst of 2", allowed)
+	}
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	limiter := NewLimiter()
+	limit := Limit{Rate: 100, Burst: 1}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(t.Context(), "provider:chembl", limit); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("three requests at 100/s with burst 1 took only %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := limiter.Wait(ctx, "provider:chembl", Limit{Rate: 0.001, Burst: 1}); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
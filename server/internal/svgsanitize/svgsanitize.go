@@ -0,0 +1,156 @@
+// Package svgsanitize strips active content from third-party SVG so it can be served from our origin.
+package svgsanitize
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrMalformed = errors.New("malformed SVG")
+
+// droppedElements are removed together with everything inside them. Animation elements are
+// included because <set>/<animate> can rewrite href attributes to javascript: URLs.
+var droppedElements = map[string]bool{
+	"script":           true,
+	"foreignobject":    true,
+	"iframe":           true,
+	"embed":            true,
+	"object":           true,
+	"handler":          true,
+	"listener":         true,
+	"set":              true,
+	"animate":          true,
+	"animatemotion":    true,
+	"animatetransform": true,
+}
+
+// Sanitize re-serializes data keeping only passive markup:
+//   - scripts, foreignObject, embedded documents and animations are removed;
+//   - on* event handler attributes are removed;
+//   - href/xlink:href must reference a fragment in the same document (#id);
+//   - url(...) in attributes and <style> must reference a fragment, and @import is not allowed;
+//   - attributes and <style> text containing a backslash are dropped, since CSS escapes can hide both;
+//   - DOCTYPEs (and with them entity declarations), comments and processing instructions are dropped.
+func Sanitize(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&out)
+
+	skipDepth := 0
+	sawRoot := false
+	var open []string
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || droppedElements[strings.ToLower(t.Name.Local)] {
+				skipDepth++
+				continue
+			}
+			if len(open) == 0 {
+				if sawRoot || !strings.EqualFold(t.Name.Local, "svg") {
+					return nil, fmt.Errorf("%w: root element must be a single <svg>", ErrMalformed)
+				}
+				sawRoot = true
+			}
+			start := xml.StartElement{Name: flatten(t.Name)}
+			for _, attr := range t.Attr {
+				if keepAttr(attr) {
+					start.Attr = append(start.Attr, xml.Attr{Name: flatten(attr.Name), Value: attr.Value})
+				}
+			}
+			open = append(open, start.Name.Local)
+			err = encoder.EncodeToken(start)
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			if len(open) == 0 || open[len(open)-1] != flatten(t.Name).Local {
+				return nil, fmt.Errorf("%w: unexpected </%s>", ErrMalformed, flatten(t.Name).Local)
+			}
+			open = open[:len(open)-1]
+			err = encoder.EncodeToken(xml.EndElement{Name: flatten(t.Name)})
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			if len(open) == 0 {
+				if len(bytes.TrimSpace(t)) > 0 {
+					return nil, fmt.Errorf("%w: text outside the root element", ErrMalformed)
+				}
+				continue
+			}
+			if strings.EqualFold(open[len(open)-1], "style") && !safeCSS(string(t)) {
+				continue
+			}
+			err = encoder.EncodeToken(t.Copy())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+	}
+	if !sawRoot {
+		return nil, fmt.Errorf("%w: no <svg> element", ErrMalformed)
+	}
+	if len(open) > 0 {
+		return nil, fmt.Errorf("%w: unclosed <%s>", ErrMalformed, open[len(open)-1])
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// flatten keeps the source prefix verbatim ("xlink:href") instead of letting the encoder invent
+// namespace prefixes; RawToken leaves prefixes unresolved in Name.Space.
+func flatten(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+func keepAttr(attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(local, "on") {
+		return false
+	}
+	if local == "href" || local == "src" {
+		return strings.HasPrefix(strings.TrimSpace(attr.Value), "#")
+	}
+	return safeCSS(attr.Value)
+}
+
+// safeCSS rejects values that can load external resources or run script. CSS escapes (e.g.
+// "\75 rl(" for "url(") are not decoded; any backslash rejects the value instead.
+func safeCSS(value string) bool {
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, `\`) || strings.Contains(lower, "@import") || strings.Contains(lower, "expression(") || strings.Contains(lower, "javascript:") {
+		return false
+	}
+	for rest := lower; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+		rest = strings.TrimLeft(rest[i+len("url("):], " \t\r\n'\"")
+		if !strings.HasPrefix(rest, "#") {
+			return false
+		}
+	}
+}
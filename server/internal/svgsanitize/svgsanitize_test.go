@@ -0,0 +1,51 @@
+package svgsanitize
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSanitize_StripsActiveContent(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<!DOCTYPE svg [<!ENTITY x "boom">]>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="300" height="300" onload="alert(1)">
+  <script type="text/javascript">alert(document.cookie)</script>
+  <defs><linearGradient id="g"/></defs>
+  <style>@import url(https://evil.example/x.css);</style>
+  <style>rect { background: \75 rl(https://evil.example/escaped.png) } @\69mport "https://evil.example/y.css";</style>
+  <circle r="1" style="fill:\000075rl(https://evil.example/escaped2.png)"/>
+  <rect width="10" height="10" fill="url(#g)" style="background:url(https://evil.example/track.png)"/>
+  <a xlink:href="javascript:alert(1)"><text x="1" y="2">C&lt;O</text></a>
+  <use xlink:href="#g"/>
+  <image href="https://evil.example/track.png"/>
+  <foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><iframe src="https://evil.example"/></body></foreignObject>
+  <set attributeName="href" to="javascript:alert(1)"/>
+  <!-- comment -->
+</svg>`
+
+	out, err := Sanitize([]byte(input))
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	got := string(out)
+
+	for _, banned := range []string{"script", "alert", "onload", "evil.example", "foreignObject", "iframe", "<set", "ENTITY", "comment"} {
+		if strings.Contains(got, banned) {
+			t.Errorf("output still contains %q:\n%s", banned, got)
+		}
+	}
+	for _, kept := range []string{`fill="url(#g)"`, `xlink:href="#g"`, `xmlns:xlink="http://www.w3.org/1999/xlink"`, `C&lt;O`, `width="300"`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("output lost %q:\n%s", kept, got)
+		}
+	}
+}
+
+func TestSanitize_RejectsMalformed(t *testing.T) {
+	for _, input := range []string{`<svg><g></svg>`, `<svg>`, `not xml <`, `plain text`, `<html><body/></html>`, `<svg/><svg/>`} {
+		if _, err := Sanitize([]byte(input)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Sanitize(%q) = %v, want ErrMalformed", input, err)
+		}
+	}
+}
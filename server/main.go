@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	apikey "hydragen-v2/server/internal/api_key/core"
+	apikey_http "hydragen-v2/server/internal/api_key/http"
+	apikey_postgres "hydragen-v2/server/internal/api_key/postgres"
+	"hydragen-v2/server/internal/auth"
+	chemicalimageresolver_convert "hydragen-v2/server/internal/chemical_image_resolver/convert"
 	chemicalimageresolver "hydragen-v2/server/internal/chemical_image_resolver/core"
 	chemicalimageresolver_disk "hydragen-v2/server/internal/chemical_image_resolver/disk"
 	chemicalimageresolver_http "hydragen-v2/server/internal/chemical_image_resolver/http"
+	chemicalimageresolver_memory "hydragen-v2/server/internal/chemical_image_resolver/memory"
 	chemicalimageresolver_postgres "hydragen-v2/server/internal/chemical_image_resolver/postgres"
+	chemicalimageresolver_s3 "hydragen-v2/server/internal/chemical_image_resolver/s3"
 	chemicalimageresolver_thirdparty "hydragen-v2/server/internal/chemical_image_resolver/third_party"
 	compoundmetadatastore "hydragen-v2/server/internal/compound_metadata_store/core"
 	compoundmetadatastore_http "hydragen-v2/server/internal/compound_metadata_store/http"
@@ -12,9 +20,13 @@ import (
 	massspecservice "hydragen-v2/server/internal/mass_spec_service/core"
 	massspecservice_http "hydragen-v2/server/internal/mass_spec_service/http"
 	"hydragen-v2/server/internal/postgres"
+	"hydragen-v2/server/internal/ratelimit"
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -33,22 +45,73 @@ func main() {
 	massSpecService := massspecservice.NewMassSpectraCrudService(massSpecStore)
 	massSpecHandler := massspecservice_http.NewHandler(massSpecService)
 
-	providers := map[chemicalimageresolver.ProviderType]chemicalimageresolver.ThirdPartyProvider{
-		chemicalimageresolver.ProviderType("chembl"): &chemicalimageresolver_thirdparty.ChemblThirdPartyProvider{},
-		chemicalimageresolver.ProviderType("cactus"): &chemicalimageresolver_thirdparty.CactusThirdPartyProvider{},
+	// Providers, their order, mirrors and cooldowns come from IMAGE_PROVIDERS_CONFIG and IMAGE_PROVIDER_* overrides.
+	providerConfig, err := chemicalimageresolver_thirdparty.RegistryConfigFromEnv()
+	if err != nil {
+		log.Fatalf("image provider configuration error: %v", err)
+	}
+	providers, providerOrder, err := providerConfig.Build()
+	if err != nil {
+		log.Fatalf("image provider configuration error: %v", err)
+	}
+	slog.Info("Image providers configured", "order", providerOrder)
+	// Local disk by default; S3-compatible storage lets several instances share one cache.
+	var imageStore chemicalimageresolver.ImageCache = &chemicalimageresolver_disk.DiskImageCache{}
+	switch backend := os.Getenv("IMAGE_CACHE_BACKEND"); backend {
+	case "", "disk":
+	case "s3":
+		s3Config, err := chemicalimageresolver_s3.ConfigFromEnv()
+		if err != nil {
+			log.Fatalf("image cache configuration error: %v", err)
+		}
+		imageStore = chemicalimageresolver_s3.NewS3ImageCache(s3Config)
+	default:
+		log.Fatalf("image cache configuration error: unknown IMAGE_CACHE_BACKEND %q", backend)
 	}
-	providerOrder := []chemicalimageresolver.ProviderType{
-		chemicalimageresolver.ProviderType("chembl"),
-		chemicalimageresolver.ProviderType("cactus"),
+	imageCache := chemicalimageresolver_memory.NewTieredImageCache(imageStore, chemicalimageresolver_memory.MaxBytesFromEnv())
+	// Cached images are refreshed in the background once older than IMAGE_CACHE_TTL (0 disables).
+	imageTTL := 30 * 24 * time.Hour
+	if value, err := time.ParseDuration(os.Getenv("IMAGE_CACHE_TTL")); err == nil && value >= 0 {
+		imageTTL = value
 	}
+	// IMAGE_CACHE_MAX_BYTES caps the persistent cache; unset or 0 means unbounded.
+	if maxBytes, err := strconv.ParseInt(os.Getenv("IMAGE_CACHE_MAX_BYTES"), 10, 64); err == nil && maxBytes > 0 {
+		go chemicalimageresolver.RunEviction(context.Background(), imageCache, maxBytes, 10*time.Minute)
+	}
+	cooldownStore := chemicalimageresolver_postgres.NewPostgresRequestCooldownStore(db, providerConfig.CooldownPolicies())
 	imageResolver := chemicalimageresolver.New(
-		chemicalimageresolver_postgres.NewPostgresRequestCooldownStore(db),
+		cooldownStore,
 		compoundStore,
-		&chemicalimageresolver_disk.DiskImageCache{},
+		imageCache,
 		providers,
 		providerOrder,
+		chemicalimageresolver.WithRace(500*time.Millisecond),
+		chemicalimageresolver.WithConverter(chemicalimageresolver_convert.NewConverter()),
+		chemicalimageresolver.WithRevalidation(imageTTL),
 	)
 	imageHandler := chemicalimageresolver_http.NewHandler(imageResolver)
+	// The prefetch job fills the image cache ahead of users, e.g. after a dataset reload.
+	warmerConfig := chemicalimageresolver.DefaultWarmerConfig()
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_PREFETCH_CONCURRENCY")); err == nil && value > 0 {
+		warmerConfig.Concurrency = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_PREFETCH_PROVIDER_PER_MINUTE")); err == nil && value > 0 {
+		warmerConfig.ProviderLimit = ratelimit.PerMinute(value, min(value, 5))
+	}
+	imageWarmer := chemicalimageresolver.NewWarmer(imageResolver, compoundStore, warmerConfig)
+	if db != nil && os.Getenv("IMAGE_PREFETCH_ON_START") == "true" {
+		_ = imageWarmer.Start(context.Background())
+	}
+	imageAdminHandler := chemicalimageresolver_http.NewAdminHandler(imageResolver, cooldownStore, imageWarmer)
+
+	authenticator, err := auth.NewAuthenticatorFromEnv()
+	if err != nil {
+		log.Fatalf("auth configuration error: %v", err)
+	}
+
+	apiKeyService := apikey.NewService(apikey_postgres.NewPostgresAPIKeyStore(db))
+	apiKeyAdminHandler := apikey_http.NewAdminHandler(apiKeyService)
+	rateLimiter := apikey_http.NewRateLimiter(apiKeyService, ratelimit.NewLimiter(), apikey_http.RateLimitConfigFromEnv())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
@@ -56,12 +119,36 @@ func main() {
 	})
 	mux.HandleFunc("GET /compounds", compoundHandler.GetCompoundListHandler)
 	mux.HandleFunc("GET /compounds/{inchiKey}", compoundHandler.GetCompoundDetailHandler)
+	mux.HandleFunc("GET /compounds/{inchiKey}/related", compoundHandler.GetRelatedCompoundsHandler)
 	mux.HandleFunc("GET /compounds/{inchiKey}/image", imageHandler.GetCompoundImageHandler)
+	mux.HandleFunc("GET /compounds/{inchiKey}/image/info", imageHandler.GetCompoundImageInfoHandler)
 	mux.HandleFunc("GET /mass-spectra/{inchiKey}", massSpecHandler.GetMassSpectraHandler)
 
+	mux.HandleFunc("POST /compounds", auth.Require(auth.RoleCurator, compoundHandler.CreateCompoundHandler))
+	mux.HandleFunc("PUT /compounds/{inchiKey}", auth.Require(auth.RoleCurator, compoundHandler.UpdateCompoundHandler))
+	mux.HandleFunc("DELETE /compounds/{inchiKey}", auth.Require(auth.RoleCurator, compoundHandler.DeleteCompoundHandler))
+	mux.HandleFunc("POST /mass-spectra", auth.Require(auth.RoleCurator, massSpecHandler.CreateMassSpectrumHandler))
+	mux.HandleFunc("PUT /mass-spectra/{inchiKey}/{id}", auth.Require(auth.RoleCurator, massSpecHandler.UpdateMassSpectrumHandler))
+	mux.HandleFunc("DELETE /mass-spectra/{inchiKey}/{id}", auth.Require(auth.RoleCurator, massSpecHandler.DeleteMassSpectrumHandler))
+
+	mux.HandleFunc("GET /admin/api-keys", auth.Require(auth.RoleAdmin, apiKeyAdminHandler.ListAPIKeysHandler))
+	mux.HandleFunc("POST /admin/api-keys", auth.Require(auth.RoleAdmin, apiKeyAdminHandler.CreateAPIKeyHandler))
+	mux.HandleFunc("DELETE /admin/api-keys/{id}", auth.Require(auth.RoleAdmin, apiKeyAdminHandler.RevokeAPIKeyHandler))
+	mux.HandleFunc("GET /admin/image-cooldowns", auth.Require(auth.RoleAdmin, imageAdminHandler.ListCooldownsHandler))
+	mux.HandleFunc("DELETE /admin/image-cooldowns", auth.Require(auth.RoleAdmin, imageAdminHandler.ClearProviderCooldownsHandler))
+	mux.HandleFunc("GET /admin/image-cooldowns/{inchiKey}", auth.Require(auth.RoleAdmin, imageAdminHandler.GetCompoundCooldownsHandler))
+	mux.HandleFunc("DELETE /admin/image-cooldowns/{inchiKey}", auth.Require(auth.RoleAdmin, imageAdminHandler.ClearCompoundCooldownsHandler))
+	mux.HandleFunc("POST /admin/image-providers/{provider}/reset", auth.Require(auth.RoleAdmin, imageAdminHandler.ResetProviderHandler))
+	mux.HandleFunc("GET /admin/image-cache", auth.Require(auth.RoleAdmin, imageAdminHandler.GetImageCacheHandler))
+	mux.HandleFunc("GET /admin/image-prefetch", auth.Require(auth.RoleAdmin, imageAdminHandler.GetPrefetchHandler))
+	mux.HandleFunc("POST /admin/image-prefetch", auth.Require(auth.RoleAdmin, imageAdminHandler.StartPrefetchHandler))
+	mux.HandleFunc("DELETE /admin/image-prefetch", auth.Require(auth.RoleAdmin, imageAdminHandler.StopPrefetchHandler))
+
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: http_helper.WithCORS(mux),
+		Addr: ":8080",
+		// Rate limiting comes before authentication, so invalid tokens cost their sender a token too
+		// instead of a free signature check.
+		Handler: http_helper.WithCORS(rateLimiter.Middleware(authenticator.Middleware(mux))),
 	}
 
 	log.Println("api server listening on :8080")